@@ -0,0 +1,148 @@
+package collect
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/jonathanleahy/folder-bundler/internal/fileutils"
+)
+
+// minChunkSize is the least content a chunk must carry to be worth a part;
+// an -out-max too small for it after the headers is rejected
+const minChunkSize = 64
+
+// exceedsPartLimits reports whether an entry is too big for even an empty part
+func (fc *FileCollator) exceedsPartLimits(entry string) bool {
+	freshBytes, freshTokens := fc.freshPartBudget()
+	if int64(len(entry)) > freshBytes {
+		return true
+	}
+	return fc.tokenizer != nil && int64(fc.tokenizer.Count(entry)) > freshTokens
+}
+
+// writeChunked splits a file that doesn't fit in a part into chunks. The
+// first chunk fills the rest of the current part (unless little room is
+// left) and every following chunk fills a part of its own. Each chunk has a
+// continuation header with the path, chunk index, byte offset and a hash of
+// the chunk, and the first chunk also carries the whole-file metadata.
+func (fc *FileCollator) writeChunked(record manifestEntry, fields string, content []byte, isText bool) error {
+	path := record.path
+	overhead := chunkHeader(path, fields, 99999, 99999, int64(len(content)), int64(len(content)), hex.EncodeToString(make([]byte, sha256.Size)))
+	overheadTokens := int64(0)
+	if fc.tokenizer != nil {
+		overheadTokens = int64(fc.tokenizer.Count(overhead)) + 16
+	}
+	// Room for the content markers and a little slack
+	overheadBytes := int64(len(overhead)) + 128
+
+	freshBytes, freshTokens := fc.freshPartBudget()
+	budgetBytes := fc.params.MaxOutputSize - fc.currentSize
+	budgetTokens := fc.params.MaxTokens - fc.currentTokens
+	if freshBytes-overheadBytes < minChunkSize {
+		return fmt.Errorf("-out-max %d is too small to split %s: its part and chunk headers take %d bytes",
+			fc.params.MaxOutputSize, path, fc.params.MaxOutputSize-freshBytes+overheadBytes)
+	}
+	if budgetBytes < fc.params.MaxOutputSize/4 || budgetBytes-overheadBytes < minChunkSize || (fc.tokenizer != nil && budgetTokens < fc.params.MaxTokens/4) {
+		budgetBytes, budgetTokens = freshBytes, freshTokens
+	}
+
+	var chunks [][]byte
+	for rest := content; len(rest) > 0; {
+		n := fc.fitChunk(rest, budgetBytes-overheadBytes, budgetTokens-overheadTokens, isText)
+		chunks = append(chunks, rest[:n])
+		rest = rest[n:]
+		budgetBytes, budgetTokens = freshBytes, freshTokens
+	}
+
+	fmt.Printf("  Splitting %s into %d chunks\n", path, len(chunks))
+
+	offset := int64(0)
+	record.firstPart = fc.currentPart
+	for i, chunk := range chunks {
+		hash := sha256.Sum256(chunk)
+		chunkFields := ""
+		if i == 0 {
+			chunkFields = fields
+		}
+		entry := chunkHeader(path, chunkFields, i+1, len(chunks), offset, int64(len(chunk)), hex.EncodeToString(hash[:])) + contentBlock(chunk, isText)
+		if err := fc.writeContent(entry); err != nil {
+			return err
+		}
+		if i == 0 {
+			// The first chunk may have started a new part
+			record.firstPart = fc.currentPart
+		}
+		offset += int64(len(chunk))
+	}
+	record.lastPart = fc.currentPart
+	fc.manifest = append(fc.manifest, record)
+	return nil
+}
+
+// freshPartBudget returns the bytes and tokens an empty part has room for.
+// A new part starts with its header, reserved the way createNewFile does.
+func (fc *FileCollator) freshPartBudget() (int64, int64) {
+	header := fc.partHeader(99999, 99999)
+	freshBytes := fc.params.MaxOutputSize - int64(len(header))
+	freshTokens := fc.params.MaxTokens
+	if fc.tokenizer != nil {
+		freshTokens -= int64(fc.tokenizer.Count(header))
+	}
+	return freshBytes, freshTokens
+}
+
+// chunkHeader renders the continuation header of one chunk
+func chunkHeader(path, fields string, index, total int, offset, size int64, hash string) string {
+	return fmt.Sprintf("## File Chunk: %s\n\n%sChunk: %d of %d\n\nOffset: %d\n\nChunk Size: %d bytes\n\nChunk SHA-256: %s\n\n",
+		fileutils.QuotePath(path), fields, index, total, offset, size, hash)
+}
+
+// fitChunk returns how many bytes of data fit in a chunk whose rendered
+// content may use maxBytes bytes and maxTokens tokens
+func (fc *FileCollator) fitChunk(data []byte, maxBytes, maxTokens int64, isText bool) int {
+	// Base64 needs 4 characters for 3 bytes plus a newline every 76 characters
+	if !isText {
+		maxBytes = maxBytes * 57 / 77
+	}
+	if maxBytes < 1 {
+		maxBytes = 1
+	}
+
+	n := len(data)
+	if int64(n) > maxBytes {
+		n = int(maxBytes)
+	}
+
+	if fc.tokenizer != nil {
+		if maxTokens < minChunkSize/4 {
+			maxTokens = minChunkSize / 4
+		}
+		for n > minChunkSize {
+			count := int64(fc.tokenizer.Count(string(data[:n])))
+			if !isText {
+				count = int64(fc.tokenizer.Count(contentBlock(data[:n], false)))
+			}
+			if count <= maxTokens {
+				break
+			}
+			// Shrink in proportion to the overshoot, with a margin for uneven text
+			n = int(int64(n) * maxTokens / count * 95 / 100)
+		}
+	}
+
+	if n >= len(data) || !isText {
+		return n
+	}
+
+	// Cut text after a newline where possible, and never inside a UTF-8 sequence
+	if nl := bytes.LastIndexByte(data[:n], '\n'); nl >= n/2 {
+		return nl + 1
+	}
+	for n > 1 && !utf8.RuneStart(data[n]) {
+		n--
+	}
+	return n
+}
@@ -1,6 +1,8 @@
 package collect
 
 import (
+	"bytes"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
@@ -14,6 +16,9 @@ import (
 	"github.com/jonathanleahy/folder-bundler/internal/compression"
 	"github.com/jonathanleahy/folder-bundler/internal/config"
 	"github.com/jonathanleahy/folder-bundler/internal/fileutils"
+	"github.com/jonathanleahy/folder-bundler/internal/gitignore"
+	"github.com/jonathanleahy/folder-bundler/internal/secrets"
+	"github.com/jonathanleahy/folder-bundler/internal/tokens"
 )
 
 type FileCollator struct {
@@ -21,14 +26,42 @@ type FileCollator struct {
 	currentPart  int
 	currentFile  *os.File
 	baseFileName string
+	rootLabel    string
 	params       *config.Parameters
-	// Compression support
+	// Compression support: the bundle is compressed window by window
 	compressionEnabled bool
-	collectedContent   []byte
-	contentBuffer      strings.Builder
+	selector           *compression.Selector
+	window             bytes.Buffer
+	windowSize         int
+	compressedParts    []compressedPart
+	windowStrategies   map[string]int
+	originalSize       int64
+	compressedSize     int64
+	// Dictionary trained on the first window, which part 1's header carries
+	dictionary        []byte
+	dictionaryTrained bool
+	// Token budget support
+	tokenizer      tokens.Tokenizer
+	currentTokens  int64
+	partTokens     []int64
+	partHasEntries bool
+	// Parts written in front of the part bodies once assembly has started,
+	// for a manifest or compressed windows that don't fit in part 1
+	leadingParts int
+	// Manifest of every entry written, in bundle order
+	manifest []manifestEntry
+	// Secret scanning
+	scanner        *secrets.Scanner
+	secretFindings []secrets.Finding
+	bundleID       string
+	generatedOn    string
+	// Incremental collection: the base bundle, and the paths still present
+	base           *Base
+	seen           map[string]bool
+	unchangedCount int
 	// Statistics
-	fileCount    int
-	totalSize    int64
+	fileCount int
+	totalSize int64
 }
 
 func hasHiddenComponent(path string) bool {
@@ -42,38 +75,172 @@ func hasHiddenComponent(path string) bool {
 }
 
 func ProcessDirectory(params *config.Parameters) error {
+	return process(params, nil)
+}
+
+func process(params *config.Parameters, base *Base) (err error) {
 	fmt.Printf("Starting collection of: %s\n", params.RootDir)
+	for _, configFile := range params.ConfigFiles {
+		fmt.Printf("Using config: %s\n", configFile)
+	}
+	if params.Profile != "" {
+		fmt.Printf("Using profile: %s\n", params.Profile)
+	}
 	
+	collator, err := newCollator(params, base)
+	if err != nil {
+		return err
+	}
+	defer collator.closeCurrentFile()
+
+	// Part bodies are written to temporary files and assembled at the end,
+	// once the manifest is known
+	if err := collator.createNewFile(); err != nil {
+		return err
+	}
+	// A collection that fails leaves no part files behind
+	defer func() {
+		if err != nil {
+			collator.removeOutput()
+		}
+	}()
+
+	// Walk directory and collect/write files
+	err = Walk(params.RootDir, params, collator.processPath)
+	if err != nil {
+		return err
+	}
+	if base != nil {
+		if err := collator.writeTombstones(); err != nil {
+			return err
+		}
+	}
+	if params.GitDiff != "" && params.GitContext >= 0 {
+		if err := collator.collectGitDiff(); err != nil {
+			return err
+		}
+	}
+
+	if err := collator.finishSecretScan(); err != nil {
+		return err
+	}
+
+	// If compression is enabled, compress and write the content
+	if collator.compressionEnabled {
+		err = collator.finalizeWithCompression()
+	} else {
+		if err := collator.assembleParts(); err != nil {
+			return err
+		}
+
+		// Show summary for non-compressed collection
+		fmt.Printf("\nCollection complete:\n")
+		fmt.Printf("  Files processed: %d\n", collator.fileCount)
+		fmt.Printf("  Total size: %s\n", formatSize(collator.totalSize))
+		fmt.Printf("  Output: %s_part*.fb\n", collator.baseFileName)
+		if collator.tokenizer != nil {
+			fmt.Printf("  Estimated tokens per part:\n")
+			for i, count := range collator.partTokens {
+				fmt.Printf("    Part %d: %d tokens\n", i+1, count)
+			}
+		}
+	}
+
+	return err
+}
+
+// newCollator sets up a collation with the compression, token budget and
+// secret scanning params ask for
+func newCollator(params *config.Parameters, base *Base) (*FileCollator, error) {
 	collator := &FileCollator{
 		currentPart:        1,
 		baseFileName:       fmt.Sprintf("%s_collated", filepath.Base(params.RootDir)),
+		rootLabel:          params.RootDir,
 		params:             params,
-		compressionEnabled: params.EnableCompression,
+		compressionEnabled: params.EnableCompression && params.CompressionStrategy != "none",
+		bundleID:           newBundleID(),
+		generatedOn:        time.Now().Format(time.RFC3339),
+	}
+	switch {
+	case params.GitDiff != "":
+		fmt.Printf("Collecting files changed in %s\n", params.GitDiff)
+	case params.Git == "tracked":
+		fmt.Printf("Collecting files tracked by git\n")
+	}
+	if base != nil {
+		fmt.Printf("Incremental since bundle %s\n", base.ID)
+		collator.base = base
+		collator.seen = make(map[string]bool)
+	}
+	if params.RootLabel != "" {
+		collator.rootLabel = params.RootLabel
+	}
+	if params.OutputBase != "" {
+		collator.baseFileName = params.OutputBase
 	}
-	defer collator.closeCurrentFile()
 	
-	if params.EnableCompression {
+	if collator.compressionEnabled {
 		fmt.Printf("Compression enabled: strategy=%s\n", params.CompressionStrategy)
+		if err := compression.InitializeStrategies(); err != nil {
+			return nil, fmt.Errorf("failed to initialize compression strategies: %w", err)
+		}
+		collator.selector = compression.NewSelector(compression.DefaultRegistry)
+		windowSize, err := collator.windowSizeFor()
+		if err != nil {
+			return nil, err
+		}
+		collator.windowSize = windowSize
+		collator.windowStrategies = make(map[string]int)
 	}
 
-	// If compression is enabled, collect all content first
-	if collator.compressionEnabled {
-		// Write to buffer instead of file initially
-		collator.contentBuffer.WriteString(fmt.Sprintf("# Project Files Summary - Part %d\n\nGenerated on: %s\n\nRoot Directory: %s\n\n---\n\n",
-			collator.currentPart, time.Now().Format(time.RFC3339), params.RootDir))
-	} else {
-		if err := collator.createNewFile(); err != nil {
-			return err
+	if params.MaxTokens > 0 {
+		if params.TokenizerVocab != "" {
+			vocab, err := tokens.LoadVocab(params.TokenizerVocab)
+			if err != nil {
+				return nil, err
+			}
+			collator.tokenizer = vocab
+		} else {
+			collator.tokenizer = tokens.NewApprox()
 		}
+		fmt.Printf("Token budget: %d tokens per part (tokenizer: %s)\n", params.MaxTokens, collator.tokenizer.Name())
 	}
 
-	// Walk directory and collect/write files
-	err := filepath.Walk(params.RootDir, func(path string, info os.FileInfo, err error) error {
+	if params.SecretsMode != secrets.ModeOff {
+		scanner, err := secrets.NewScanner(params.SecretPatterns)
+		if err != nil {
+			return nil, err
+		}
+		collator.scanner = scanner
+	}
+	return collator, nil
+}
+
+// Walk calls fn for every path below root that collect bundles, in the
+// order they are bundled: hidden paths, include/exclude rules and .gitignore
+// files are applied as params set them. With -git or -git-diff only the
+// files git lists are walked, and .gitignore files are left to git.
+func Walk(root string, params *config.Parameters, fn func(relPath string, info os.FileInfo) error) error {
+	selected, err := selectFromGit(root, params)
+	if err != nil {
+		return err
+	}
+
+	// Load .gitignore rules unless disabled
+	var ignorer *gitignore.Matcher
+	if !params.SkipGitignore && selected == nil {
+		ignorer, err = gitignore.New(root)
+		if err != nil {
+			return fmt.Errorf("error loading gitignore rules: %v", err)
+		}
+	}
+
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
-		relPath, err := filepath.Rel(params.RootDir, path)
+		relPath, err := filepath.Rel(root, path)
 		if err != nil || relPath == "." {
 			return nil
 		}
@@ -86,53 +253,96 @@ func ProcessDirectory(params *config.Parameters) error {
 			return nil
 		}
 
-		// Skip excluded directories
-		if info.IsDir() && params.ExcludedDirs[info.Name()] {
-			return filepath.SkipDir
+		// Apply include/exclude rules (including the -skip-* shorthands)
+		if params.Rules != nil && params.Rules.Excluded(relPath, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
 		}
 
-		return collator.processPath(relPath, info)
-	})
-
-	if err != nil {
-		return err
-	}
+		// Only what git listed, and the directories on the way to it. A
+		// directory git lists itself is a submodule, collected without its files.
+		if selected != nil {
+			slashPath := filepath.ToSlash(relPath)
+			switch {
+			case info.IsDir() && selected.files[slashPath]:
+				if err := fn(relPath, info); err != nil {
+					return err
+				}
+				return filepath.SkipDir
+			case info.IsDir() && !selected.dirs[slashPath]:
+				return filepath.SkipDir
+			case !info.IsDir() && !selected.files[slashPath]:
+				return nil
+			}
+		}
 
-	// If compression is enabled, compress and write the content
-	if collator.compressionEnabled {
-		err = collator.finalizeWithCompression()
-	} else {
-		// Show summary for non-compressed collection
-		fmt.Printf("\nCollection complete:\n")
-		fmt.Printf("  Files processed: %d\n", collator.fileCount)
-		fmt.Printf("  Total size: %s\n", formatSize(collator.totalSize))
-		fmt.Printf("  Output: %s_part*.fb\n", collator.baseFileName)
-	}
+		// Skip paths ignored by git, and pick up nested .gitignore files as we descend
+		if ignorer != nil {
+			if ignorer.Match(relPath, info.IsDir()) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.IsDir() {
+				if err := ignorer.AddDir(relPath); err != nil {
+					return err
+				}
+			}
+		}
 
-	return err
+		return fn(relPath, info)
+	})
 }
 
 func (fc *FileCollator) processPath(relPath string, info os.FileInfo) error {
 	// Normalize path to use forward slashes for cross-platform compatibility
 	normalizedPath := filepath.ToSlash(relPath)
+	quotedPath := fileutils.QuotePath(normalizedPath)
 	
 	fullPath := filepath.Join(fc.params.RootDir, relPath)
 	
 	// Check if it's a symlink
 	if info.Mode()&os.ModeSymlink != 0 {
 		target, err := os.Readlink(fullPath)
+		if skip, serr := fc.unchanged(normalizedPath, BaseEntry{Kind: "symlink", Target: target}); skip || serr != nil {
+			return serr
+		}
 		if err != nil {
-			return fc.writeContent(fmt.Sprintf("## Symlink: %s (Error reading target: %v)\n\n", normalizedPath, err))
+			return fc.writeEntry(manifestEntry{path: normalizedPath, kind: "symlink"},
+				fmt.Sprintf("## Symlink: %s (Error reading target: %v)\n\n", quotedPath, err))
 		}
-		return fc.writeContent(fmt.Sprintf("## Symlink: %s\n\nTarget: %s\n\n", normalizedPath, target))
+		return fc.writeEntry(manifestEntry{path: normalizedPath, kind: "symlink", target: target},
+			fmt.Sprintf("## Symlink: %s\n\nTarget: %s\n\n", quotedPath, fileutils.QuotePath(target)))
 	}
 	
+	mode := fmt.Sprintf("%04o", info.Mode().Perm())
 	if info.IsDir() {
-		return fc.writeContent(fmt.Sprintf("## Directory: %s\n\n", normalizedPath))
+		if skip, err := fc.unchanged(normalizedPath, BaseEntry{Kind: "dir", Mode: mode}); skip || err != nil {
+			return err
+		}
+		return fc.writeEntry(manifestEntry{path: normalizedPath, kind: "dir"},
+			fmt.Sprintf("## Directory: %s\n\n%s", quotedPath, fc.permissionFields(info)))
 	}
 
+	if skipped, ok := fc.params.Skipped[normalizedPath]; ok {
+		return fc.writeEntry(manifestEntry{path: normalizedPath, kind: "skipped", size: skipped.Size},
+			fmt.Sprintf("## File: %s (Skipped - Size %d exceeds max %d)\n\n", quotedPath, skipped.Size, skipped.MaxSize))
+	}
 	if info.Size() > fc.params.MaxFileSize {
-		return fc.writeContent(fmt.Sprintf("## File: %s (Skipped - Size %d exceeds max %d)\n\n", normalizedPath, info.Size(), fc.params.MaxFileSize))
+		if skip, err := fc.unchanged(normalizedPath, BaseEntry{Kind: "skipped", Size: info.Size()}); skip || err != nil {
+			return err
+		}
+		return fc.writeEntry(manifestEntry{path: normalizedPath, kind: "skipped", size: info.Size()},
+			fmt.Sprintf("## File: %s (Skipped - Size %d exceeds max %d)\n\n", quotedPath, info.Size(), fc.params.MaxFileSize))
+	}
+
+	// Compressed bundles stream content through the window, so a file never
+	// has to fit in memory
+	if fc.compressionEnabled {
+		return fc.streamFile(fullPath, normalizedPath, info)
 	}
 
 	content, err := ioutil.ReadFile(fullPath)
@@ -140,37 +350,176 @@ func (fc *FileCollator) processPath(relPath string, info os.FileInfo) error {
 		return err
 	}
 
+	isText := fileutils.IsTextFile(content)
+	redacted := 0
+	if isText && fc.scanner != nil {
+		content, redacted = fc.scanSecrets(normalizedPath, content)
+	}
+
 	// Calculate SHA-256 hash
 	hash := sha256.Sum256(content)
 	hashStr := hex.EncodeToString(hash[:])
 
-	metadata := fmt.Sprintf("## File: %s\n\nSize: %d bytes\n\nSHA-256: %s\n\nLast Modified: %s\n\n",
-		normalizedPath, info.Size(), hashStr, info.ModTime().Format(time.RFC3339))
+	if skip, err := fc.unchanged(normalizedPath, BaseEntry{Kind: "file", Size: int64(len(content)), Hash: hashStr, Mode: mode}); skip || err != nil {
+		return err
+	}
 
+	fields := fc.fileFields(normalizedPath, info, int64(len(content)), hashStr, redacted)
 	fc.fileCount++
 	fc.totalSize += info.Size()
 
-	if fileutils.IsTextFile(content) {
-		contentStr := string(content)
-		// Add a unique marker that won't conflict with actual content
-		return fc.writeContent(fmt.Sprintf("%s--- FILE CONTENT BEGIN ---\n%s\n@CONTENT-END@\n--- FILE CONTENT END ---\n\n", metadata, contentStr))
+	entry := fmt.Sprintf("## File: %s\n\n%s%s", quotedPath, fields, contentBlock(content, isText))
+	record := fileRecord(normalizedPath, int64(len(content)), hashStr)
+
+	// Files that can't fit in a single part are split across several
+	if !fc.compressionEnabled && fc.exceedsPartLimits(entry) {
+		return fc.writeChunked(record, fields, content, isText)
+	}
+	return fc.writeEntry(record, entry)
+}
+
+// fileFields renders the metadata of a file entry, up to its content
+func (fc *FileCollator) fileFields(path string, info os.FileInfo, size int64, hash string, redacted int) string {
+	fields := fmt.Sprintf("Size: %d bytes\n\nSHA-256: %s\n\nLast Modified: %s\n\n%s",
+		size, hash, info.ModTime().Format(time.RFC3339), fc.permissionFields(info))
+	if redacted > 0 {
+		fields += fmt.Sprintf("Redacted: %d secret(s)\n\n", redacted)
+	}
+	// Lets reconstruct check that the file it replaces is the base bundle's
+	if base, ok := fc.base.entry(path); ok && base.Kind == "file" && base.Hash != "" {
+		fields += fmt.Sprintf("Base SHA-256: %s\n\n", base.Hash)
+	}
+	return fields
+}
+
+// fileRecord is the manifest entry of a file
+func fileRecord(path string, size int64, hash string) manifestEntry {
+	return manifestEntry{
+		path:     path,
+		kind:     "file",
+		size:     size,
+		hash:     hash,
+		language: fileutils.GetLanguage(filepath.Ext(path)),
+	}
+}
+
+// permissionFields renders the permission bits of a file or directory and,
+// with -owner, its uid and gid
+func (fc *FileCollator) permissionFields(info os.FileInfo) string {
+	fields := fmt.Sprintf("Mode: %04o\n\n", info.Mode().Perm())
+	if fc.params.PreserveOwner {
+		if uid, gid, ok := fileutils.FileOwner(info); ok {
+			fields += fmt.Sprintf("Owner: %d:%d\n\n", uid, gid)
+		}
+	}
+	return fields
+}
+
+// writeEntry writes one entry and records it, with the part that holds it, for the manifest
+func (fc *FileCollator) writeEntry(record manifestEntry, content string) error {
+	if err := fc.writeContent(content); err != nil {
+		return err
+	}
+	record.firstPart, record.lastPart = fc.currentPart, fc.currentPart
+	fc.manifest = append(fc.manifest, record)
+	return nil
+}
+
+// contentBlock renders file content between the content markers. Text is
+// written as is; binary content is base64 encoded with line wrapping. The
+// begin marker records the exact length of what follows, so content that
+// looks like a marker can't end it early.
+func contentBlock(content []byte, isText bool) string {
+	if isText {
+		return fmt.Sprintf("--- FILE CONTENT BEGIN (%d bytes) ---\n%s\n--- FILE CONTENT END ---\n\n", len(content), string(content))
 	}
 
 	// Binary file - encode to base64 with line wrapping
 	encoded := base64.StdEncoding.EncodeToString(content)
 	wrapped := wrapBase64(encoded, 76)
-	return fc.writeContent(fmt.Sprintf("%s--- FILE CONTENT BEGIN (BASE64) ---\n%s\n@CONTENT-END@\n--- FILE CONTENT END ---\n\n", metadata, wrapped))
+	return fmt.Sprintf("--- FILE CONTENT BEGIN (BASE64, %d bytes) ---\n%s\n--- FILE CONTENT END ---\n\n", len(wrapped), wrapped)
+}
+
+// scanSecrets runs the secret scanner over text content. In redact mode it
+// returns the redacted content and the number of secrets replaced.
+func (fc *FileCollator) scanSecrets(path string, content []byte) ([]byte, int) {
+	scanned, findings := fc.scanner.Scan(path, string(content), fc.params.SecretsMode == secrets.ModeRedact)
+	if redacted := fc.reportSecrets(findings); redacted > 0 {
+		return []byte(scanned), redacted
+	}
+	return content, 0
+}
+
+// reportSecrets prints and records what the secret scanner found, and
+// returns the number of secrets redacted
+func (fc *FileCollator) reportSecrets(findings []secrets.Finding) int {
+	mode := fc.params.SecretsMode
+	for _, f := range findings {
+		switch mode {
+		case secrets.ModeRedact:
+			fmt.Printf("  Redacted %s in %s:%d\n", f.Rule, f.Path, f.Line)
+		default:
+			fmt.Printf("  Warning: possible %s in %s:%d\n", f.Rule, f.Path, f.Line)
+		}
+	}
+	fc.secretFindings = append(fc.secretFindings, findings...)
+
+	if mode == secrets.ModeRedact {
+		return len(findings)
+	}
+	return 0
+}
+
+// finishSecretScan writes the secret report and, in fail mode, aborts the
+// collection
+func (fc *FileCollator) finishSecretScan() error {
+	if len(fc.secretFindings) == 0 {
+		return nil
+	}
+
+	reportFile := fc.params.SecretsReport
+	if reportFile == "" {
+		reportFile = fc.baseFileName + "_secrets.txt"
+	}
+	if err := secrets.WriteReport(reportFile, fc.params.SecretsMode, fc.secretFindings); err != nil {
+		return fmt.Errorf("error writing secret report: %v", err)
+	}
+	fmt.Printf("\nSecret scan: %d finding(s), see %s\n", len(fc.secretFindings), reportFile)
+
+	if fc.params.SecretsMode == secrets.ModeFail {
+		return fmt.Errorf("%d possible secret(s) found; nothing was written (use -secrets redact to redact them)", len(fc.secretFindings))
+	}
+	return nil
+}
+
+// removeOutput deletes the part bodies and part files written so far
+func (fc *FileCollator) removeOutput() {
+	fc.closeCurrentFile()
+	for part := 1; part <= fc.currentPart; part++ {
+		os.Remove(fc.bodyFileName(part))
+	}
+	for part := 1; part <= fc.currentPart+fc.leadingParts; part++ {
+		os.Remove(fc.partFileName(part))
+	}
 }
 
 func (fc *FileCollator) writeContent(content string) error {
-	// If compression is enabled, buffer content instead of writing
+	// Compressed bundles are written a window at a time
 	if fc.compressionEnabled {
-		fc.contentBuffer.WriteString(content)
-		return nil
+		return fc.bufferCompressed(content)
 	}
 
 	contentSize := int64(len(content))
-	if fc.currentSize+contentSize > fc.params.MaxOutputSize {
+	var contentTokens int64
+	if fc.tokenizer != nil {
+		contentTokens = int64(fc.tokenizer.Count(content))
+	}
+
+	// Start a new part when a limit would be exceeded, but never leave a part
+	// without entries: an oversized entry goes into a part on its own
+	overSize := fc.currentSize+contentSize > fc.params.MaxOutputSize
+	overTokens := fc.tokenizer != nil && fc.currentTokens+contentTokens > fc.params.MaxTokens
+	if fc.partHasEntries && (overSize || overTokens) {
 		fc.currentPart++
 		if err := fc.createNewFile(); err != nil {
 			return err
@@ -183,102 +532,87 @@ func (fc *FileCollator) writeContent(content string) error {
 	}
 
 	fc.currentSize += contentSize
+	fc.addTokens(contentTokens)
+	fc.partHasEntries = true
 	return nil
 }
 
+// createNewFile starts the body of a new part. Bodies go to temporary files;
+// assembleParts adds the headers and the manifest once collection is done.
 func (fc *FileCollator) createNewFile() error {
 	fc.closeCurrentFile()
 
-	fileName := fmt.Sprintf("%s_part%d.fb", fc.baseFileName, fc.currentPart)
-	file, err := os.Create(fileName)
+	file, err := os.Create(fc.bodyFileName(fc.currentPart))
 	if err != nil {
 		return err
 	}
 
 	fc.currentFile = file
-	fc.currentSize = 0
-
-	header := fmt.Sprintf("# Project Files Summary - Part %d\n\nGenerated on: %s\n\nRoot Directory: %s\n\n---\n\n",
-		fc.currentPart, time.Now().Format(time.RFC3339), fc.params.RootDir)
+	fc.currentTokens = 0
+	fc.partHasEntries = false
 
-	_, err = fc.currentFile.WriteString(header)
-	return err
+	// The header counts towards the part size; reserve room for the widest part numbers
+	header := fc.partHeader(99999, 99999)
+	if fc.compressionEnabled {
+		header = fc.compressionHeader(99999, 99999, widestPart)
+		fc.compressedParts = append(fc.compressedParts, compressedPart{})
+	}
+	if fc.tokenizer != nil {
+		fc.partTokens = append(fc.partTokens, 0)
+		fc.addTokens(int64(fc.tokenizer.Count(header)))
+	}
+	fc.currentSize = int64(len(header))
+	if fc.compressionEnabled && fc.currentPart == 1 {
+		// Part 1 also carries the shared dictionary
+		fc.currentSize += fc.dictionaryReserve()
+	}
+	return nil
 }
 
-func (fc *FileCollator) closeCurrentFile() {
-	if fc.currentFile != nil {
-		fc.currentFile.Close()
-		fc.currentFile = nil
+// partHeader renders the header at the top of every part. The bundle ID ties
+// the parts of one collection together; an incremental bundle also names the
+// bundle it applies to.
+func (fc *FileCollator) partHeader(part, totalParts int) string {
+	base := ""
+	if fc.base != nil {
+		base = fmt.Sprintf("Base Bundle ID: %s\n\n", fc.base.ID)
 	}
+	return config.FormatLine() + fmt.Sprintf("# Project Files Summary - Part %d\n\nBundle ID: %s\n\n%sPart: %d of %d\n\nGenerated on: %s\n\nRoot Directory: %s\n\n---\n\n",
+		part, fc.bundleID, base, part, totalParts, fc.generatedOn, fileutils.QuotePath(fc.rootLabel))
 }
 
-func (fc *FileCollator) finalizeWithCompression() error {
-	// Get the buffered content
-	content := fc.contentBuffer.String()
-	originalSize := len(content)
-	
-	// Initialize compression strategies
-	if err := compression.InitializeStrategies(); err != nil {
-		return fmt.Errorf("failed to initialize compression strategies: %w", err)
-	}
-	
-	// Create compression selector
-	selector := compression.NewSelector(compression.DefaultRegistry)
-	
-	// Compress content using specified strategy
-	result, err := selector.CompressContentWithStrategy([]byte(content), fc.params.CompressionStrategy)
-	if err != nil {
-		return fmt.Errorf("compression failed: %w", err)
+// newBundleID returns a random identifier for the parts of one collection
+func newBundleID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		// Fall back to the clock; IDs only need to differ between runs
+		return fmt.Sprintf("%016x", time.Now().UnixNano())
 	}
-	
-	// Create output file without header for compressed content
-	fc.closeCurrentFile()
-	fileName := fmt.Sprintf("%s_part%d.fb", fc.baseFileName, fc.currentPart)
-	file, err := os.Create(fileName)
-	if err != nil {
-		return err
-	}
-	fc.currentFile = file
-	fc.currentSize = 0
-	
-	// Write compression metadata if compressed
-	if result.Strategy != "none" {
-		header := fmt.Sprintf("# Compression: %s\n# Original Size: %d bytes\n# Compressed Size: %d bytes\n# Ratio: %.2f%%\n\n",
-			result.Metadata, originalSize, len(result.Compressed), result.Ratio*100)
-		if _, err := fc.currentFile.WriteString(header); err != nil {
-			return err
-		}
-	}
-	
-	// Write the content (compressed or original)
-	if _, err := fc.currentFile.Write(result.Compressed); err != nil {
-		return err
+	return hex.EncodeToString(id)
+}
+
+func (fc *FileCollator) partFileName(part int) string {
+	return fmt.Sprintf("%s_part%d.fb", fc.baseFileName, part)
+}
+
+func (fc *FileCollator) bodyFileName(part int) string {
+	return fc.partFileName(part) + ".tmp"
+}
+
+// addTokens records tokens written to the current part
+func (fc *FileCollator) addTokens(count int64) {
+	if fc.tokenizer == nil {
+		return
 	}
-	
-	// Show detailed results
-	fmt.Printf("\nCollection complete:\n")
-	fmt.Printf("  Files processed: %d\n", fc.fileCount)
-	fmt.Printf("  Total size: %s\n", formatSize(fc.totalSize))
-	
-	if result.Strategy != "none" {
-		fmt.Printf("  Compression: %s\n", result.Strategy)
-		fmt.Printf("  Original output size: %s\n", formatSize(int64(originalSize)))
-		fmt.Printf("  Compressed size: %s\n", formatSize(int64(len(result.Compressed))))
-		fmt.Printf("  Space saved: %s (%.1f%% reduction)\n", 
-			formatSize(int64(originalSize - len(result.Compressed))), 
-			(1-result.Ratio)*100)
-	} else {
-		if fc.params.CompressionStrategy == "none" {
-			fmt.Printf("  Compression: none\n")
-		} else {
-			fmt.Printf("  Compression: %s (not applied - no benefit)\n", fc.params.CompressionStrategy)
-		}
-		fmt.Printf("  Output size: %s\n", formatSize(int64(originalSize)))
+	fc.currentTokens += count
+	fc.partTokens[len(fc.partTokens)-1] += count
+}
+
+func (fc *FileCollator) closeCurrentFile() {
+	if fc.currentFile != nil {
+		fc.currentFile.Close()
+		fc.currentFile = nil
 	}
-	
-	fmt.Printf("  Output file: %s\n", fileName)
-	
-	return nil
 }
 
 // formatSize formats bytes into human readable format
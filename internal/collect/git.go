@@ -0,0 +1,134 @@
+package collect
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+	"github.com/jonathanleahy/folder-bundler/internal/git"
+)
+
+// gitSelection is the set of files -git or -git-diff limit a walk to, and
+// the directories that hold them
+type gitSelection struct {
+	files map[string]bool
+	dirs  map[string]bool
+}
+
+// selectFromGit asks git which files to collect, or returns nil when
+// neither -git nor -git-diff is set. Outside a repository -git tracked
+// falls back to collecting every file; -git-diff has nothing to compare.
+func selectFromGit(root string, params *config.Parameters) (*gitSelection, error) {
+	var paths []string
+	var err error
+	switch {
+	case params.GitDiff != "":
+		paths, err = git.Changed(root, params.GitDiff)
+		if errors.Is(err, git.ErrNotRepository) {
+			return nil, fmt.Errorf("-git-diff needs a git repository, and %s is not in one", root)
+		}
+	case params.Git == "tracked":
+		paths, err = git.Tracked(root)
+		if errors.Is(err, git.ErrNotRepository) {
+			fmt.Fprintf(os.Stderr, "Warning: %s is not in a git repository; -git tracked is ignored\n", root)
+			return nil, nil
+		}
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sel := &gitSelection{files: make(map[string]bool), dirs: make(map[string]bool)}
+	for _, p := range paths {
+		sel.files[p] = true
+		for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+			sel.dirs[dir] = true
+		}
+	}
+	return sel, nil
+}
+
+// collectGitDiff writes the diff of every collected file over the -git-diff
+// range as the last section of the bundle. Deleted files are included too,
+// unless hidden or excluded as they would have been on disk.
+func (fc *FileCollator) collectGitDiff() error {
+	var paths []string
+	for _, e := range fc.manifest {
+		if e.kind == "file" {
+			paths = append(paths, e.path)
+		}
+	}
+	deleted, err := git.Deleted(fc.params.RootDir, fc.params.GitDiff)
+	if err != nil {
+		return err
+	}
+	for _, p := range deleted {
+		relPath := filepath.FromSlash(p)
+		if !fc.params.IncludeHidden && hasHiddenComponent(relPath) {
+			continue
+		}
+		if fc.params.Rules != nil && fc.params.Rules.Excluded(relPath, false) {
+			continue
+		}
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var patch strings.Builder
+	for _, p := range paths {
+		diff, err := git.Diff(fc.params.RootDir, fc.params.GitDiff, fc.params.GitContext, p)
+		if err != nil {
+			return fmt.Errorf("error reading the git diff of %s: %v", p, err)
+		}
+		patch.WriteString(diff)
+	}
+
+	content := []byte(patch.String())
+	if fc.scanner != nil {
+		content, _ = fc.scanSecrets("git diff "+fc.params.GitDiff, content)
+	}
+	return fc.writeGitDiff(content)
+}
+
+// writeGitDiff writes the -git-context section, framed like file content so
+// readers can skip it. A diff too big for an empty part is split into
+// pieces that each fill a part of their own, the way writeChunked splits
+// files.
+func (fc *FileCollator) writeGitDiff(diff []byte) error {
+	header := fmt.Sprintf("## Git Diff\n\nRange: %s\n\nContext Lines: %d\n\n", fc.params.GitDiff, fc.params.GitContext)
+	section := header + contentBlock(diff, true)
+	if !fc.exceedsPartLimits(section) {
+		return fc.writeContent(section)
+	}
+
+	overhead := header + "Piece: 99999 of 99999\n\n"
+	overheadBytes := int64(len(overhead)) + 128
+	overheadTokens := int64(0)
+	if fc.tokenizer != nil {
+		overheadTokens = int64(fc.tokenizer.Count(overhead)) + 16
+	}
+	freshBytes, freshTokens := fc.freshPartBudget()
+
+	var pieces [][]byte
+	for rest := diff; len(rest) > 0; {
+		n := fc.fitChunk(rest, freshBytes-overheadBytes, freshTokens-overheadTokens, true)
+		pieces = append(pieces, rest[:n])
+		rest = rest[n:]
+	}
+
+	fmt.Printf("  Splitting the git diff into %d pieces\n", len(pieces))
+	for i, piece := range pieces {
+		entry := fmt.Sprintf("%sPiece: %d of %d\n\n%s", header, i+1, len(pieces), contentBlock(piece, true))
+		if err := fc.writeContent(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
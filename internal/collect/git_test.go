@@ -0,0 +1,91 @@
+package collect
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+	"github.com/jonathanleahy/folder-bundler/internal/secrets"
+)
+
+func gitCommand(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+}
+
+func TestGitDiffFollowsPartLimits(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	gitCommand(t, src, "init", "-q", "-b", "main")
+	write := func(format string) {
+		var b strings.Builder
+		for i := 0; i < 2000; i++ {
+			fmt.Fprintf(&b, format, i)
+		}
+		if err := os.WriteFile(filepath.Join(src, "values.txt"), []byte(b.String()), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("old value %d\n")
+	gitCommand(t, src, "add", "-A")
+	gitCommand(t, src, "commit", "-q", "-m", "first")
+	write("new value %d\n")
+	gitCommand(t, src, "commit", "-q", "-am", "second")
+
+	// The diff alone is several times -out-max
+	const maxOutput = 16 * 1024
+	params := &config.Parameters{
+		MaxFileSize:   1 << 20,
+		MaxOutputSize: maxOutput,
+		RootDir:       src,
+		RootLabel:     "src",
+		OutputBase:    filepath.Join(dir, "src_collated"),
+		SecretsMode:   secrets.ModeOff,
+		GitDiff:       "main~1..main",
+		GitContext:    0,
+	}
+	if err := ProcessDirectory(params); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+
+	parts, err := filepath.Glob(filepath.Join(dir, "src_collated_part*.fb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var diff strings.Builder
+	for _, part := range parts {
+		content, err := os.ReadFile(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(content) > maxOutput {
+			t.Errorf("%s: %d bytes, over -out-max %d", filepath.Base(part), len(content), maxOutput)
+		}
+		diff.Write(content)
+	}
+	if n := strings.Count(diff.String(), "## Git Diff\n"); n < 2 {
+		t.Errorf("git diff written as %d sections, want it split", n)
+	}
+	for i := 0; i < 2000; i++ {
+		if line := fmt.Sprintf("+new value %d\n", i); !strings.Contains(diff.String(), line) {
+			t.Fatalf("bundle is missing diff line %q", line)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package collect
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+	"github.com/jonathanleahy/folder-bundler/internal/fileutils"
+)
+
+// Base is the bundle an incremental bundle is collected against: its ID and
+// what it recorded for each path
+type Base struct {
+	ID      string
+	Entries map[string]BaseEntry
+}
+
+// BaseEntry is what a bundle recorded for one path. Mode is in octal, and
+// empty when the bundle didn't record it.
+type BaseEntry struct {
+	Kind   string // dir, file, symlink or skipped
+	Size   int64
+	Hash   string
+	Mode   string
+	Target string
+}
+
+// BaseReader reads what a bundle recorded, for collecting against it.
+// Reading bundles is left to the caller, which knows the bundle format.
+type BaseReader func(path string) (*Base, error)
+
+// CollectIncremental collects params.RootDir as an incremental bundle: only
+// what was added or changed since the bundle params.Since belongs to, and
+// tombstones for what was deleted
+func CollectIncremental(params *config.Parameters, readBase BaseReader) error {
+	info, err := os.Stat(params.Since)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("-since takes a bundle, not a directory: %s", params.Since)
+	}
+	base, err := readBase(params.Since)
+	if err != nil {
+		return err
+	}
+
+	// Keep the base bundle's part names free
+	if params.OutputBase == "" {
+		params.OutputBase = fmt.Sprintf("%s_incremental", filepath.Base(params.RootDir))
+	}
+	return process(params, base)
+}
+
+// entry returns what the base bundle recorded for path
+func (b *Base) entry(path string) (BaseEntry, bool) {
+	if b == nil {
+		return BaseEntry{}, false
+	}
+	e, ok := b.Entries[path]
+	return e, ok
+}
+
+// unchanged reports whether an entry is the same as in the base bundle, so
+// an incremental bundle can leave it out. An entry that replaces one of
+// another kind gets a tombstone first, so the old one is removed.
+func (fc *FileCollator) unchanged(path string, current BaseEntry) (bool, error) {
+	if fc.base == nil {
+		return false, nil
+	}
+	fc.seen[path] = true
+	base, ok := fc.base.entry(path)
+	if !ok {
+		return false, nil
+	}
+	if base.Kind != current.Kind {
+		return false, fc.writeTombstone(path, base)
+	}
+
+	same := false
+	switch current.Kind {
+	case "symlink":
+		same = base.Target == current.Target
+	case "skipped":
+		same = base.Size == current.Size
+	case "file":
+		same = base.Size == current.Size && base.Hash == current.Hash
+	default:
+		same = true
+	}
+	if same && base.Mode != "" && base.Mode != current.Mode {
+		same = false
+	}
+	if same {
+		fc.unchangedCount++
+	}
+	return same, nil
+}
+
+// writeTombstones records every path of the base bundle that wasn't
+// collected this time, children before the directories that hold them
+func (fc *FileCollator) writeTombstones() error {
+	var gone []string
+	for path := range fc.base.Entries {
+		if !fc.seen[path] {
+			gone = append(gone, path)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(gone)))
+
+	for _, path := range gone {
+		if err := fc.writeTombstone(path, fc.base.Entries[path]); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("  Incremental: %d unchanged entries left out, %d deleted\n", fc.unchangedCount, len(gone))
+	return nil
+}
+
+// writeTombstone writes a deleted entry. Deleted files carry their hash, so
+// reconstruct can check that the file it removes is the base bundle's.
+func (fc *FileCollator) writeTombstone(path string, base BaseEntry) error {
+	entry := fmt.Sprintf("## Deleted: %s\n\n", fileutils.QuotePath(path))
+	if base.Kind == "file" && base.Hash != "" {
+		entry += fmt.Sprintf("Base SHA-256: %s\n\n", base.Hash)
+	}
+	return fc.writeEntry(manifestEntry{path: path, kind: "deleted"}, entry)
+}
@@ -0,0 +1,21 @@
+package collect
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+)
+
+func TestCollectIncrementalRejectsDirectory(t *testing.T) {
+	dir := t.TempDir()
+	params := &config.Parameters{RootDir: dir, Since: dir}
+	readBase := func(path string) (*Base, error) {
+		t.Fatalf("read %s as a bundle", path)
+		return nil, nil
+	}
+	err := CollectIncremental(params, readBase)
+	if err == nil || !strings.Contains(err.Error(), "-since takes a bundle, not a directory") {
+		t.Errorf("got %v, want the directory rejected", err)
+	}
+}
@@ -0,0 +1,199 @@
+package collect
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jonathanleahy/folder-bundler/internal/fileutils"
+)
+
+// manifestEntry describes one entry of the bundle and the parts that hold it
+type manifestEntry struct {
+	path      string
+	kind      string // dir, file, symlink, skipped or deleted
+	size      int64
+	hash      string
+	language  string
+	target    string
+	firstPart int
+	lastPart  int
+}
+
+// renderManifest renders the manifest section written at the top of part 1:
+// a directory tree followed by one tab-separated line per entry. shift is
+// added to every part number, for when the manifest gets a part of its own.
+func (fc *FileCollator) renderManifest(shift int) string {
+	var b strings.Builder
+	b.WriteString("## Manifest\n\n")
+	fmt.Fprintf(&b, "Entries: %d\n\n", len(fc.manifest))
+	if !fc.compressionEnabled {
+		fmt.Fprintf(&b, "Parts: %d\n\n", fc.currentPart+shift)
+	}
+
+	b.WriteString("```text\n")
+	b.WriteString(fc.renderTree())
+	b.WriteString("```\n\n")
+
+	b.WriteString("--- MANIFEST BEGIN ---\n")
+	b.WriteString("# type\tsize\tsha256\tlanguage\tpart\tpath\n")
+	for _, e := range fc.manifest {
+		size := "-"
+		if e.kind == "file" || e.kind == "skipped" {
+			size = fmt.Sprintf("%d", e.size)
+		}
+		// Compressed bundles are one stream, so entries have no part of their own
+		part := "-"
+		if !fc.compressionEnabled {
+			part = fmt.Sprintf("%d", e.firstPart+shift)
+			if e.lastPart != e.firstPart {
+				part = fmt.Sprintf("%d-%d", e.firstPart+shift, e.lastPart+shift)
+			}
+		}
+		fmt.Fprintf(&b, "%s\t%s\t%s\t%s\t%s\t%s\n", e.kind, size, orDash(e.hash), orDash(e.language), part, fileutils.QuotePath(e.path))
+	}
+	b.WriteString("--- MANIFEST END ---\n\n")
+	b.WriteString("---\n\n")
+	return b.String()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// treeNode is a directory tree built from the manifest paths
+type treeNode struct {
+	name     string
+	label    string
+	children []*treeNode
+	index    map[string]*treeNode
+}
+
+func (n *treeNode) child(name string) *treeNode {
+	if c, ok := n.index[name]; ok {
+		return c
+	}
+	c := &treeNode{name: name, label: fileutils.QuotePath(name), index: make(map[string]*treeNode)}
+	n.children = append(n.children, c)
+	n.index[name] = c
+	return c
+}
+
+// renderTree renders the manifest entries as an indented directory tree
+func (fc *FileCollator) renderTree() string {
+	root := &treeNode{index: make(map[string]*treeNode)}
+	for _, e := range fc.manifest {
+		node := root
+		for _, segment := range strings.Split(e.path, "/") {
+			node = node.child(segment)
+		}
+		switch e.kind {
+		case "dir":
+			node.label = fileutils.QuotePath(node.name) + "/"
+		case "symlink":
+			node.label = fileutils.QuotePath(node.name) + " -> " + fileutils.QuotePath(e.target)
+		case "skipped":
+			node.label = fileutils.QuotePath(node.name) + " (skipped)"
+		case "deleted":
+			node.label = fileutils.QuotePath(node.name) + " (deleted)"
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(fileutils.QuotePath(filepath.Base(fc.rootLabel)) + "/\n")
+	renderTreeNodes(&b, root.children, "")
+	return b.String()
+}
+
+func renderTreeNodes(b *strings.Builder, nodes []*treeNode, prefix string) {
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].name < nodes[j].name })
+	for i, node := range nodes {
+		connector, indent := "├── ", "│   "
+		if i == len(nodes)-1 {
+			connector, indent = "└── ", "    "
+		}
+		b.WriteString(prefix + connector + node.label + "\n")
+		renderTreeNodes(b, node.children, prefix+indent)
+	}
+}
+
+// assembleParts writes the final part files: each part's header followed by
+// its body, with the manifest at the top of part 1. When the manifest doesn't
+// fit in part 1 next to its entries, it gets a part of its own and every
+// other part moves up by one.
+func (fc *FileCollator) assembleParts() error {
+	fc.closeCurrentFile()
+
+	manifest := fc.renderManifest(0)
+	shift := 0
+
+	info, err := os.Stat(fc.bodyFileName(1))
+	if err != nil {
+		return err
+	}
+	parts := fc.currentPart
+	overSize := int64(len(fc.partHeader(1, parts))+len(manifest))+info.Size() > fc.params.MaxOutputSize
+	overTokens := fc.tokenizer != nil && fc.partTokens[0]+int64(fc.tokenizer.Count(manifest)) > fc.params.MaxTokens
+	if info.Size() > 0 && (overSize || overTokens) {
+		shift = 1
+		manifest = fc.renderManifest(shift)
+	}
+
+	if fc.tokenizer != nil {
+		manifestTokens := int64(fc.tokenizer.Count(manifest))
+		if shift == 1 {
+			fc.partTokens = append([]int64{int64(fc.tokenizer.Count(fc.partHeader(1, parts+shift))) + manifestTokens}, fc.partTokens...)
+		} else {
+			fc.partTokens[0] += manifestTokens
+		}
+	}
+
+	fc.leadingParts = shift
+	if shift == 1 {
+		if err := os.WriteFile(fc.partFileName(1), []byte(fc.partHeader(1, parts+shift)+manifest), 0644); err != nil {
+			return err
+		}
+	}
+
+	for part := 1; part <= parts; part++ {
+		prefix := fc.partHeader(part+shift, parts+shift)
+		if part == 1 && shift == 0 {
+			prefix += manifest
+		}
+		if err := fc.writePart(part+shift, prefix, fc.bodyFileName(part)); err != nil {
+			return err
+		}
+		os.Remove(fc.bodyFileName(part))
+	}
+	fc.currentPart, fc.leadingParts = parts+shift, 0
+	return nil
+}
+
+// writePart writes a final part file from its prefix and a body file
+func (fc *FileCollator) writePart(part int, prefix, bodyFile string) error {
+	body, err := os.Open(bodyFile)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	out, err := os.Create(fc.partFileName(part))
+	if err != nil {
+		return err
+	}
+	if _, err := out.WriteString(prefix); err != nil {
+		out.Close()
+		return err
+	}
+	if _, err := io.Copy(out, body); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
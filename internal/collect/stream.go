@@ -0,0 +1,232 @@
+package collect
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"github.com/jonathanleahy/folder-bundler/internal/fileutils"
+	"github.com/jonathanleahy/folder-bundler/internal/secrets"
+)
+
+// base64LineLength is the width binary content is wrapped at
+const base64LineLength = 76
+
+var newline = []byte{'\n'}
+
+// streamFile writes a file to a compressed bundle without reading it into
+// memory: one pass over the file finds its size, hash, whether it is text
+// and any secrets in it, and a second copies it through the window. Text is
+// scanned for secrets a window at a time on both passes, so what the second
+// pass writes matches the size and hash the first found.
+func (fc *FileCollator) streamFile(fullPath, normalizedPath string, info os.FileInfo) error {
+	sniffed, err := fc.sniffFile(fullPath, normalizedPath)
+	if err != nil {
+		return err
+	}
+	scan := sniffed.isText && fc.scanner != nil
+	redacted := 0
+	if scan {
+		redacted = fc.reportSecrets(sniffed.findings)
+	}
+
+	mode := fmt.Sprintf("%04o", info.Mode().Perm())
+	if skip, err := fc.unchanged(normalizedPath, BaseEntry{Kind: "file", Size: sniffed.size, Hash: sniffed.hash, Mode: mode}); skip || err != nil {
+		return err
+	}
+
+	fields := fc.fileFields(normalizedPath, info, sniffed.size, sniffed.hash, redacted)
+	fc.fileCount++
+	fc.totalSize += info.Size()
+
+	begin := fmt.Sprintf("--- FILE CONTENT BEGIN (%d bytes) ---\n", sniffed.size)
+	if !sniffed.isText {
+		begin = fmt.Sprintf("--- FILE CONTENT BEGIN (BASE64, %d bytes) ---\n", wrappedBase64Len(sniffed.size))
+	}
+	if err := fc.writeContent(fmt.Sprintf("## File: %s\n\n%s%s", fileutils.QuotePath(normalizedPath), fields, begin)); err != nil {
+		return err
+	}
+
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	written := newDigest()
+	switch {
+	case !sniffed.isText:
+		enc := base64.NewEncoder(base64.StdEncoding, &lineWrapper{w: windowWriter{fc}, width: base64LineLength})
+		_, err = io.Copy(io.MultiWriter(enc, written), file)
+		if err == nil {
+			err = enc.Close()
+		}
+	case scan:
+		// Findings were reported on the first pass
+		stream := fc.scanner.NewStream(normalizedPath, io.MultiWriter(windowWriter{fc}, written),
+			fc.params.SecretsMode == secrets.ModeRedact, fc.windowSize)
+		_, err = io.Copy(stream, file)
+		if err == nil {
+			err = stream.Close()
+		}
+	default:
+		_, err = io.Copy(io.MultiWriter(windowWriter{fc}, written), file)
+	}
+	if err != nil {
+		return err
+	}
+	// The header already went out with the first pass's size and hash
+	if written.n != sniffed.size || written.sum() != sniffed.hash {
+		return fmt.Errorf("%s changed while it was being collected", normalizedPath)
+	}
+
+	if err := fc.writeContent("\n--- FILE CONTENT END ---\n\n"); err != nil {
+		return err
+	}
+	record := fileRecord(normalizedPath, sniffed.size, sniffed.hash)
+	record.firstPart, record.lastPart = fc.currentPart, fc.currentPart
+	fc.manifest = append(fc.manifest, record)
+	return nil
+}
+
+// sniffed is what the first pass over a file finds. For text that is
+// scanned for secrets, size and hash are those of the content as bundled,
+// after any redaction.
+type sniffed struct {
+	size     int64
+	hash     string
+	isText   bool
+	findings []secrets.Finding
+}
+
+// sniffFile reads a file once to find its size, SHA-256, whether
+// fileutils.IsTextFile would call it text and, if secrets are scanned for,
+// the secrets in it
+func (fc *FileCollator) sniffFile(path, normalizedPath string) (sniffed, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return sniffed{}, err
+	}
+	defer file.Close()
+
+	raw := newDigest()
+	sniffer := &textSniffer{}
+	writers := []io.Writer{raw, sniffer}
+	var stream *secrets.Stream
+	scanned := newDigest()
+	if fc.scanner != nil {
+		stream = fc.scanner.NewStream(normalizedPath, scanned, fc.params.SecretsMode == secrets.ModeRedact, fc.windowSize)
+		writers = append(writers, stream)
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), file); err != nil {
+		return sniffed{}, err
+	}
+
+	result := sniffed{size: raw.n, hash: raw.sum(), isText: sniffer.isText()}
+	if stream != nil && result.isText {
+		if err := stream.Close(); err != nil {
+			return sniffed{}, err
+		}
+		result.size, result.hash, result.findings = scanned.n, scanned.sum(), stream.Findings()
+	}
+	return result, nil
+}
+
+// digest counts and hashes what is written to it
+type digest struct {
+	hash hash.Hash
+	n    int64
+}
+
+func newDigest() *digest {
+	return &digest{hash: sha256.New()}
+}
+
+func (d *digest) Write(p []byte) (int, error) {
+	d.n += int64(len(p))
+	return d.hash.Write(p)
+}
+
+func (d *digest) sum() string {
+	return hex.EncodeToString(d.hash.Sum(nil))
+}
+
+// textSniffer checks content as it is written for what IsTextFile checks of
+// the whole: valid UTF-8 and no NUL bytes. A sequence cut short at the end of
+// one write is finished by the next.
+type textSniffer struct {
+	pending []byte
+	binary  bool
+}
+
+func (s *textSniffer) Write(p []byte) (int, error) {
+	if s.binary {
+		return len(p), nil
+	}
+	data := p
+	if len(s.pending) > 0 {
+		data = append(s.pending, p...)
+		s.pending = nil
+	}
+
+	// Hold back a sequence that may continue in the next write
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				s.pending = append([]byte(nil), data[i:]...)
+				data = data[:i]
+			}
+			break
+		}
+	}
+	s.binary = bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data)
+	return len(p), nil
+}
+
+func (s *textSniffer) isText() bool {
+	return !s.binary && len(s.pending) == 0
+}
+
+// lineWrapper breaks what is written into lines of width bytes, as
+// wrapBase64 does: lines are separated by newlines, with none after the last
+type lineWrapper struct {
+	w      io.Writer
+	width  int
+	column int
+}
+
+func (l *lineWrapper) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if l.column == l.width {
+			if _, err := l.w.Write(newline); err != nil {
+				return written, err
+			}
+			l.column = 0
+		}
+		n := min(len(p), l.width-l.column)
+		if _, err := l.w.Write(p[:n]); err != nil {
+			return written, err
+		}
+		p = p[n:]
+		written += n
+		l.column += n
+	}
+	return written, nil
+}
+
+// wrappedBase64Len is the length of size bytes base64 encoded and wrapped
+// by wrapBase64
+func wrappedBase64Len(size int64) int64 {
+	encoded := int64(base64.StdEncoding.EncodedLen(int(size)))
+	if encoded == 0 {
+		return 0
+	}
+	return encoded + (encoded-1)/base64LineLength
+}
@@ -0,0 +1,340 @@
+package collect
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jonathanleahy/folder-bundler/internal/compression"
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+)
+
+// defaultMaxMemory is the memory ceiling for compression when none is set
+const defaultMaxMemory = 256 << 20
+
+// windowShare is the part of the memory ceiling one window may take; the
+// strategies need several times the window they work on
+const windowShare = 16
+
+// minWindow keeps windows from getting too small to compress; an -out-max
+// that can't hold one next to a part's header is rejected
+const minWindow = 256
+
+// frameOverhead is room for the lines around a compressed window
+const frameOverhead = 128
+
+// dictionarySample bounds the content a shared dictionary is built from
+const dictionarySample = 64 << 10
+
+// maxDictionary bounds a shared dictionary, which part 1's header carries
+const maxDictionary = 16 << 10
+
+// widestPart stands in for the widest numbers a compression header can hold
+var widestPart = compressedPart{windows: 99999, originalSize: 1 << 50, compressedSize: 1 << 50}
+
+// windowSizeFor returns the size of the windows the bundle is compressed in:
+// small enough for the memory ceiling, and for a compressed window to fit in
+// a part next to the part's header. A compressed window is never larger than
+// the window, as windows that don't shrink are stored uncompressed.
+func (fc *FileCollator) windowSizeFor() (int, error) {
+	reserved := int64(len(fc.compressionHeader(99999, 99999, widestPart))) + fc.dictionaryReserve() + frameOverhead
+	limit := fc.params.MaxOutputSize - reserved
+	if limit < minWindow {
+		return 0, fmt.Errorf("-out-max %d is too small for compressed parts: the part header takes %d bytes, leaving less than %d for a window",
+			fc.params.MaxOutputSize, reserved, minWindow)
+	}
+	maxMemory := fc.params.MaxMemory
+	if maxMemory <= 0 {
+		maxMemory = defaultMaxMemory
+	}
+	size := max(maxMemory/windowShare, minWindow)
+	return int(min(size, limit)), nil
+}
+
+// dictionaryBudget returns how large a shared dictionary may be: none unless
+// the strategy can share one, and never more than a small part of a part
+func (fc *FileCollator) dictionaryBudget() int {
+	if !fc.selector.SharesDictionary(fc.params.CompressionStrategy) {
+		return 0
+	}
+	return int(min(maxDictionary, fc.params.MaxOutputSize/8))
+}
+
+// dictionaryReserve returns the room the dictionary line of part 1's header
+// may take
+func (fc *FileCollator) dictionaryReserve() int64 {
+	budget := fc.dictionaryBudget()
+	if budget == 0 {
+		return 0
+	}
+	return int64(len("# Dictionary: \n") + base64.StdEncoding.EncodedLen(budget))
+}
+
+// compressedPart tracks what one part of a compressed bundle holds
+type compressedPart struct {
+	windows        int
+	originalSize   int64
+	compressedSize int64
+}
+
+// bufferCompressed adds bundle content to the current window, and compresses
+// and writes every window that is full
+func (fc *FileCollator) bufferCompressed(content string) error {
+	_, err := io.WriteString(windowWriter{fc}, content)
+	return err
+}
+
+// windowWriter adds what is written to the current window no more than the
+// window has room for at a time, compressing and writing each window as it
+// fills, so the window never holds more than one window of content
+type windowWriter struct {
+	fc *FileCollator
+}
+
+func (w windowWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), w.fc.windowSize-w.fc.window.Len())
+		w.fc.window.Write(p[:n])
+		p = p[n:]
+		written += n
+		if w.fc.window.Len() >= w.fc.windowSize {
+			if err := w.fc.flushWindow(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// flushWindow compresses the next window of buffered content and writes it
+// to the current part, starting a new part when it doesn't fit
+func (fc *FileCollator) flushWindow() error {
+	data := fc.window.Next(cutPoint(fc.window.Bytes(), fc.windowSize))
+	frame, result, err := fc.compressWindow(data)
+	if err != nil {
+		return err
+	}
+
+	if fc.partHasEntries && fc.currentSize+int64(len(frame)) > fc.params.MaxOutputSize {
+		fc.currentPart++
+		if err := fc.createNewFile(); err != nil {
+			return err
+		}
+	}
+	if _, err := fc.currentFile.WriteString(frame); err != nil {
+		return err
+	}
+
+	fc.currentSize += int64(len(frame))
+	fc.partHasEntries = true
+	part := &fc.compressedParts[len(fc.compressedParts)-1]
+	part.windows++
+	part.originalSize += int64(len(data))
+	part.compressedSize += int64(len(result.Compressed))
+	return nil
+}
+
+// compressWindow compresses one window and renders it as a frame. The
+// first window is also the sample the shared dictionary is built from.
+func (fc *FileCollator) compressWindow(data []byte) (string, *compression.CompressionResult, error) {
+	if !fc.dictionaryTrained {
+		fc.dictionaryTrained = true
+		if budget := fc.dictionaryBudget(); budget > 0 {
+			fc.dictionary = fc.selector.TrainDictionary(data[:min(len(data), dictionarySample)], fc.params.CompressionStrategy, budget)
+		}
+	}
+	result, err := fc.selector.CompressWindow(data, fc.params.CompressionStrategy)
+	if err != nil {
+		return "", nil, err
+	}
+	fc.windowStrategies[result.Strategy]++
+	fc.originalSize += int64(len(data))
+	fc.compressedSize += int64(len(result.Compressed))
+
+	frame := fmt.Sprintf("## Window: %s\n\n--- WINDOW BEGIN (%d bytes) ---\n%s\n--- WINDOW END ---\n\n",
+		result.Metadata, len(result.Compressed), result.Compressed)
+	return frame, result, nil
+}
+
+// cutPoint returns where to end a window of at most size bytes. Cuts are made
+// after a newline where possible, and never inside a UTF-8 sequence, which
+// gives the text-based strategies whole lines to work on.
+func cutPoint(data []byte, size int) int {
+	if len(data) <= size {
+		return len(data)
+	}
+	cut := size
+	if nl := bytes.LastIndexByte(data[:cut], '\n'); nl >= cut/2 {
+		return nl + 1
+	}
+	for cut > 0 && !utf8.RuneStart(data[cut]) {
+		cut--
+	}
+	if cut == 0 {
+		return size
+	}
+	return cut
+}
+
+// finalizeWithCompression compresses what is left of the bundle and writes
+// the final parts. The part header and manifest are only known now, so they
+// are compressed last and put in front of part 1, or in parts of their own
+// when they don't fit there.
+func (fc *FileCollator) finalizeWithCompression() error {
+	for fc.window.Len() > 0 {
+		if err := fc.flushWindow(); err != nil {
+			return err
+		}
+	}
+	fc.closeCurrentFile()
+
+	// The stream starts with the part header and manifest
+	head := []byte(fc.partHeader(1, 1) + fc.renderManifest(0))
+	var headFrames []string
+	var headParts []compressedPart
+	for len(head) > 0 {
+		data := head[:cutPoint(head, fc.windowSize)]
+		head = head[len(data):]
+		frame, result, err := fc.compressWindow(data)
+		if err != nil {
+			return err
+		}
+		headFrames = append(headFrames, frame)
+		headParts = append(headParts, compressedPart{windows: 1, originalSize: int64(len(data)), compressedSize: int64(len(result.Compressed))})
+	}
+
+	reserved := int64(len(fc.compressionHeader(99999, 99999, widestPart)))
+	body, err := os.Stat(fc.bodyFileName(1))
+	if err != nil {
+		return err
+	}
+	headSize := int64(0)
+	for _, frame := range headFrames {
+		headSize += int64(len(frame))
+	}
+
+	// Group the head frames into the parts that go in front of the body
+	// parts. Part 1 also carries the shared dictionary.
+	dictionary := fc.dictionaryReserve()
+	var leading [][]int
+	if body.Size() > 0 && reserved+dictionary+headSize+body.Size() > fc.params.MaxOutputSize {
+		var size int64
+		for i, frame := range headFrames {
+			if len(leading) == 0 || size+int64(len(frame)) > fc.params.MaxOutputSize {
+				leading = append(leading, nil)
+				size = reserved
+				if len(leading) == 1 {
+					size += dictionary
+				}
+			}
+			leading[len(leading)-1] = append(leading[len(leading)-1], i)
+			size += int64(len(frame))
+		}
+	}
+
+	shift := len(leading)
+	total := fc.currentPart + shift
+	fc.leadingParts = shift
+	var fileNames []string
+	for i, frames := range leading {
+		var part compressedPart
+		var content strings.Builder
+		for _, h := range frames {
+			content.WriteString(headFrames[h])
+			part.add(headParts[h])
+		}
+		if err := os.WriteFile(fc.partFileName(i+1), []byte(fc.compressionHeader(i+1, total, part)+content.String()), 0644); err != nil {
+			return err
+		}
+		fileNames = append(fileNames, fc.partFileName(i+1))
+	}
+
+	for part := 1; part <= fc.currentPart; part++ {
+		stats := fc.compressedParts[part-1]
+		var prefix strings.Builder
+		if part == 1 && shift == 0 {
+			for h, frame := range headFrames {
+				prefix.WriteString(frame)
+				stats.add(headParts[h])
+			}
+		}
+		header := fc.compressionHeader(part+shift, total, stats)
+		if err := fc.writePart(part+shift, header+prefix.String(), fc.bodyFileName(part)); err != nil {
+			return err
+		}
+		os.Remove(fc.bodyFileName(part))
+		fileNames = append(fileNames, fc.partFileName(part+shift))
+	}
+	fc.currentPart, fc.leadingParts = total, 0
+
+	// Show detailed results
+	fmt.Printf("\nCollection complete:\n")
+	fmt.Printf("  Files processed: %d\n", fc.fileCount)
+	fmt.Printf("  Total size: %s\n", formatSize(fc.totalSize))
+
+	if fc.compressedSize < fc.originalSize {
+		fmt.Printf("  Compression: %s\n", fc.strategySummary())
+		if fc.dictionary != nil {
+			fmt.Printf("  Shared dictionary: %s\n", formatSize(int64(len(fc.dictionary))))
+		}
+		fmt.Printf("  Original output size: %s\n", formatSize(fc.originalSize))
+		fmt.Printf("  Compressed size: %s\n", formatSize(fc.compressedSize))
+		fmt.Printf("  Space saved: %s (%.1f%% reduction)\n",
+			formatSize(fc.originalSize-fc.compressedSize),
+			(1-float64(fc.compressedSize)/float64(fc.originalSize))*100)
+	} else {
+		fmt.Printf("  Compression: %s (not applied - no benefit)\n", fc.params.CompressionStrategy)
+		fmt.Printf("  Output size: %s\n", formatSize(fc.originalSize))
+	}
+
+	if len(fileNames) == 1 {
+		fmt.Printf("  Output file: %s\n", fileNames[0])
+	} else {
+		fmt.Printf("  Output files: %s_part1.fb .. %s_part%d.fb (%d parts)\n", fc.baseFileName, fc.baseFileName, len(fileNames), len(fileNames))
+	}
+
+	return nil
+}
+
+func (p *compressedPart) add(other compressedPart) {
+	p.windows += other.windows
+	p.originalSize += other.originalSize
+	p.compressedSize += other.compressedSize
+}
+
+// strategySummary lists the strategies used and how many windows each compressed
+func (fc *FileCollator) strategySummary() string {
+	var names []string
+	for name := range fc.windowStrategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var used []string
+	for _, name := range names {
+		used = append(used, fmt.Sprintf("%s (%d window(s))", name, fc.windowStrategies[name]))
+	}
+	return strings.Join(used, ", ")
+}
+
+// compressionHeader describes a part of a compressed bundle: the strategy
+// asked for, and the windows the part holds. Part 1 also records the shared
+// dictionary, in base64, as it is read before any window.
+func (fc *FileCollator) compressionHeader(part, totalParts int, stats compressedPart) string {
+	ratio := 1.0
+	if stats.originalSize > 0 {
+		ratio = float64(stats.compressedSize) / float64(stats.originalSize)
+	}
+	dictionary := ""
+	if part == 1 && fc.dictionary != nil {
+		dictionary = fmt.Sprintf("# Dictionary: %s\n", base64.StdEncoding.EncodeToString(fc.dictionary))
+	}
+	return config.FormatLine() + fmt.Sprintf("# Compression: %s\n# Windows: %d\n# Original Size: %d bytes\n# Compressed Size: %d bytes\n# Ratio: %.2f%%\n# Bundle ID: %s\n# Part: %d of %d\n%s\n",
+		fc.params.CompressionStrategy, stats.windows, stats.originalSize, stats.compressedSize, ratio*100, fc.bundleID, part, totalParts, dictionary)
+}
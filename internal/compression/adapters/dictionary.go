@@ -167,6 +167,9 @@ func (d *DictionaryCompression) EstimateRatio(content []byte) float64 {
 
 // Decompress restores original content from dictionary-compressed data
 func (d *DictionaryCompression) Decompress(compressed []byte, metadata string) ([]byte, error) {
+	if strings.HasPrefix(metadata, sharedDictionaryPrefix) {
+		return nil, fmt.Errorf("content was compressed against a shared dictionary that was not provided")
+	}
 	text := string(compressed)
 	
 	// Extract dictionary
@@ -183,7 +186,15 @@ func (d *DictionaryCompression) Decompress(compressed []byte, metadata string) (
 	dictContent := text[dictStart:dictEnd]
 	content := text[dictEnd+len("--- END DICTIONARY ---\n"):]
 	
-	// Parse dictionary
+	dictionary, err := parseDictionary(dictContent)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(d.expand(content, dictionary)), nil
+}
+
+// parseDictionary reads the ref=pattern lines of a dictionary
+func parseDictionary(dictContent string) (map[string]string, error) {
 	dictionary := make(map[string]string)
 	for _, line := range strings.Split(dictContent, "\n") {
 		if line == "" {
@@ -195,7 +206,11 @@ func (d *DictionaryCompression) Decompress(compressed []byte, metadata string) (
 		}
 		dictionary[parts[0]] = parts[1]
 	}
-	
+	return dictionary, nil
+}
+
+// expand replaces the references in content with the text they stand for
+func (d *DictionaryCompression) expand(content string, dictionary map[string]string) string {
 	// Unescape references
 	content = d.unescapeReferences(content)
 	
@@ -212,13 +227,88 @@ func (d *DictionaryCompression) Decompress(compressed []byte, metadata string) (
 	for _, ref := range refs {
 		content = strings.ReplaceAll(content, ref, dictionary[ref])
 	}
-	
-	return []byte(content), nil
+	return content
 }
 
 // CanDecompress checks if metadata indicates dictionary compression
 func (d *DictionaryCompression) CanDecompress(metadata string) bool {
-	return strings.HasPrefix(metadata, "dictionary:")
+	return strings.HasPrefix(metadata, "dictionary:") || strings.HasPrefix(metadata, sharedDictionaryPrefix)
+}
+
+// sharedDictionaryPrefix starts the metadata of content compressed against a
+// shared dictionary, which the content doesn't carry
+const sharedDictionaryPrefix = "shared-dictionary:"
+
+// Train builds a dictionary from a sample of the content, holding the
+// patterns that save the most first, up to maxSize bytes
+func (d *DictionaryCompression) Train(sample []byte, maxSize int) []byte {
+	var dictBuilder strings.Builder
+	entryNum := 1
+	for _, p := range d.findPatterns(string(sample)) {
+		ref := fmt.Sprintf("«%d»", entryNum)
+		dictEntry := fmt.Sprintf("%s=%s\n", ref, p.text)
+		if len(p.text)*p.occurrences <= len(dictEntry)+len(ref)*p.occurrences {
+			continue
+		}
+		if dictBuilder.Len()+len(dictEntry) > maxSize {
+			break
+		}
+		dictBuilder.WriteString(dictEntry)
+		entryNum++
+	}
+	return []byte(dictBuilder.String())
+}
+
+// CompressWithDictionary replaces the patterns of a trained dictionary in
+// content. Only the references are written; the dictionary is stored once
+// for all windows.
+func (d *DictionaryCompression) CompressWithDictionary(content, dictionary []byte) ([]byte, string, error) {
+	entries, err := parseDictionary(string(dictionary))
+	if err != nil {
+		return nil, "", err
+	}
+	var refs []string
+	for ref := range entries {
+		refs = append(refs, ref)
+	}
+	// Patterns are replaced in dictionary order, the most valuable first
+	sort.Slice(refs, func(i, j int) bool {
+		return refNumber(refs[i]) < refNumber(refs[j])
+	})
+
+	compressed := string(content)
+	used := 0
+	for _, ref := range refs {
+		if strings.Contains(compressed, entries[ref]) {
+			compressed = strings.ReplaceAll(compressed, entries[ref], ref)
+			used++
+		}
+	}
+	if used == 0 {
+		return content, "dictionary:0", nil
+	}
+	compressed = d.escapeReferences(compressed, entries)
+	return []byte(compressed), fmt.Sprintf("%s%d", sharedDictionaryPrefix, used), nil
+}
+
+// DecompressWithDictionary restores content compressed against a trained
+// dictionary, or with a dictionary of its own
+func (d *DictionaryCompression) DecompressWithDictionary(compressed []byte, metadata string, dictionary []byte) ([]byte, error) {
+	if !strings.HasPrefix(metadata, sharedDictionaryPrefix) {
+		return d.Decompress(compressed, metadata)
+	}
+	entries, err := parseDictionary(string(dictionary))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(d.expand(string(compressed), entries)), nil
+}
+
+// refNumber returns the number of a «N» reference
+func refNumber(ref string) int {
+	var n int
+	fmt.Sscanf(strings.TrimSuffix(strings.TrimPrefix(ref, "«"), "»"), "%d", &n)
+	return n
 }
 
 // findPatterns finds repeated patterns in text
@@ -1,11 +1,26 @@
 package compression
 
 import (
+	"sync"
+
 	"github.com/jonathanleahy/folder-bundler/internal/compression/adapters"
 )
 
-// InitializeStrategies registers all available compression strategies
+var (
+	initOnce sync.Once
+	initErr  error
+)
+
+// InitializeStrategies registers all available compression strategies. It
+// can be called any number of times; strategies are registered once.
 func InitializeStrategies() error {
+	initOnce.Do(func() {
+		initErr = registerStrategies()
+	})
+	return initErr
+}
+
+func registerStrategies() error {
 	// Register none (passthrough) strategy
 	if err := DefaultRegistry.Register(adapters.NewNoneCompression()); err != nil {
 		return err
@@ -35,4 +50,4 @@ func InitializeStrategies() error {
 	// - Run-length encoding
 	
 	return nil
-}
\ No newline at end of file
+}
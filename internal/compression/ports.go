@@ -4,14 +4,14 @@ package compression
 type Compressor interface {
 	// Name returns the name of this compression strategy
 	Name() string
-	
+
 	// Compress attempts to compress the content
 	// Returns compressed content, metadata needed for decompression, and any error
 	Compress(content []byte) (compressed []byte, metadata string, err error)
-	
+
 	// CanCompress checks if this strategy can compress the given content
 	CanCompress(content []byte) bool
-	
+
 	// EstimateRatio estimates the compression ratio (compressed/original)
 	// Returns value between 0 and 1, where lower is better compression
 	EstimateRatio(content []byte) float64
@@ -21,7 +21,7 @@ type Compressor interface {
 type Decompressor interface {
 	// Decompress restores the original content using the compressed data and metadata
 	Decompress(compressed []byte, metadata string) ([]byte, error)
-	
+
 	// CanDecompress checks if this strategy can decompress based on metadata
 	CanDecompress(metadata string) bool
 }
@@ -38,4 +38,18 @@ type CompressionResult struct {
 	Compressed []byte
 	Metadata   string
 	Ratio      float64
-}
\ No newline at end of file
+}
+
+// DictionaryTrainer is implemented by strategies that can build a dictionary
+// once, from a bounded sample of the content, and compress every window of a
+// bundle against it instead of carrying a dictionary in each window
+type DictionaryTrainer interface {
+	// Train builds a dictionary of at most maxSize bytes from sample
+	Train(sample []byte, maxSize int) []byte
+
+	// CompressWithDictionary compresses content against a trained dictionary
+	CompressWithDictionary(content, dictionary []byte) (compressed []byte, metadata string, err error)
+
+	// DecompressWithDictionary restores content compressed against dictionary
+	DecompressWithDictionary(compressed []byte, metadata string, dictionary []byte) ([]byte, error)
+}
@@ -1,12 +1,16 @@
 package compression
 
 import (
+	"bytes"
 	"fmt"
+	"sort"
 )
 
 // Selector helps choose the best compression strategy for content
 type Selector struct {
 	registry *Registry
+	// Dictionary shared by every window, for strategies that train one
+	dictionary []byte
 }
 
 // NewSelector creates a new compression selector
@@ -62,14 +66,115 @@ func (s *Selector) CompressContentWithStrategy(content []byte, strategyName stri
 		return nil, fmt.Errorf("no compression strategy selected (available: %v, requested: %s)", available, strategyName)
 	}
 	
-	// Compress with selected strategy
-	compressed, metadata, err := strategy.Compress(content)
+	result, exact, err := s.compressWith(strategy, content)
 	if err != nil {
-		return nil, fmt.Errorf("compression failed: %w", err)
+		return nil, err
+	}
+	if !exact {
+		fmt.Printf("  %s compression does not restore this content exactly; storing it uncompressed\n", strategy.Name())
+	}
+	return result, nil
+}
+
+// CompressWindow compresses one window of a bundle that is compressed window
+// by window. With "auto" the strategy is picked for each window. Nothing is
+// printed, as a bundle can have many windows.
+func (s *Selector) CompressWindow(content []byte, strategyName string) (*CompressionResult, error) {
+	var strategy CompressionStrategy
+	if strategyName == "auto" {
+		strategy, _ = s.registry.SelectBest(content)
+	} else {
+		var err error
+		if strategy, err = s.registry.Get(strategyName); err != nil {
+			return nil, fmt.Errorf("strategy '%s' not available. Available strategies: %v", strategyName, s.registry.List())
+		}
+	}
+	if strategy == nil {
+		var err error
+		if strategy, err = s.registry.Get("none"); err != nil {
+			return nil, fmt.Errorf("no compression strategies available: %w", err)
+		}
+	}
+
+	result, _, err := s.compressWith(strategy, content)
+	return result, err
+}
+
+// TrainDictionary builds a dictionary of at most maxSize bytes from a
+// bounded sample of the content, when the strategy (or, with "auto", one of
+// the strategies) can share one across windows. Windows compressed
+// afterwards use it. It returns the dictionary, or nil if none was built.
+func (s *Selector) TrainDictionary(sample []byte, strategyName string, maxSize int) []byte {
+	trainer := s.dictionaryTrainer(strategyName)
+	if trainer == nil {
+		return nil
+	}
+	if dictionary := trainer.Train(sample, maxSize); len(dictionary) > 0 {
+		s.dictionary = dictionary
+	}
+	return s.dictionary
+}
+
+// SharesDictionary reports whether windows compressed with the strategy may
+// use a dictionary built by TrainDictionary
+func (s *Selector) SharesDictionary(strategyName string) bool {
+	return s.dictionaryTrainer(strategyName) != nil
+}
+
+// SetDictionary sets the dictionary windows were compressed against, for
+// decompressing them
+func (s *Selector) SetDictionary(dictionary []byte) {
+	s.dictionary = dictionary
+}
+
+func (s *Selector) dictionaryTrainer(strategyName string) DictionaryTrainer {
+	names := []string{strategyName}
+	if strategyName == "auto" {
+		names = s.registry.List()
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		if strategy, err := s.registry.Get(name); err == nil {
+			if trainer, ok := strategy.(DictionaryTrainer); ok {
+				return trainer
+			}
+		}
+	}
+	return nil
+}
+
+// compressWith compresses content with a strategy, and stores it uncompressed
+// instead when that is smaller or the strategy can't restore it exactly. It
+// reports false when the strategy was dropped for not restoring the content.
+func (s *Selector) compressWith(strategy CompressionStrategy, content []byte) (*CompressionResult, bool, error) {
+	exact := true
+	var compressed []byte
+	var metadata string
+	var err error
+	if trainer, ok := strategy.(DictionaryTrainer); ok && s.dictionary != nil {
+		compressed, metadata, err = trainer.CompressWithDictionary(content, s.dictionary)
+	} else {
+		compressed, metadata, err = strategy.Compress(content)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("compression failed: %w", err)
 	}
 	
 	// Calculate actual ratio
-	actualRatio := float64(len(compressed)) / float64(len(content))
+	actualRatio := 1.0
+	if len(content) > 0 {
+		actualRatio = float64(len(compressed)) / float64(len(content))
+	}
+	
+	// Bundles frame content by its exact length, so a strategy that can't
+	// reproduce the content byte for byte must not be used
+	if strategy.Name() != "none" && actualRatio < 1.0 {
+		restored, err := s.DecompressContent(compressed, metadata)
+		if err != nil || !bytes.Equal(restored, content) {
+			exact = false
+			actualRatio = 1.0
+		}
+	}
 	
 	// If compression made it larger, use none strategy
 	if actualRatio >= 1.0 && strategy.Name() != "none" {
@@ -87,7 +192,7 @@ func (s *Selector) CompressContentWithStrategy(content []byte, strategyName stri
 		Compressed: compressed,
 		Metadata:   metadata,
 		Ratio:      actualRatio,
-	}, nil
+	}, exact, nil
 }
 
 // DecompressContent decompresses content using the appropriate strategy
@@ -102,6 +207,9 @@ func (s *Selector) DecompressContent(compressed []byte, metadata string) ([]byte
 		}
 		
 		if strategy.CanDecompress(metadata) {
+			if trainer, ok := strategy.(DictionaryTrainer); ok && s.dictionary != nil {
+				return trainer.DecompressWithDictionary(compressed, metadata, s.dictionary)
+			}
 			return strategy.Decompress(compressed, metadata)
 		}
 	}
@@ -0,0 +1,49 @@
+package config
+
+import "strings"
+
+// CollectValueFlags are the flags of collect that take a value, so the
+// argument after them is not mistaken for the path
+var CollectValueFlags = map[string]bool{
+	"-compress": true, "-skip-dirs": true, "-skip-files": true, "-skip-ext": true,
+	"-max": true, "-out-max": true, "-mem-max": true, "-max-tokens": true, "-tokenizer-vocab": true, "-include": true, "-exclude": true, "-profile": true,
+	"-secrets": true, "-secret-pattern": true, "-secrets-report": true, "-since": true,
+	"-git": true, "-git-diff": true, "-git-context": true,
+}
+
+// ReconstructValueFlags are the value flags of reconstruct and the commands
+// that read bundles
+var ReconstructValueFlags = map[string]bool{
+	"-profile": true, "-umask": true, "-o": true, "-on-conflict": true, "-base": true,
+}
+
+// DiffValueFlags are the value flags of diff: those of both collect and
+// reconstruct, as either side may be a directory or a bundle
+var DiffValueFlags = func() map[string]bool {
+	flags := make(map[string]bool)
+	for f := range CollectValueFlags {
+		flags[f] = true
+	}
+	for f := range ReconstructValueFlags {
+		flags[f] = true
+	}
+	return flags
+}()
+
+// SplitArgs separates a subcommand's flags from its paths, so flags may come
+// after the paths. Value flags always take the next argument, which may
+// itself start with a dash.
+func SplitArgs(args []string, valueFlags map[string]bool) (flags, paths []string) {
+	for i := 0; i < len(args); i++ {
+		if strings.HasPrefix(args[i], "-") {
+			flags = append(flags, args[i])
+			if valueFlags[args[i]] && i+1 < len(args) {
+				i++
+				flags = append(flags, args[i])
+			}
+		} else {
+			paths = append(paths, args[i])
+		}
+	}
+	return flags, paths
+}
@@ -0,0 +1,24 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	flags, paths := SplitArgs([]string{"bundle.fb", "-o", "-out", "-json", "*.go", "-umask", "022"}, ReconstructValueFlags)
+	if got, want := strings.Join(flags, " "), "-o -out -json -umask 022"; got != want {
+		t.Errorf("flags: got %q, want %q", got, want)
+	}
+	if got, want := strings.Join(paths, " "), "bundle.fb *.go"; got != want {
+		t.Errorf("paths: got %q, want %q", got, want)
+	}
+
+	// A flag of the other subcommand doesn't take a value here
+	if _, paths := SplitArgs([]string{"-max", "dir"}, ReconstructValueFlags); len(paths) != 1 {
+		t.Errorf("-max took dir as its value for reconstruct: %v", paths)
+	}
+	if _, paths := SplitArgs([]string{"-max", "10", "dir", "bundle.fb", "-o", "x"}, DiffValueFlags); strings.Join(paths, " ") != "dir bundle.fb" {
+		t.Errorf("diff paths: got %v", paths)
+	}
+}
@@ -0,0 +1,221 @@
+package config
+
+import (
+	_ "embed"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectConfigNames are the file names looked up in the root being collected
+var ProjectConfigNames = []string{".folder-bundler.yaml", ".folder-bundler.yml"}
+
+// EnvPrefix is prepended to upper-cased flag names to form environment
+// variable names, e.g. FOLDER_BUNDLER_OUT_MAX for -out-max
+const EnvPrefix = "FOLDER_BUNDLER_"
+
+//go:embed defaults.yaml
+var builtinDefaults []byte
+
+// settingsLayer is one source of settings, keyed by flag name
+type settingsLayer struct {
+	source   string
+	settings map[string]interface{}
+}
+
+// configFile is the on-disk layout of a user or project config file
+type configFile struct {
+	settings map[string]interface{}
+	profiles map[string]map[string]interface{}
+}
+
+// UserConfigPath returns the location of the per-user config file
+func UserConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "folder-bundler", "config.yaml")
+}
+
+// loadConfigFile reads a config file, returning nil if it does not exist
+func loadConfigFile(path string) (*configFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return parseConfigFile(data, path)
+}
+
+func parseConfigFile(data []byte, source string) (*configFile, error) {
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", source, err)
+	}
+
+	cfg := &configFile{
+		settings: make(map[string]interface{}),
+		profiles: make(map[string]map[string]interface{}),
+	}
+	for key, value := range raw {
+		if key != "profiles" {
+			cfg.settings[key] = value
+			continue
+		}
+
+		profiles, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("error parsing %s: 'profiles' must be a map of profile names to settings", source)
+		}
+		for name, profile := range profiles {
+			settings, ok := profile.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("error parsing %s: profile '%s' must be a map of settings", source, name)
+			}
+			cfg.profiles[name] = settings
+		}
+	}
+	return cfg, nil
+}
+
+// configLayers collects the settings layers in increasing precedence:
+// built-in defaults, user config, project config, the selected profile from
+// each of them and environment variables. Command line flags are applied on
+// top by flag.Parse.
+func configLayers(root, profile string) ([]settingsLayer, []string, error) {
+	defaults, err := parseConfigFile(builtinDefaults, "built-in defaults")
+	if err != nil {
+		return nil, nil, err
+	}
+	layers := []settingsLayer{{source: "built-in defaults", settings: defaults.settings}}
+
+	var loaded []string
+	var profiles []settingsLayer
+	for _, path := range []string{UserConfigPath(), findProjectConfig(root)} {
+		if path == "" {
+			continue
+		}
+		cfg, err := loadConfigFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if cfg == nil {
+			continue
+		}
+
+		loaded = append(loaded, path)
+		layers = append(layers, settingsLayer{source: path, settings: cfg.settings})
+		if settings, ok := cfg.profiles[profile]; ok && profile != "" {
+			profiles = append(profiles, settingsLayer{source: fmt.Sprintf("%s (profile %s)", path, profile), settings: settings})
+		}
+	}
+
+	if profile != "" && len(profiles) == 0 {
+		return nil, nil, fmt.Errorf("profile '%s' not found in any config file", profile)
+	}
+
+	// A chosen profile beats the unprofiled settings of every file
+	layers = append(layers, profiles...)
+	layers = append(layers, envLayer())
+	return layers, loaded, nil
+}
+
+// findProjectConfig returns the first project config file present in root
+func findProjectConfig(root string) string {
+	for _, name := range ProjectConfigNames {
+		path := filepath.Join(root, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// envLayer reads FOLDER_BUNDLER_* variables for every registered flag
+func envLayer() settingsLayer {
+	settings := make(map[string]interface{})
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Name == "profile" {
+			return
+		}
+		if value, ok := os.LookupEnv(envName(f.Name)); ok {
+			settings[f.Name] = value
+		}
+	})
+	return settingsLayer{source: "environment", settings: settings}
+}
+
+func envName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyLayer sets flags from a settings layer. Lists are joined with commas,
+// except for repeatable flags which receive one Set call per element.
+func applyLayer(layer settingsLayer) ([]string, error) {
+	keys := make([]string, 0, len(layer.settings))
+	for key := range layer.settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		f := flag.Lookup(key)
+		if f == nil || key == "profile" {
+			return nil, fmt.Errorf("unknown setting '%s' in %s", key, layer.source)
+		}
+
+		var values []string
+		switch v := layer.settings[key].(type) {
+		case []interface{}:
+			for _, item := range v {
+				values = append(values, fmt.Sprint(item))
+			}
+			if _, ok := f.Value.(repeatable); !ok {
+				values = []string{strings.Join(values, ",")}
+			}
+		case nil:
+			values = []string{""}
+		default:
+			values = []string{fmt.Sprint(v)}
+		}
+
+		for _, value := range values {
+			if err := f.Value.Set(value); err != nil {
+				return nil, fmt.Errorf("invalid value for '%s' in %s: %v", key, layer.source, err)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// repeatable is implemented by flags that may be given more than once
+type repeatable interface {
+	repeatable()
+}
+
+// profileFromArgs finds -profile before the flags are parsed, since the
+// profile decides which config values the flags start from
+func profileFromArgs(args []string) string {
+	profile := os.Getenv(envName("profile"))
+	for i := 0; i < len(args); i++ {
+		arg := strings.TrimPrefix(strings.TrimPrefix(args[i], "-"), "-")
+		if arg == args[i] {
+			continue
+		}
+		if value, ok := strings.CutPrefix(arg, "profile="); ok {
+			profile = value
+		} else if arg == "profile" && i+1 < len(args) {
+			profile = args[i+1]
+			i++
+		}
+	}
+	return profile
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigLayers_Precedence(t *testing.T) {
+	userDir := t.TempDir()
+	projectDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", userDir)
+	t.Setenv("HOME", userDir)
+
+	os.MkdirAll(filepath.Join(userDir, "folder-bundler"), 0755)
+	os.WriteFile(filepath.Join(userDir, "folder-bundler", "config.yaml"),
+		[]byte("max: 1M\nprofiles:\n  llm-review:\n    out-max: 500K\n"), 0644)
+	os.WriteFile(filepath.Join(projectDir, ".folder-bundler.yaml"),
+		[]byte("max: 5M\nprofiles:\n  llm-review:\n    compress: auto\n"), 0644)
+
+	layers, loaded, err := configLayers(projectDir, "llm-review")
+	if err != nil {
+		t.Fatalf("configLayers failed: %v", err)
+	}
+	if len(loaded) != 2 {
+		t.Fatalf("Expected user and project config to load, got %v", loaded)
+	}
+
+	// defaults, user, project, user profile, project profile, environment
+	if len(layers) != 6 {
+		t.Fatalf("Expected 6 layers, got %d", len(layers))
+	}
+	if layers[1].settings["max"] != "1M" || layers[2].settings["max"] != "5M" {
+		t.Errorf("Expected project config to come after user config")
+	}
+	if layers[3].settings["out-max"] != "500K" || layers[4].settings["compress"] != "auto" {
+		t.Errorf("Expected the profiles to follow both files, user first")
+	}
+}
+
+func TestConfigLayers_ProfileBeatsProjectDefaults(t *testing.T) {
+	userDir := t.TempDir()
+	projectDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", userDir)
+	t.Setenv("HOME", userDir)
+
+	os.MkdirAll(filepath.Join(userDir, "folder-bundler"), 0755)
+	os.WriteFile(filepath.Join(userDir, "folder-bundler", "config.yaml"),
+		[]byte("profiles:\n  llm-review:\n    out-max: 500K\n"), 0644)
+	os.WriteFile(filepath.Join(projectDir, ".folder-bundler.yaml"),
+		[]byte("out-max: 5M\n"), 0644)
+
+	layers, _, err := configLayers(projectDir, "llm-review")
+	if err != nil {
+		t.Fatalf("configLayers failed: %v", err)
+	}
+	var outMax interface{}
+	for _, layer := range layers {
+		if value, ok := layer.settings["out-max"]; ok {
+			outMax = value
+		}
+	}
+	if outMax != "500K" {
+		t.Errorf("Expected the user profile to beat the project default, got out-max %v", outMax)
+	}
+}
+
+func TestConfigLayers_UnknownProfile(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	if _, _, err := configLayers(t.TempDir(), "missing"); err == nil {
+		t.Errorf("Expected error for unknown profile")
+	}
+}
+
+func TestProfileFromArgs(t *testing.T) {
+	t.Setenv("FOLDER_BUNDLER_PROFILE", "from-env")
+
+	if got := profileFromArgs([]string{"-max", "1M"}); got != "from-env" {
+		t.Errorf("Expected environment profile, got %q", got)
+	}
+	if got := profileFromArgs([]string{"-profile", "ci", "."}); got != "ci" {
+		t.Errorf("Expected -profile value, got %q", got)
+	}
+	if got := profileFromArgs([]string{"--profile=review"}); got != "review" {
+		t.Errorf("Expected --profile= value, got %q", got)
+	}
+}
@@ -0,0 +1,18 @@
+package config
+
+import "fmt"
+
+// Version is the folder-bundler release
+const Version = "4.0"
+
+// FormatVersion is the bundle format written by collect. Bundles written by
+// v3.0 to v3.3 have no format line and are read as format 3.
+const FormatVersion = 4
+
+// FormatLinePrefix starts the first line of every part of a bundle
+const FormatLinePrefix = "# folder-bundle format: "
+
+// FormatLine returns the version line written at the top of every part
+func FormatLine() string {
+	return fmt.Sprintf("%s%d\n", FormatLinePrefix, FormatVersion)
+}
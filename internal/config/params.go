@@ -3,101 +3,383 @@ package config
 import (
 	"flag"
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
+
+	"github.com/jonathanleahy/folder-bundler/internal/rules"
+	"github.com/jonathanleahy/folder-bundler/internal/secrets"
 )
 
+// MinOutputSize is the smallest -out-max: enough for a part header, the
+// header of a chunk and some of its content
+const MinOutputSize = 1024
+
 type Parameters struct {
 	MaxFileSize       int64
 	MaxOutputSize     int64
-	ExcludedDirs      map[string]bool
-	ExcludedFiles     map[string]bool
-	ExcludedExts      map[string]bool
+	Rules             *rules.Set
 	IncludeHidden     bool
 	SkipGitignore     bool
 	PreserveTimestamp bool
 	SkipSymlinks      bool
-	RootDir           string
+	// Destination of reconstruct instead of the bundle's root directory, and
+	// whether entries may write outside it
+	OutputDir   string
+	AllowUnsafe bool
+	// Whether reconstruct keeps and continues from an interrupted run
+	Resume bool
+	// What reconstruct does with files that differ from ones already there
+	OnConflict string
+	// Bundle an incremental collect is made against, and the base bundle
+	// reconstruct starts from before applying an incremental one
+	Since string
+	Base  string
+	// Collect only the files git tracks, or those a revision range changed,
+	// with the range's diff at this many lines of context (-1 for none)
+	Git        string
+	GitDiff    string
+	GitContext int
+	// Output of list and diff: one line of metadata per entry, or JSON
+	ListLong   bool
+	JSONOutput bool
+	// Show modified text files as unified diffs
+	DiffPatch bool
+	// Write extracted files to standard output instead of a directory
+	ExtractStdout bool
+	// Permission bits cleared from restored modes, and whether to record and
+	// restore file owners
+	Umask         os.FileMode
+	PreserveOwner bool
+	RootDir       string
+	// Root directory recorded in the bundle and prefix of the part files,
+	// when they shouldn't be derived from RootDir (used by upgrade)
+	RootLabel  string
+	OutputBase string
+	// Files an earlier collection skipped for their size, by slash-separated
+	// path, which collect records as skipped again (used by upgrade)
+	Skipped map[string]SkippedFile
+	// Config files that contributed settings, and the selected profile
+	ConfigFiles []string
+	Profile     string
 	// Compression settings
 	CompressionStrategy string
 	EnableCompression   bool
+	// Memory ceiling for compression windows
+	MaxMemory int64
+	// Token budget settings
+	MaxTokens      int64
+	TokenizerVocab string
+	// Secret scanning settings
+	SecretsMode    string
+	SecretPatterns []string
+	SecretsReport  string
+}
+
+// SkippedFile is what a bundle recorded for a file too big to be collected
+type SkippedFile struct {
+	Size    int64
+	MaxSize int64
 }
 
 func PrintUsage() {
-	fmt.Printf(`Folder Bundler v3.3
+	fmt.Printf(`Folder Bundler v%s
 
 Usage: bundler <command> [flags] [path]
 
 Commands:
   collect     Create directory structure summary
   reconstruct Build from summary file
+  upgrade     Rewrite an older bundle in the current format
+  verify      Check a bundle without writing any files
+  list        Show the files in a bundle
+  extract     Reconstruct only some of the files in a bundle
+  diff        Compare two bundles, or a bundle and a directory
 
 Flags:
   -max          Maximum file size (default: 2M, accepts: 500K, 1M, 2G, etc.)
-  -out-max      Maximum output file size (default: 2M)
-  -skip-dirs    Skip directories (default: node_modules,.git,...)
+  -out-max      Maximum output file size (default: 2M, at least 1K)
+  -max-tokens   Maximum estimated tokens per output file (e.g. 100K, default: no limit)
+  -tokenizer-vocab Tokenizer vocab file for -max-tokens (.tiktoken, .json or one token per line)
+  -skip-dirs    Skip directories, even where -include matches (default: node_modules,.git,...)
   -skip-files   Skip files (default: .DS_Store,.env,...)
   -skip-ext     Skip extensions (default: .exe,.dll,...)
+  -include      Include paths matching a glob (repeatable, e.g. "src/**")
+  -exclude      Exclude paths matching a glob (repeatable, e.g. "**/*_test.go")
   -hidden       Include hidden files (default: false)
-  -no-gitignore Skip .gitignore (default: false)
+  -no-gitignore Don't apply .gitignore rules (default: false)
   -time         Preserve timestamps (default: true)
+  -owner        Record file owners (uid/gid) for reconstruct -owner
   -compress     Compression: none|auto|dictionary|template|delta|template+delta (default: none)
+  -mem-max      Memory ceiling for compression (default: 256M)
+  -profile      Use a named profile from the config files
+  -secrets      Secret scanning: off|warn|redact|fail (default: warn)
+  -secret-pattern Extra regex to treat as a secret (repeatable)
+  -secrets-report Report file for detected secrets (default: <name>_collated_secrets.txt)
+  -since        Collect only what changed since a previous bundle (any of its
+                parts), as <name>_incremental_part*.fb
+  -git          Collect only the files git tracks: tracked
+  -git-diff     Collect only the files changed in a revision range (e.g. main..HEAD)
+  -git-context  With -git-diff, add the range's diff with N lines of context
+
+Config files:
+  Settings are read from the user config (%s)
+  and from .folder-bundler.yaml in the collected directory. Keys are flag
+  names without the dash; FOLDER_BUNDLER_<FLAG> environment variables and
+  command line flags take precedence over both.
 
 Examples:
   bundler collect myproject
   bundler collect -compress auto myproject
   bundler collect -compress dictionary -max 5M myproject
   bundler collect myproject -max 1G -out-max 10M
+  bundler collect -exclude "docs/generated/**" -include "docs/generated/index.md" myproject
+  bundler collect -profile llm-review myproject
+  bundler collect -max-tokens 150K myproject
+  bundler collect -since myproject_collated_part1.fb myproject
+  bundler collect -git-diff main..HEAD -git-context 3 myproject
   bundler reconstruct myproject_collated_part1.fb
-`)
+`, Version, UserConfigPath())
 }
 
 func PrintReconstructHelp() {
-	fmt.Printf(`Folder Bundler v3.3
+	fmt.Printf(`Folder Bundler v%s
 
 Usage: bundler reconstruct [flags] <input_file>
 
 Flags:
   -time          Preserve timestamps (default: true)
+  -o             Directory to reconstruct into (default: the bundle's root directory)
   -skip-symlinks Skip creating symbolic links (default: false)
+  -allow-unsafe  Reconstruct entries with absolute paths, ".." or symlinks
+                 that point outside the destination (default: false)
+  -resume        Keep the progress of a failed or interrupted run, and
+                 continue from it (default: false)
+  -on-conflict   Existing files that differ from the bundle:
+                 overwrite|skip|backup|newer|fail (default: overwrite)
+  -base          For an incremental bundle, the base bundle to reconstruct
+                 first (default: apply it to the existing destination)
+  -umask         Permission bits to clear from restored modes (e.g. 022, default: none)
+  -owner         Restore recorded file owners (requires root)
+  -profile       Use a named profile from the config files
 
 Example:
   bundler reconstruct myproject_collated_part1.fb
   bundler reconstruct -skip-symlinks myproject_collated_part1.fb
-`)
+  bundler reconstruct -o restored myproject_collated_part1.fb
+`, Version)
+}
+
+func PrintVerifyHelp() {
+	fmt.Printf(`Folder Bundler v%s
+
+Usage: bundler verify [flags] <input_file>
+
+Checks that every part of a bundle is present and that every file decodes to
+its recorded size and SHA-256, without writing anything. Exits with status 1
+if any entry fails.
+
+Flags:
+  -skip-symlinks Don't check symbolic links, as reconstruct -skip-symlinks
+  -allow-unsafe  Don't fail entries that would write outside the destination
+  -profile       Use a named profile from the config files
+
+Example:
+  bundler verify myproject_collated_part1.fb
+`, Version)
+}
+
+func PrintListHelp() {
+	fmt.Printf(`Folder Bundler v%s
+
+Usage: bundler list [flags] <input_file> [pattern...]
+
+Prints the directories, files and symlinks in a bundle as a tree. Patterns
+are paths or globs such as "src/**" or "**/*.go"; only matching entries, and
+everything below a matching directory, are listed, as extract selects them.
+
+Flags:
+  -long          One line per entry: mode, size, modification time, parts,
+                 SHA-256 and path
+  -json          One JSON object per entry and line
+  -profile       Use a named profile from the config files
+
+Example:
+  bundler list myproject_collated_part1.fb
+  bundler list -long myproject_collated_part1.fb "**/*.go"
+`, Version)
+}
+
+func PrintExtractHelp() {
+	fmt.Printf(`Folder Bundler v%s
+
+Usage: bundler extract [flags] <input_file> <path or pattern>...
+
+Reconstructs only the entries matching the given paths or globs, such as
+"cmd/server/main.go" or "internal/**/*.go". A directory selects everything
+below it. Hashes are verified as for reconstruct. With -stdout, each file is
+checked against its recorded size and hash before it is written, and files
+that fail are left out.
+
+Flags:
+  -stdout        Write the content of the matching files to standard output
+  -o             Directory to extract into instead of the bundle's root directory
+  -on-conflict   Existing files that differ: overwrite|skip|backup|newer|fail
+  -allow-unsafe  Extract entries that would write outside the destination
+  -skip-symlinks Skip creating symbolic links
+  -time          Restore original modification times (default: true)
+  -profile       Use a named profile from the config files
+
+Example:
+  bundler extract myproject_collated_part1.fb cmd/server/main.go
+  bundler extract -stdout myproject_collated_part1.fb go.mod > go.mod
+  bundler extract -o /tmp/docs myproject_collated_part1.fb "docs/**"
+`, Version)
 }
 
-func ParseParameters() (*Parameters, error) {
+func PrintDiffHelp() {
+	fmt.Printf(`Folder Bundler v%s
+
+Usage: bundler diff [flags] <old> <new>
+
+Compares two bundles, or a bundle and a directory, and lists the entries
+that were added, removed, modified, had their mode changed or, for
+symlinks, point somewhere else. Files are compared by SHA-256. A directory
+is walked with the same rules as collect, so pass the flags it was
+collected with; with -secrets redact its files are redacted before they are
+compared. Exits with status 1 if anything differs.
+
+Flags:
+  -patch         Show unified diffs of modified text files
+  -json          One JSON object per changed entry and line
+  -include       Include paths matching a glob when walking a directory
+  -exclude       Exclude paths matching a glob when walking a directory
+  -hidden        Include hidden files when walking a directory
+  -no-gitignore  Don't apply .gitignore rules when walking a directory
+  -max           Maximum file size, as when collecting
+  -secrets       Secret scanning, as when collecting; redact redacts directory files
+  -secret-pattern Extra regex to treat as a secret (repeatable)
+  -profile       Use a named profile from the config files
+
+Example:
+  bundler diff release-1.0_part1.fb release-1.1_part1.fb
+  bundler diff -patch myproject_collated_part1.fb ./myproject
+`, Version)
+}
+
+func PrintUpgradeHelp() {
+	fmt.Printf(`Folder Bundler v%s
+
+Usage: bundler upgrade [flags] <input_file>
+
+Rewrites a bundle written by an older version in the current format
+(format %d). The new parts replace the old ones under the same names.
+
+Flags:
+  -out-max      Maximum output file size (default: 2M, at least 1K)
+  -max-tokens   Maximum estimated tokens per output file
+  -compress     Compression: none|auto|dictionary|template|delta|template+delta
+  -mem-max      Memory ceiling for compression (default: 256M)
+  -allow-unsafe Upgrade a bundle whose entries write outside its root
+  -profile      Use a named profile from the config files
+
+Example:
+  bundler upgrade myproject_collated_part1.fb
+`, Version, FormatVersion)
+}
+
+// validConflictPolicies are the values of -on-conflict
+var validConflictPolicies = map[string]bool{
+	"overwrite": true,
+	"skip":      true,
+	"backup":    true,
+	"newer":     true,
+	"fail":      true,
+}
+
+// ParseParameters builds the parameters from, in increasing precedence, the
+// built-in defaults, the user config file, the project config file in root,
+// FOLDER_BUNDLER_* environment variables and the command line flags.
+func ParseParameters(root string) (*Parameters, error) {
 	var params Parameters
 	var excludeDirs, excludeFiles, excludeExts string
-	var maxFileSizeStr, maxOutputSizeStr string
-
-	defaultExcludeDirs := strings.Join([]string{
-		"node_modules", "dist", "build", "coverage", "tmp",
-		".git", ".next", ".idea", ".vscode", ".cache", ".build",
-		".vercel", ".turbo", ".yarn", ".npm",
-	}, ",")
-
-	defaultExcludeFiles := "package-lock.json,yarn.lock,.DS_Store,.env"
-	defaultExcludeExts := ".exe,.dll,.so,.dylib,.bin,.pkl,.pyc,.bak"
-
-	flag.StringVar(&maxFileSizeStr, "max", "2M", "Maximum file size (e.g. 2M, 500K, 1G)")
-	flag.StringVar(&maxOutputSizeStr, "out-max", "2M", "Maximum output size (e.g. 2M, 500K, 1G)")
-	flag.StringVar(&excludeDirs, "skip-dirs", defaultExcludeDirs, "Skip directories")
-	flag.StringVar(&excludeFiles, "skip-files", defaultExcludeFiles, "Skip files")
-	flag.StringVar(&excludeExts, "skip-ext", defaultExcludeExts, "Skip extensions")
+	var maxFileSizeStr, maxOutputSizeStr, maxTokensStr, maxMemoryStr, umaskStr string
+	var ruleFlags []ruleSpec
+
+	// Flag defaults come from the built-in defaults layer (defaults.yaml)
+	flag.StringVar(&maxFileSizeStr, "max", "", "Maximum file size (e.g. 2M, 500K, 1G)")
+	flag.StringVar(&maxOutputSizeStr, "out-max", "", "Maximum output size (e.g. 2M, 500K, 1G)")
+	flag.StringVar(&maxTokensStr, "max-tokens", "", "Maximum estimated tokens per output file (e.g. 100K)")
+	flag.StringVar(&params.TokenizerVocab, "tokenizer-vocab", "", "Tokenizer vocab file for -max-tokens")
+	flag.StringVar(&excludeDirs, "skip-dirs", "", "Skip directories")
+	flag.StringVar(&excludeFiles, "skip-files", "", "Skip files")
+	flag.StringVar(&excludeExts, "skip-ext", "", "Skip extensions")
+	flag.Var(&ruleFlag{specs: &ruleFlags, include: true}, "include", "Include paths matching a glob (repeatable)")
+	flag.Var(&ruleFlag{specs: &ruleFlags, include: false}, "exclude", "Exclude paths matching a glob (repeatable)")
 	flag.BoolVar(&params.IncludeHidden, "hidden", false, "Include hidden files")
-	flag.BoolVar(&params.SkipGitignore, "no-gitignore", false, "Skip .gitignore")
-	flag.BoolVar(&params.PreserveTimestamp, "time", true, "Preserve timestamps")
+	flag.BoolVar(&params.SkipGitignore, "no-gitignore", false, "Don't apply .gitignore rules")
+	flag.BoolVar(&params.PreserveTimestamp, "time", false, "Preserve timestamps")
 	flag.BoolVar(&params.SkipSymlinks, "skip-symlinks", false, "Skip creating symbolic links")
-	flag.StringVar(&params.CompressionStrategy, "compress", "none", "Compression (none|auto|dictionary|template|delta|template+delta)")
+	flag.StringVar(&params.OutputDir, "o", "", "Directory to reconstruct into instead of the bundle's root")
+	flag.BoolVar(&params.AllowUnsafe, "allow-unsafe", false, "Reconstruct entries that write outside the destination")
+	flag.BoolVar(&params.Resume, "resume", false, "Keep an interrupted reconstruct and continue it")
+	flag.BoolVar(&params.ListLong, "long", false, "List sizes, modes, times, parts and hashes")
+	flag.BoolVar(&params.JSONOutput, "json", false, "Print entries as JSON, one object per line")
+	flag.BoolVar(&params.DiffPatch, "patch", false, "Show unified diffs of modified text files")
+	flag.BoolVar(&params.ExtractStdout, "stdout", false, "Write extracted files to standard output")
+	flag.StringVar(&params.Since, "since", "", "Collect only the changes since a previous bundle")
+	flag.StringVar(&params.Base, "base", "", "Base bundle to apply an incremental bundle to")
+	flag.StringVar(&params.Git, "git", "", "Collect only the files git tracks (tracked)")
+	flag.StringVar(&params.GitDiff, "git-diff", "", "Collect only the files changed in a revision range")
+	flag.IntVar(&params.GitContext, "git-context", -1, "Lines of context of the -git-diff diff added to the bundle")
+	flag.StringVar(&params.OnConflict, "on-conflict", "", "Existing files that differ (overwrite|skip|backup|newer|fail)")
+	flag.StringVar(&umaskStr, "umask", "", "Permission bits to clear from restored modes (e.g. 022)")
+	flag.BoolVar(&params.PreserveOwner, "owner", false, "Record and restore file owners (uid/gid)")
+	flag.StringVar(&params.CompressionStrategy, "compress", "", "Compression (none|auto|dictionary|template|delta|template+delta)")
+	flag.StringVar(&maxMemoryStr, "mem-max", "", "Memory ceiling for compression (e.g. 256M)")
+	flag.StringVar(&params.Profile, "profile", "", "Config profile to use")
+	flag.StringVar(&params.SecretsMode, "secrets", "", "Secret scanning (off|warn|redact|fail)")
+	flag.Var((*listFlag)(&params.SecretPatterns), "secret-pattern", "Extra regex to treat as a secret (repeatable)")
+	flag.StringVar(&params.SecretsReport, "secrets-report", "", "Report file for detected secrets")
+
+	if root == "" {
+		root = "."
+	}
+	profile := profileFromArgs(os.Args[1:])
+	layers, loaded, err := configLayers(root, profile)
+	if err != nil {
+		return nil, err
+	}
+	params.ConfigFiles = loaded
+
+	// Settings that came from a config file or the environment count as set
+	configured := make(map[string]bool)
+	for i, layer := range layers {
+		keys, err := applyLayer(layer)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			continue
+		}
+		for _, key := range keys {
+			configured[key] = true
+		}
+	}
 
 	flag.Parse()
+	flag.Visit(func(f *flag.Flag) {
+		configured[f.Name] = true
+	})
+	params.Profile = profile
 
-	params.ExcludedDirs = stringToMap(excludeDirs)
-	params.ExcludedFiles = stringToMap(excludeFiles)
-	params.ExcludedExts = stringToMap(excludeExts)
-	params.RootDir = "."
+	params.RootDir = root
+
+	ruleSet, err := buildRules(excludeDirs, excludeFiles, excludeExts, ruleFlags)
+	if err != nil {
+		return nil, err
+	}
+	params.Rules = ruleSet
 
 	// Parse size strings
 	maxFileSize, err := parseSize(maxFileSizeStr)
@@ -110,19 +392,36 @@ func ParseParameters() (*Parameters, error) {
 	if err != nil {
 		return nil, fmt.Errorf("invalid max output size '%s': %v", maxOutputSizeStr, err)
 	}
+	if maxOutputSize < MinOutputSize {
+		return nil, fmt.Errorf("invalid max output size '%s': must be at least 1K", maxOutputSizeStr)
+	}
 	params.MaxOutputSize = maxOutputSize
 
-	// Parse flags and set compression
-	// Check if compress flag was explicitly set by looking at Visit
-	compressSet := false
-	flag.Visit(func(f *flag.Flag) {
-		if f.Name == "compress" {
-			compressSet = true
+	maxMemory, err := parseSize(maxMemoryStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid memory ceiling '%s': %v", maxMemoryStr, err)
+	}
+	params.MaxMemory = maxMemory
+
+	if maxTokensStr != "" {
+		maxTokens, err := parseCount(maxTokensStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max tokens '%s': %v", maxTokensStr, err)
 		}
-	})
-	
-	// Enable compression if flag was set (even if value is "none")
-	params.EnableCompression = compressSet
+		params.MaxTokens = maxTokens
+	}
+
+	if umaskStr != "" {
+		umask, err := strconv.ParseUint(umaskStr, 8, 32)
+		if err != nil || umask > 0777 {
+			return nil, fmt.Errorf("invalid umask '%s': expected an octal value like 022", umaskStr)
+		}
+		params.Umask = os.FileMode(umask)
+	}
+
+	// Enable compression if it was set on the command line or in a config
+	// file (even if the value is "none")
+	params.EnableCompression = configured["compress"]
 	
 	// Validate compression settings
 	validStrategies := map[string]bool{
@@ -138,15 +437,115 @@ func ParseParameters() (*Parameters, error) {
 		return nil, fmt.Errorf("invalid compression '%s'. Valid options: none, auto, dictionary, template, delta, template+delta", params.CompressionStrategy)
 	}
 
+	if !validConflictPolicies[params.OnConflict] {
+		return nil, fmt.Errorf("invalid conflict policy '%s'. Valid options: overwrite, skip, backup, newer, fail", params.OnConflict)
+	}
+
+	if params.Git != "" && params.Git != "tracked" {
+		return nil, fmt.Errorf("invalid git mode '%s'. Valid options: tracked", params.Git)
+	}
+	if params.Git != "" && params.GitDiff != "" {
+		return nil, fmt.Errorf("-git and -git-diff cannot be combined: -git-diff only collects tracked files already")
+	}
+	if params.GitContext >= 0 && params.GitDiff == "" {
+		return nil, fmt.Errorf("-git-context needs -git-diff")
+	}
+	if params.GitDiff != "" && params.Since != "" {
+		return nil, fmt.Errorf("-git-diff cannot be combined with -since: files outside the range would be recorded as deleted")
+	}
+
+	if params.MaxTokens > 0 && params.EnableCompression {
+		return nil, fmt.Errorf("-max-tokens cannot be combined with -compress: compressed bundles are not meant to be read by a model")
+	}
+
+	validMode := false
+	for _, mode := range secrets.ValidModes {
+		if params.SecretsMode == mode {
+			validMode = true
+		}
+	}
+	if !validMode {
+		return nil, fmt.Errorf("invalid secrets mode '%s'. Valid options: %s", params.SecretsMode, strings.Join(secrets.ValidModes, ", "))
+	}
+
 	return &params, nil
 }
 
-func stringToMap(s string) map[string]bool {
-	result := make(map[string]bool)
+// ruleSpec is an -include or -exclude pattern in command line order
+type ruleSpec struct {
+	pattern string
+	include bool
+}
+
+// ruleFlag appends to a shared list so -include and -exclude keep their relative order
+type ruleFlag struct {
+	specs   *[]ruleSpec
+	include bool
+}
+
+func (f *ruleFlag) String() string {
+	return ""
+}
+
+func (f *ruleFlag) Set(value string) error {
+	*f.specs = append(*f.specs, ruleSpec{pattern: value, include: f.include})
+	return nil
+}
+
+func (f *ruleFlag) repeatable() {}
+
+// listFlag collects the values of a flag that may be given more than once
+type listFlag []string
+
+func (f *listFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *listFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func (f *listFlag) repeatable() {}
+
+// buildRules turns the skip shorthands and the -include/-exclude flags into a
+// single rule set. The file and extension shorthands come first so explicit
+// flags can override them; the directory shorthands come last, so an include
+// such as '**/*.go' doesn't walk back into node_modules. Skipped directories
+// are collected by changing -skip-dirs.
+func buildRules(excludeDirs, excludeFiles, excludeExts string, specs []ruleSpec) (*rules.Set, error) {
+	set := rules.NewSet()
+	for _, file := range splitList(excludeFiles) {
+		if err := set.ExcludeFile(file); err != nil {
+			return nil, fmt.Errorf("invalid -skip-files entry: %v", err)
+		}
+	}
+	for _, ext := range splitList(excludeExts) {
+		if err := set.ExcludeExt(ext); err != nil {
+			return nil, fmt.Errorf("invalid -skip-ext entry: %v", err)
+		}
+	}
+	for _, spec := range specs {
+		if err := set.Add(spec.pattern, spec.include); err != nil {
+			return nil, err
+		}
+	}
+	for _, dir := range splitList(excludeDirs) {
+		if err := set.ExcludeDir(dir); err != nil {
+			return nil, fmt.Errorf("invalid -skip-dirs entry: %v", err)
+		}
+	}
+	return set, nil
+}
+
+func splitList(s string) []string {
+	var items []string
 	for _, item := range strings.Split(s, ",") {
-		result[strings.TrimSpace(item)] = true
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
-	return result
+	return items
 }
 
 // parseSize parses human-readable size strings like "1M", "500K", "2G"
@@ -192,3 +591,27 @@ func parseSize(s string) (int64, error) {
 
 	return int64(num * multiplier), nil
 }
+
+// parseCount parses counts like "150000", "150K" or "1.5M" (decimal multipliers)
+func parseCount(s string) (int64, error) {
+	s = strings.TrimSpace(strings.ToUpper(s))
+	if s == "" {
+		return 0, fmt.Errorf("empty count")
+	}
+
+	multiplier := 1.0
+	switch s[len(s)-1] {
+	case 'K':
+		multiplier = 1000
+		s = s[:len(s)-1]
+	case 'M':
+		multiplier = 1000 * 1000
+		s = s[:len(s)-1]
+	}
+
+	num, err := strconv.ParseFloat(s, 64)
+	if err != nil || num < 0 {
+		return 0, fmt.Errorf("invalid number: %s", s)
+	}
+	return int64(num * multiplier), nil
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"regexp"
+	"testing"
+)
+
+// captureStdout returns what fn prints to standard output
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	done := make(chan string)
+	go func() {
+		out, _ := io.ReadAll(r)
+		done <- string(out)
+	}()
+	fn()
+	w.Close()
+	return <-done
+}
+
+func TestHelpFlagsAreRegistered(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", home)
+	args := os.Args
+	os.Args = []string{"bundler"}
+	defer func() { os.Args = args }()
+	if _, err := ParseParameters(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Flag lines are indented and start with the flag name
+	flagLine := regexp.MustCompile(`(?m)^ +-([a-z][a-z0-9-]*)`)
+	for name, help := range map[string]func(){
+		"usage":       PrintUsage,
+		"reconstruct": PrintReconstructHelp,
+		"verify":      PrintVerifyHelp,
+		"list":        PrintListHelp,
+		"extract":     PrintExtractHelp,
+		"diff":        PrintDiffHelp,
+		"upgrade":     PrintUpgradeHelp,
+	} {
+		text := captureStdout(t, help)
+		matches := flagLine.FindAllStringSubmatch(text, -1)
+		if len(matches) == 0 {
+			t.Errorf("%s: no flags found in the help text", name)
+		}
+		for _, m := range matches {
+			if flag.Lookup(m[1]) == nil {
+				t.Errorf("%s: help documents -%s, which is not a flag", name, m[1])
+			}
+		}
+	}
+}
+
+func TestOutputSizeFloor(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", home)
+	args, commandLine := os.Args, flag.CommandLine
+	defer func() { os.Args, flag.CommandLine = args, commandLine }()
+
+	for value, ok := range map[string]bool{"512": false, "1023": false, "1K": true} {
+		flag.CommandLine = flag.NewFlagSet("bundler", flag.ContinueOnError)
+		os.Args = []string{"bundler", "-out-max", value}
+		params, err := ParseParameters(t.TempDir())
+		if ok && (err != nil || params.MaxOutputSize != MinOutputSize) {
+			t.Errorf("-out-max %s: got %v, want it accepted", value, err)
+		}
+		if !ok && err == nil {
+			t.Errorf("-out-max %s: accepted below the 1K floor", value)
+		}
+	}
+}
+
+func TestIncludeKeepsSkippedDirs(t *testing.T) {
+	set, err := buildRules("node_modules,dist", ".DS_Store", ".exe", []ruleSpec{
+		{pattern: "**/*.go", include: true},
+		{pattern: "**/*.exe", include: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path     string
+		isDir    bool
+		excluded bool
+	}{
+		{"main.go", false, false},
+		{"README.md", false, true},
+		{"node_modules", true, true},
+		// Pruned, so the walk never reaches node_modules/x/a.go
+		{"web/dist", true, true},
+		// An include still overrides the file and extension shorthands
+		{"tools/setup.exe", false, false},
+	}
+	for _, tt := range tests {
+		if got := set.Excluded(tt.path, tt.isDir); got != tt.excluded {
+			t.Errorf("Excluded(%q, dir=%v) = %v, want %v", tt.path, tt.isDir, got, tt.excluded)
+		}
+	}
+}
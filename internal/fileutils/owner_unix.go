@@ -0,0 +1,22 @@
+//go:build !windows
+
+package fileutils
+
+import (
+	"os"
+	"syscall"
+)
+
+// FileOwner returns the uid and gid of a file, if the platform records them
+func FileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(stat.Uid), int(stat.Gid), true
+}
+
+// CanChown reports whether the process may give files to other users
+func CanChown() bool {
+	return os.Geteuid() == 0
+}
@@ -0,0 +1,15 @@
+//go:build windows
+
+package fileutils
+
+import "os"
+
+// FileOwner returns the uid and gid of a file, if the platform records them
+func FileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
+
+// CanChown reports whether the process may give files to other users
+func CanChown() bool {
+	return false
+}
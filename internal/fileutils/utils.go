@@ -3,6 +3,7 @@ package fileutils
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"unicode/utf8"
 )
@@ -73,13 +74,37 @@ func GetLanguage(extension string) string {
 	return languageMap[strings.ToLower(extension)]
 }
 
-func BackupExistingFile(filename string) error {
-	if _, err := os.Stat(filename); err == nil {
-		backupName := filename + ".bak"
-		if err := os.Rename(filename, backupName); err != nil {
-			return fmt.Errorf("failed to create backup: %v", err)
+// BackupExistingFile moves filename aside to filename.bak, or to
+// filename.bak.1, .bak.2 and so on if earlier backups exist, and returns the
+// name it was moved to. It returns "" if there is no such file.
+func BackupExistingFile(filename string) (string, error) {
+	if _, err := os.Lstat(filename); err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
 		}
-		fmt.Printf("Existing file backed up to %s\n", backupName)
+		return "", fmt.Errorf("failed to create backup: %v", err)
 	}
-	return nil
+
+	backupName := filename + ".bak"
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(backupName); os.IsNotExist(err) {
+			break
+		}
+		backupName = fmt.Sprintf("%s.bak.%d", filename, i)
+	}
+	if err := os.Rename(filename, backupName); err != nil {
+		return "", fmt.Errorf("failed to create backup: %v", err)
+	}
+	return backupName, nil
+}
+
+// QuotePath quotes a path that can't be written as plain text on a header
+// line: one with newlines or other control characters, surrounding spaces,
+// backslashes or a leading quote. Other paths are returned as they are.
+func QuotePath(path string) string {
+	quoted := strconv.Quote(path)
+	if quoted[1:len(quoted)-1] != path || strings.HasPrefix(path, `"`) || strings.TrimSpace(path) != path {
+		return quoted
+	}
+	return path
 }
@@ -0,0 +1,121 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ErrNotRepository is returned when the directory is not inside a git repository
+var ErrNotRepository = errors.New("not a git repository")
+
+// Tracked returns the files in the git index below dir, relative to it and
+// slash separated
+func Tracked(dir string) ([]string, error) {
+	if err := checkRepository(dir); err != nil {
+		return nil, err
+	}
+	out, err := run(dir, "ls-files", "-z", "--cached")
+	if err != nil {
+		return nil, err
+	}
+	return splitNull(out), nil
+}
+
+// Changed returns the files below dir that a revision range changed,
+// relative to it. Files the range deletes are left out, as there is nothing
+// to collect.
+func Changed(dir, revRange string) ([]string, error) {
+	return changedFiles(dir, revRange, "d")
+}
+
+// Deleted returns the files below dir that a revision range deleted
+func Deleted(dir, revRange string) ([]string, error) {
+	return changedFiles(dir, revRange, "D")
+}
+
+// changedFiles lists the files of a range that pass a --diff-filter
+func changedFiles(dir, revRange, filter string) ([]string, error) {
+	if err := checkRange(revRange); err != nil {
+		return nil, err
+	}
+	if err := checkRepository(dir); err != nil {
+		return nil, err
+	}
+	out, err := run(dir, "diff", "--name-only", "-z", "--relative", "--no-renames", "--diff-filter="+filter, revRange, "--")
+	if err != nil {
+		return nil, err
+	}
+	return splitNull(out), nil
+}
+
+// Diff returns the unified diff of one file over a revision range, with
+// context lines of context
+func Diff(dir, revRange string, context int, path string) (string, error) {
+	if err := checkRange(revRange); err != nil {
+		return "", err
+	}
+	if err := checkRepository(dir); err != nil {
+		return "", err
+	}
+	out, err := run(dir, "diff", fmt.Sprintf("-U%d", context), "--relative", "--no-color", "--no-ext-diff", "--no-renames",
+		revRange, "--", ":(literal)"+path)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// checkRepository makes sure dir is in a work tree; outside of one git diff
+// would compare paths instead
+func checkRepository(dir string) error {
+	_, err := run(dir, "rev-parse", "--is-inside-work-tree")
+	return err
+}
+
+// checkRange refuses a range git would take for an option
+func checkRange(revRange string) error {
+	if revRange == "" || strings.HasPrefix(revRange, "-") {
+		return fmt.Errorf("invalid revision range '%s'", revRange)
+	}
+	return nil
+}
+
+// run runs git in dir and returns its output
+func run(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err == nil {
+		return out, nil
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, fmt.Errorf("git is not installed: %v", err)
+	}
+	msg := strings.TrimSpace(stderr.String())
+	if strings.Contains(strings.ToLower(msg), "not a git repository") {
+		return nil, ErrNotRepository
+	}
+	// The first line says what went wrong; usage text may follow
+	if i := strings.IndexByte(msg, '\n'); i >= 0 {
+		msg = msg[:i]
+	}
+	if msg == "" {
+		msg = err.Error()
+	}
+	return nil, fmt.Errorf("git %s: %s", args[0], msg)
+}
+
+// splitNull splits NUL-terminated output
+func splitNull(out []byte) []string {
+	var paths []string
+	for _, p := range strings.Split(string(out), "\x00") {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
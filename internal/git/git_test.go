@@ -0,0 +1,102 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func gitCommand(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+}
+
+func TestTrackedAndChanged(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	root := t.TempDir()
+	gitCommand(t, root, "init", "-q", "-b", "main")
+	writeFile(t, filepath.Join(root, "app", "main.go"), "package main\n")
+	writeFile(t, filepath.Join(root, "app", "old.go"), "package main\n")
+	writeFile(t, filepath.Join(root, "README.md"), "readme\n")
+	gitCommand(t, root, "add", "-A")
+	gitCommand(t, root, "commit", "-q", "-m", "first")
+
+	writeFile(t, filepath.Join(root, "app", "main.go"), "package main\n\nfunc main() {}\n")
+	writeFile(t, filepath.Join(root, "app", "new.go"), "package main\n")
+	gitCommand(t, root, "rm", "-q", "app/old.go")
+	gitCommand(t, root, "add", "-A")
+	gitCommand(t, root, "commit", "-q", "-m", "second")
+	writeFile(t, filepath.Join(root, "app", "untracked.go"), "package main\n")
+
+	app := filepath.Join(root, "app")
+	tracked, err := Tracked(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"main.go", "new.go"}; !reflect.DeepEqual(tracked, want) {
+		t.Errorf("Tracked: got %v, want %v", tracked, want)
+	}
+
+	changed, err := Changed(root, "HEAD~1..HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"app/main.go", "app/new.go"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("Changed: got %v, want %v", changed, want)
+	}
+	deleted, err := Deleted(root, "HEAD~1..HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"app/old.go"}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("Deleted: got %v, want %v", deleted, want)
+	}
+
+	diff, err := Diff(app, "HEAD~1..HEAD", 0, "main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff, "+++ b/main.go\n@@ -1,0 +2,2 @@") || !strings.HasSuffix(diff, "\n+\n+func main() {}\n") {
+		t.Errorf("Diff: got %q", diff)
+	}
+
+	if _, err := Changed(root, "--output=x"); err == nil {
+		t.Errorf("a range that looks like an option was accepted")
+	}
+}
+
+func TestNotRepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	t.Setenv("GIT_CEILING_DIRECTORIES", os.TempDir())
+	dir := t.TempDir()
+	if _, err := Tracked(dir); !errors.Is(err, ErrNotRepository) {
+		t.Errorf("Tracked: got %v, want ErrNotRepository", err)
+	}
+	if _, err := Changed(dir, "main..HEAD"); !errors.Is(err, ErrNotRepository) {
+		t.Errorf("Changed: got %v, want ErrNotRepository", err)
+	}
+}
@@ -0,0 +1,270 @@
+package gitignore
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/jonathanleahy/folder-bundler/internal/glob"
+)
+
+// Matcher evaluates paths against the gitignore rules that apply to a
+// collection root: the user's core.excludesFile, .git/info/exclude and every
+// .gitignore between the repository top level and the directories visited so far.
+type Matcher struct {
+	root     string
+	prefix   string // root relative to the repository top level, slash separated
+	patterns []pattern
+}
+
+type pattern struct {
+	glob    string // slash-separated glob relative to base
+	base    string // directory the pattern was read from, relative to the repository top level
+	negate  bool
+	dirOnly bool
+}
+
+// New creates a matcher for root, loading global excludes and the .gitignore
+// files of root and all of its ancestors inside the same repository.
+func New(root string) (*Matcher, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	top, gitDir := findRepository(absRoot)
+	prefix, err := filepath.Rel(top, absRoot)
+	if err != nil {
+		return nil, err
+	}
+	if prefix == "." {
+		prefix = ""
+	}
+
+	m := &Matcher{root: root, prefix: filepath.ToSlash(prefix)}
+
+	// Lowest precedence first: later patterns override earlier ones
+	if excludesFile := globalExcludesFile(gitDir); excludesFile != "" {
+		if err := m.loadFile(excludesFile, ""); err != nil {
+			return nil, err
+		}
+	}
+	if gitDir != "" {
+		if err := m.loadFile(filepath.Join(gitDir, "info", "exclude"), ""); err != nil {
+			return nil, err
+		}
+	}
+
+	// .gitignore files above the root still apply to it
+	dir := top
+	base := ""
+	if err := m.loadFile(filepath.Join(dir, ".gitignore"), base); err != nil {
+		return nil, err
+	}
+	if m.prefix != "" {
+		for _, part := range strings.Split(m.prefix, "/") {
+			dir = filepath.Join(dir, part)
+			base = path.Join(base, part)
+			if err := m.loadFile(filepath.Join(dir, ".gitignore"), base); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// AddDir loads the .gitignore file of a directory below the root, if any.
+// Call it for each directory as the walk enters it.
+func (m *Matcher) AddDir(relPath string) error {
+	return m.loadFile(filepath.Join(m.root, relPath, ".gitignore"), m.repoPath(relPath))
+}
+
+// Match reports whether the path (relative to the root) is ignored.
+func (m *Matcher) Match(relPath string, isDir bool) bool {
+	full := m.repoPath(relPath)
+	ignored := false
+	for _, p := range m.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		rel := full
+		if p.base != "" {
+			if !strings.HasPrefix(full, p.base+"/") {
+				continue
+			}
+			rel = full[len(p.base)+1:]
+		}
+		if glob.Match(p.glob, rel) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+func (m *Matcher) repoPath(relPath string) string {
+	return path.Join(m.prefix, filepath.ToSlash(relPath))
+}
+
+func (m *Matcher) loadFile(filename, base string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if p, ok := parsePattern(scanner.Text(), base); ok {
+			m.patterns = append(m.patterns, p)
+		}
+	}
+	return scanner.Err()
+}
+
+// parsePattern converts one gitignore line into a glob understood by the glob package
+func parsePattern(line, base string) (pattern, bool) {
+	line = trimTrailingSpaces(strings.TrimSuffix(line, "\r"))
+	if line == "" || strings.HasPrefix(line, "#") {
+		return pattern{}, false
+	}
+
+	p := pattern{base: base}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	// A slash at the start or in the middle anchors the pattern to its directory
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return pattern{}, false
+	}
+
+	line = strings.ReplaceAll(line, "[!", "[^")
+	// A trailing "/**" matches everything inside, but not the directory itself
+	if strings.HasSuffix(line, "/**") {
+		line += "/*"
+	}
+	if !anchored {
+		line = "**/" + line
+	}
+	if glob.Validate(line) != nil {
+		return pattern{}, false
+	}
+
+	p.glob = line
+	return p, true
+}
+
+// trimTrailingSpaces removes trailing spaces unless they are escaped with a backslash
+func trimTrailingSpaces(s string) string {
+	for strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\\ ") {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// findRepository walks up from dir looking for a .git directory or file.
+// It returns the repository top level and git directory, or dir itself and
+// an empty git directory when dir is not inside a repository.
+func findRepository(dir string) (string, string) {
+	for current := dir; ; {
+		gitPath := filepath.Join(current, ".git")
+		if info, err := os.Stat(gitPath); err == nil {
+			if info.IsDir() {
+				return current, gitPath
+			}
+			// Worktrees and submodules use a file pointing at the real git directory
+			if content, err := os.ReadFile(gitPath); err == nil {
+				gitDir := strings.TrimSpace(strings.TrimPrefix(string(content), "gitdir:"))
+				if !filepath.IsAbs(gitDir) {
+					gitDir = filepath.Join(current, gitDir)
+				}
+				return current, gitDir
+			}
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			return dir, ""
+		}
+		current = parent
+	}
+}
+
+// globalExcludesFile resolves core.excludesFile from the repository and user
+// git configuration, falling back to git's default location.
+func globalExcludesFile(gitDir string) string {
+	home, _ := os.UserHomeDir()
+	xdgConfig := os.Getenv("XDG_CONFIG_HOME")
+	if xdgConfig == "" && home != "" {
+		xdgConfig = filepath.Join(home, ".config")
+	}
+
+	var configFiles []string
+	if gitDir != "" {
+		configFiles = append(configFiles, filepath.Join(gitDir, "config"))
+	}
+	if home != "" {
+		configFiles = append(configFiles, filepath.Join(home, ".gitconfig"))
+	}
+	if xdgConfig != "" {
+		configFiles = append(configFiles, filepath.Join(xdgConfig, "git", "config"))
+	}
+
+	for _, configFile := range configFiles {
+		if value := readCoreExcludesFile(configFile); value != "" {
+			if strings.HasPrefix(value, "~/") && home != "" {
+				value = filepath.Join(home, value[2:])
+			}
+			return value
+		}
+	}
+
+	if xdgConfig != "" {
+		return filepath.Join(xdgConfig, "git", "ignore")
+	}
+	return ""
+}
+
+// readCoreExcludesFile extracts core.excludesFile from a git config file
+func readCoreExcludesFile(filename string) string {
+	file, err := os.Open(filename)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	inCore := false
+	value := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			inCore = strings.EqualFold(strings.Trim(line, "[] \t"), "core")
+			continue
+		}
+		if !inCore {
+			continue
+		}
+		key, val, found := strings.Cut(line, "=")
+		if found && strings.EqualFold(strings.TrimSpace(key), "excludesfile") {
+			value = strings.Trim(strings.TrimSpace(val), `"`)
+		}
+	}
+	return value
+}
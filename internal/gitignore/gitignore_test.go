@@ -0,0 +1,111 @@
+package gitignore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func TestMatcher_NestedAndNegated(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	os.Mkdir(filepath.Join(root, ".git"), 0755)
+
+	writeFile(t, filepath.Join(root, ".gitignore"), "*.log\n!keep.log\n/build/\ndocs/**\n!docs/index.md\n")
+	writeFile(t, filepath.Join(root, "sub", ".gitignore"), "generated/\n*.tmp\n")
+	writeFile(t, filepath.Join(root, ".git", "info", "exclude"), "secret.txt\n")
+
+	m, err := New(root)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := m.AddDir("sub"); err != nil {
+		t.Fatalf("AddDir failed: %v", err)
+	}
+
+	tests := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"app.log", false, true},
+		{"nested/deep/app.log", false, true},
+		{"keep.log", false, false},
+		{"build", true, true},
+		{"sub/build", true, false},
+		{"docs", true, false},
+		{"docs/api.md", false, true},
+		{"docs/index.md", false, false},
+		{"sub/generated", true, true},
+		{"sub/generated", false, false},
+		{"sub/x.tmp", false, true},
+		{"x.tmp", false, false},
+		{"secret.txt", false, true},
+		{"main.go", false, false},
+	}
+
+	for _, tt := range tests {
+		if got := m.Match(tt.path, tt.isDir); got != tt.ignored {
+			t.Errorf("Match(%q, dir=%v) = %v, want %v", tt.path, tt.isDir, got, tt.ignored)
+		}
+	}
+}
+
+func TestMatcher_RootInsideRepository(t *testing.T) {
+	repo := t.TempDir()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	os.Mkdir(filepath.Join(repo, ".git"), 0755)
+
+	writeFile(t, filepath.Join(repo, ".gitignore"), "/project/out/\n*.bak\n")
+	writeFile(t, filepath.Join(repo, "project", "main.go"), "package main\n")
+
+	m, err := New(filepath.Join(repo, "project"))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	if !m.Match("out", true) {
+		t.Errorf("Expected anchored pattern from parent .gitignore to apply")
+	}
+	if !m.Match("main.go.bak", false) {
+		t.Errorf("Expected unanchored pattern from parent .gitignore to apply")
+	}
+	if m.Match("main.go", false) {
+		t.Errorf("Did not expect main.go to be ignored")
+	}
+}
+
+func TestMatcher_GlobalExcludesFile(t *testing.T) {
+	root := t.TempDir()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+
+	writeFile(t, filepath.Join(home, ".gitconfig"), "[core]\n\texcludesFile = ~/.global_ignore\n")
+	writeFile(t, filepath.Join(home, ".global_ignore"), ".idea/\n*.swp\n")
+	writeFile(t, filepath.Join(root, ".gitignore"), "!important.swp\n")
+
+	m, err := New(root)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	if !m.Match("notes.swp", false) {
+		t.Errorf("Expected core.excludesFile pattern to apply")
+	}
+	if m.Match("important.swp", false) {
+		t.Errorf("Expected .gitignore negation to override core.excludesFile")
+	}
+}
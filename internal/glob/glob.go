@@ -0,0 +1,83 @@
+package glob
+
+import (
+	"path"
+	"strings"
+)
+
+// Match reports whether the slash-separated name matches pattern.
+// Each segment uses path.Match syntax; a "**" segment matches zero or more
+// whole segments, so "docs/**" matches "docs" and everything below it and
+// "**/*_test.go" matches test files at any depth.
+func Match(pattern, name string) bool {
+	return matchSegments(split(pattern), split(name))
+}
+
+// MatchPrefix reports whether some path strictly below dir could match
+// pattern. It is used to decide whether a directory can be pruned.
+func MatchPrefix(pattern, dir string) bool {
+	pat, names := split(pattern), split(dir)
+	for len(names) > 0 {
+		if len(pat) == 0 {
+			return false
+		}
+		if pat[0] == "**" {
+			return true
+		}
+		if ok, err := path.Match(pat[0], names[0]); err != nil || !ok {
+			return false
+		}
+		pat, names = pat[1:], names[1:]
+	}
+	return len(pat) > 0
+}
+
+// Validate reports whether pattern is well formed.
+func Validate(pattern string) error {
+	for _, seg := range split(pattern) {
+		if seg == "**" {
+			continue
+		}
+		if _, err := path.Match(seg, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func split(s string) []string {
+	s = strings.Trim(s, "/")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "/")
+}
+
+func matchSegments(pat, name []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			// Collapse runs of "**" - they match the same as a single one
+			for len(pat) > 1 && pat[1] == "**" {
+				pat = pat[1:]
+			}
+			if len(pat) == 1 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pat[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pat[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pat, name = pat[1:], name[1:]
+	}
+	return len(name) == 0
+}
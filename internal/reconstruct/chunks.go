@@ -0,0 +1,137 @@
+package reconstruct
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checkChunks checks that every file split across parts has all of its
+// chunks, each exactly once, before anything is written
+func checkChunks(files []FileInfo) error {
+	chunks := make(map[string][]*FileInfo)
+	var order []string
+	for i := range files {
+		f := &files[i]
+		if !f.isChunk {
+			continue
+		}
+		if _, ok := chunks[f.path]; !ok {
+			order = append(order, f.path)
+		}
+		chunks[f.path] = append(chunks[f.path], f)
+	}
+
+	for _, path := range order {
+		if err := checkFileChunks(path, chunks[path]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkFileChunks(path string, chunks []*FileInfo) error {
+	total := chunks[0].chunkTotal
+	byIndex := make(map[int]*FileInfo)
+	for _, c := range chunks {
+		if c.chunkTotal != total {
+			return fmt.Errorf("chunks of %s disagree on the chunk count", path)
+		}
+		if byIndex[c.chunkIndex] != nil {
+			return fmt.Errorf("chunk %d of %s found more than once", c.chunkIndex, path)
+		}
+		byIndex[c.chunkIndex] = c
+	}
+
+	var missing []string
+	for i := 1; i <= total; i++ {
+		if byIndex[i] == nil {
+			missing = append(missing, fmt.Sprint(i))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("file %s is split into %d chunks but chunk(s) %s are missing", path, total, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// chunkWriter writes a file that was split across parts as its chunks are
+// read. The first chunk carries the file's size, hash and metadata.
+type chunkWriter struct {
+	first FileInfo
+	out   io.Writer
+	// The file being written, nil when only verifying
+	file   *os.File
+	hash   hash.Hash
+	next   int
+	offset int64
+}
+
+func newChunkWriter(root *dirWriter, f FileInfo) (*chunkWriter, error) {
+	dir := filepath.Dir(f.path)
+	if dir != "." {
+		if err := root.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("error creating parent directory: %v", err)
+		}
+	}
+	file, err := root.Create(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating file: %v", err)
+	}
+	return &chunkWriter{first: f, out: file, file: file, hash: sha256.New(), next: 1}, nil
+}
+
+// newChunkVerifier checks the chunks of a file, copying them to out instead
+// of writing a file
+func newChunkVerifier(f FileInfo, out io.Writer) *chunkWriter {
+	return &chunkWriter{first: f, out: out, hash: sha256.New(), next: 1}
+}
+
+// write appends one chunk, checking its index, byte offset, size and hash.
+// It reports whether this was the last chunk.
+func (cw *chunkWriter) write(c *FileInfo, content io.Reader) (bool, error) {
+	if c.chunkIndex != cw.next {
+		return false, fmt.Errorf("chunk %d of %s is out of order, expected chunk %d", c.chunkIndex, c.path, cw.next)
+	}
+	if c.chunkOffset != cw.offset {
+		return false, fmt.Errorf("chunk %d of %s starts at byte %d, expected %d", c.chunkIndex, c.path, c.chunkOffset, cw.offset)
+	}
+
+	chunkHash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(cw.out, cw.hash, chunkHash), decodedContent(c, content))
+	if err != nil {
+		return false, fmt.Errorf("chunk %d of %s: %v", c.chunkIndex, c.path, err)
+	}
+	if c.chunkSize != n {
+		return false, fmt.Errorf("chunk %d of %s has %d bytes, expected %d", c.chunkIndex, c.path, n, c.chunkSize)
+	}
+	if c.chunkHash != "" && hex.EncodeToString(chunkHash.Sum(nil)) != c.chunkHash {
+		return false, fmt.Errorf("chunk %d of %s failed hash verification", c.chunkIndex, c.path)
+	}
+
+	cw.offset += n
+	cw.next++
+	return c.chunkIndex == c.chunkTotal, nil
+}
+
+// close finishes the file and reports whether it matches its recorded size
+// and hash
+func (cw *chunkWriter) close() (bool, error) {
+	if cw.file != nil {
+		if err := cw.file.Close(); err != nil {
+			return false, fmt.Errorf("error writing content: %v", err)
+		}
+	}
+	if cw.first.hasSize && cw.offset != cw.first.size {
+		return false, nil
+	}
+	if cw.first.sha256Hash == "" {
+		return true, nil
+	}
+	return hex.EncodeToString(cw.hash.Sum(nil)) == cw.first.sha256Hash, nil
+}
@@ -0,0 +1,112 @@
+package reconstruct
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+)
+
+func TestRoundTripChunkedPartSizes(t *testing.T) {
+	// One long line, so chunks aren't cut short at a newline
+	var text strings.Builder
+	for i := 0; text.Len() < 200*1024; i++ {
+		fmt.Fprintf(&text, "word%d ", i)
+	}
+	binary := make([]byte, 120*1024)
+	for i := range binary {
+		binary[i] = byte(i * 7 % 251)
+	}
+	files := map[string][]byte{
+		"small.txt": []byte("fits in a part\n"),
+		"big.txt":   []byte(text.String()),
+		"big.bin":   binary,
+	}
+
+	const maxOutput = 50 * 1024
+	dir := collectFiles(t, files, func(p *config.Parameters) {
+		p.MaxOutputSize = maxOutput
+		// A long root directory makes for a long part header
+		p.RootLabel = strings.Repeat("projects/", 20) + "src"
+	})
+	parts, err := filepath.Glob(filepath.Join(dir, "src_collated_part*.fb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) < 4 {
+		t.Errorf("got %d parts, want the big files split", len(parts))
+	}
+	for _, part := range parts {
+		info, err := os.Stat(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > maxOutput {
+			t.Errorf("%s: %d bytes, over -out-max %d", filepath.Base(part), info.Size(), maxOutput)
+		}
+	}
+
+	out := filepath.Join(dir, "out")
+	if err := FromFile(filepath.Join(dir, "src_collated_part1.fb"), &config.Parameters{OutputDir: out}); err != nil {
+		t.Fatalf("reconstruct: %v", err)
+	}
+	for name, content := range readFiles(t, out, files) {
+		if !bytes.Equal(content, files[name]) {
+			t.Errorf("%s: got %q, want %q", name, truncate(content), truncate(files[name]))
+		}
+	}
+}
+
+func TestRoundTripMinimumPartSize(t *testing.T) {
+	var text strings.Builder
+	for i := 0; text.Len() < 8*1024; i++ {
+		fmt.Fprintf(&text, "word%d ", i)
+	}
+	binary := make([]byte, 3*1024)
+	for i := range binary {
+		binary[i] = byte(i * 7 % 251)
+	}
+	files := map[string][]byte{
+		"small.txt":      []byte("fits in a part\n"),
+		"pkg/medium.txt": bytes.Repeat([]byte("x"), 700),
+		"pkg/big.txt":    []byte(text.String()),
+		"assets/big.bin": binary,
+	}
+
+	for _, strategy := range []string{"none", "auto", "dictionary"} {
+		t.Run(strategy, func(t *testing.T) {
+			dir := collectFiles(t, files, func(p *config.Parameters) {
+				p.MaxOutputSize = config.MinOutputSize
+				p.EnableCompression = strategy != "none"
+				p.CompressionStrategy = strategy
+			})
+			parts, err := filepath.Glob(filepath.Join(dir, "src_collated_part*.fb"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, part := range parts {
+				info, err := os.Stat(part)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Size() > config.MinOutputSize {
+					t.Errorf("%s: %d bytes, over -out-max %d", filepath.Base(part), info.Size(), config.MinOutputSize)
+				}
+			}
+
+			out := filepath.Join(dir, "out")
+			if err := FromFile(filepath.Join(dir, "src_collated_part1.fb"), &config.Parameters{OutputDir: out}); err != nil {
+				t.Fatalf("reconstruct: %v", err)
+			}
+			for name, content := range readFiles(t, out, files) {
+				if !bytes.Equal(content, files[name]) {
+					t.Errorf("%s: got %q, want %q", name, truncate(content), truncate(files[name]))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package reconstruct
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+	"github.com/jonathanleahy/folder-bundler/internal/fileutils"
+)
+
+// What happens to an entry when the staged tree is merged into the destination
+const (
+	// Not in the destination yet, or the same as what is there
+	actionMove = iota
+	actionReplace
+	actionKeep
+	actionBackup
+)
+
+// mergeStep moves one staged entry into the destination
+type mergeStep struct {
+	path   string
+	action int
+	// Only set for files that differ from the one in the destination
+	conflict bool
+}
+
+// conflictReport lists what -on-conflict did with the files that differed
+type conflictReport struct {
+	replaced []string
+	kept     []string
+	backedUp []string
+}
+
+// planMerge decides what happens to every staged entry under rel. Entries
+// the destination doesn't have are moved in; files and symlinks that differ
+// from the ones there are resolved by policy. A directory in place of a file
+// or the other way round can't be resolved, and with the "fail" policy
+// neither can any other difference; all of them are reported at once.
+// Paths an incremental bundle deletes count as gone already. The "newer"
+// policy goes by the modification times the bundle records in modified.
+func planMerge(stage, dest, rel, policy string, allowUnsafe bool, deleted map[string]bool, modified map[string]time.Time) ([]mergeStep, []string, error) {
+	entries, err := os.ReadDir(filepath.Join(stage, rel))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var steps []mergeStep
+	var conflicts []string
+	for _, e := range entries {
+		path := filepath.Join(rel, e.Name())
+		from, to := filepath.Join(stage, path), filepath.Join(dest, path)
+
+		existing, err := os.Lstat(to)
+		if os.IsNotExist(err) || deleted[path] {
+			steps = append(steps, mergeStep{path: path, action: actionMove})
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if e.IsDir() {
+			if existing.Mode()&os.ModeSymlink != 0 {
+				if !allowUnsafe {
+					return nil, nil, fmt.Errorf("%s would be written through the symlink %s in %s", path, path, dest)
+				}
+				if existing, err = os.Stat(to); err != nil {
+					return nil, nil, err
+				}
+			}
+			if !existing.IsDir() {
+				conflicts = append(conflicts, fmt.Sprintf("%s is a directory in the bundle but not in %s", path, dest))
+				continue
+			}
+			more, moreConflicts, err := planMerge(stage, dest, path, policy, allowUnsafe, deleted, modified)
+			if err != nil {
+				return nil, nil, err
+			}
+			steps = append(steps, more...)
+			conflicts = append(conflicts, moreConflicts...)
+			continue
+		}
+
+		if existing.IsDir() {
+			conflicts = append(conflicts, fmt.Sprintf("%s is a directory in %s but not in the bundle", path, dest))
+			continue
+		}
+		staged, err := os.Lstat(from)
+		if err != nil {
+			return nil, nil, err
+		}
+		same, err := sameEntry(from, to, staged, existing)
+		if err != nil {
+			return nil, nil, err
+		}
+		if same {
+			steps = append(steps, mergeStep{path: path, action: actionReplace})
+			continue
+		}
+
+		step := mergeStep{path: path, conflict: true}
+		switch policy {
+		case "skip":
+			step.action = actionKeep
+		case "backup":
+			step.action = actionBackup
+		case "newer":
+			// The staged copy only has the bundle's time with -time
+			bundled, ok := modified[path]
+			if !ok {
+				bundled = staged.ModTime()
+			}
+			step.action = actionKeep
+			if bundled.After(existing.ModTime()) {
+				step.action = actionReplace
+			}
+		case "fail":
+			conflicts = append(conflicts, fmt.Sprintf("%s differs from the file in %s", path, dest))
+			continue
+		default:
+			step.action = actionReplace
+		}
+		steps = append(steps, step)
+	}
+	return steps, conflicts, nil
+}
+
+// sameEntry reports whether a staged file or symlink has the same content
+// as the one in the destination, comparing SHA-256 hashes when the sizes agree
+func sameEntry(from, to string, staged, existing os.FileInfo) (bool, error) {
+	stagedLink := staged.Mode()&os.ModeSymlink != 0
+	existingLink := existing.Mode()&os.ModeSymlink != 0
+	if stagedLink || existingLink {
+		if !stagedLink || !existingLink {
+			return false, nil
+		}
+		a, err := os.Readlink(from)
+		if err != nil {
+			return false, err
+		}
+		b, err := os.Readlink(to)
+		return a == b, err
+	}
+	if !existing.Mode().IsRegular() || staged.Size() != existing.Size() {
+		return false, nil
+	}
+
+	a, err := fileHash(from)
+	if err != nil {
+		return false, err
+	}
+	b, err := fileHash(to)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(a, b), nil
+}
+
+func fileHash(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+// mergeJournal records every change a merge makes to the destination, so a
+// merge that fails partway can be undone. What a staged entry replaces is
+// moved to the undo directory, next to the destination, instead of removed.
+type mergeJournal struct {
+	stage string
+	dest  string
+	undo  string
+	done  []journalEntry
+}
+
+// journalEntry is one change to the destination
+type journalEntry struct {
+	path string
+	// Where the entry that was at path went: the undo directory or a backup
+	saved string
+	// An empty directory that was removed, and its mode
+	removedDir bool
+	mode       os.FileMode
+	// Set once the staged entry is in place
+	movedIn bool
+}
+
+// move moves a staged entry into place, first saving whatever is there to
+// the undo directory, or to a backup with backup set
+func (j *mergeJournal) move(path string, backup bool) (string, error) {
+	from, to := filepath.Join(j.stage, path), filepath.Join(j.dest, path)
+	entry := journalEntry{path: path}
+	if _, err := os.Lstat(to); err == nil {
+		if backup {
+			saved, err := fileutils.BackupExistingFile(to)
+			if err != nil {
+				return "", fmt.Errorf("error backing up %s: %v", path, err)
+			}
+			entry.saved = saved
+		} else {
+			saved, err := j.stash(path)
+			if err != nil {
+				return "", err
+			}
+			entry.saved = saved
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+	j.done = append(j.done, entry)
+
+	if err := os.Rename(from, to); err != nil {
+		return entry.saved, fmt.Errorf("error moving %s into place: %v", path, err)
+	}
+	j.done[len(j.done)-1].movedIn = true
+	return entry.saved, nil
+}
+
+// remove takes the entry at path out of the destination
+func (j *mergeJournal) remove(path string) error {
+	saved, err := j.stash(path)
+	if err != nil {
+		return err
+	}
+	j.done = append(j.done, journalEntry{path: path, saved: saved})
+	return nil
+}
+
+// stash moves the entry at path in the destination to the undo directory
+func (j *mergeJournal) stash(path string) (string, error) {
+	saved := filepath.Join(j.undo, path)
+	if err := os.MkdirAll(filepath.Dir(saved), 0755); err != nil {
+		return "", fmt.Errorf("error saving %s: %v", path, err)
+	}
+	if err := os.Rename(filepath.Join(j.dest, path), saved); err != nil {
+		return "", fmt.Errorf("error saving %s: %v", path, err)
+	}
+	return saved, nil
+}
+
+// removeDir removes an empty directory from the destination
+func (j *mergeJournal) removeDir(path string, mode os.FileMode) error {
+	if err := os.Remove(filepath.Join(j.dest, path)); err != nil {
+		return err
+	}
+	j.done = append(j.done, journalEntry{path: path, removedDir: true, mode: mode})
+	return nil
+}
+
+// rollback undoes the changes in reverse order: staged entries go back to
+// the staging directory and what they replaced comes back. It returns the
+// paths that couldn't be restored.
+func (j *mergeJournal) rollback() []string {
+	var failed []string
+	for i := len(j.done) - 1; i >= 0; i-- {
+		e := j.done[i]
+		to := filepath.Join(j.dest, e.path)
+		if e.movedIn {
+			if err := os.Rename(to, filepath.Join(j.stage, e.path)); err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %v", e.path, err))
+				continue
+			}
+		}
+		if e.saved != "" {
+			if err := os.Rename(e.saved, to); err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %v", e.path, err))
+			}
+		}
+		if e.removedDir {
+			if err := os.Mkdir(to, e.mode); err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %v", e.path, err))
+				continue
+			}
+			os.Chmod(to, e.mode)
+		}
+	}
+	j.done = nil
+	if len(failed) == 0 {
+		os.RemoveAll(j.undo)
+	}
+	return failed
+}
+
+// finish drops what the merge replaced, once it can no longer be undone
+func (j *mergeJournal) finish() error {
+	j.done = nil
+	if err := os.RemoveAll(j.undo); err != nil {
+		return fmt.Errorf("error removing %s: %v", j.undo, err)
+	}
+	return nil
+}
+
+// applyMerge carries out the steps of a merge plan, recording them in j
+func applyMerge(j *mergeJournal, steps []mergeStep) (*conflictReport, error) {
+	report := &conflictReport{}
+	for _, step := range steps {
+		switch step.action {
+		case actionKeep:
+			report.kept = append(report.kept, step.path)
+			continue
+		case actionBackup:
+			backup, err := j.move(step.path, true)
+			if backup != "" {
+				rel, rerr := filepath.Rel(j.dest, backup)
+				if rerr != nil {
+					rel = backup
+				}
+				report.backedUp = append(report.backedUp, fmt.Sprintf("%s -> %s", step.path, rel))
+			}
+			if err != nil {
+				return report, err
+			}
+			continue
+		case actionReplace:
+			if step.conflict {
+				report.replaced = append(report.replaced, step.path)
+			}
+		}
+		if _, err := j.move(step.path, false); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// print lists every file that differed from the destination and what was
+// done with it
+func (r *conflictReport) print(policy string) {
+	if r == nil || len(r.replaced)+len(r.kept)+len(r.backedUp) == 0 {
+		return
+	}
+	fmt.Printf("\nExisting files that differ (-on-conflict %s):\n", policy)
+	for _, list := range []struct {
+		label string
+		paths []string
+	}{
+		{"Replaced", r.replaced},
+		{"Kept", r.kept},
+		{"Backed up", r.backedUp},
+	} {
+		if len(list.paths) == 0 {
+			continue
+		}
+		fmt.Printf("  %s: %d\n", list.label, len(list.paths))
+		for _, path := range list.paths {
+			fmt.Printf("    - %s\n", path)
+		}
+	}
+}
+
+// conflictPolicy returns the -on-conflict policy, overwrite if none is set
+func conflictPolicy(params *config.Parameters) string {
+	if params.OnConflict == "" {
+		return "overwrite"
+	}
+	return params.OnConflict
+}
+
+// conflictError reports the conflicts that stopped a merge
+func conflictError(conflicts []string, dest string) error {
+	fmt.Printf("\nConflicts:\n")
+	for _, c := range conflicts {
+		fmt.Printf("    - %s\n", c)
+	}
+	return fmt.Errorf("%d entries conflict with %s; nothing was changed there (see -on-conflict)", len(conflicts), dest)
+}
@@ -0,0 +1,106 @@
+package reconstruct
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+)
+
+func TestReconstructConflictPolicies(t *testing.T) {
+	files := map[string][]byte{
+		"same.txt":    []byte("same\n"),
+		"changed.txt": []byte("from the bundle\n"),
+	}
+	dir := collectFiles(t, files, nil)
+	bundlePath := filepath.Join(dir, "src_collated_part1.fb")
+
+	tests := []struct {
+		policy  string
+		changed string
+		backup  bool
+		wantErr string
+	}{
+		{"overwrite", "from the bundle\n", false, ""},
+		{"skip", "local edit\n", false, ""},
+		{"backup", "from the bundle\n", true, ""},
+		{"fail", "local edit\n", false, "conflict"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			out := filepath.Join(dir, "out-"+tt.policy)
+			if err := os.MkdirAll(out, 0755); err != nil {
+				t.Fatal(err)
+			}
+			os.WriteFile(filepath.Join(out, "same.txt"), []byte("same\n"), 0644)
+			os.WriteFile(filepath.Join(out, "changed.txt"), []byte("local edit\n"), 0644)
+
+			err := FromFile(bundlePath, &config.Parameters{OutputDir: out, OnConflict: tt.policy})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, _ := os.ReadFile(filepath.Join(out, "changed.txt")); string(got) != tt.changed {
+				t.Errorf("changed.txt: got %q, want %q", got, tt.changed)
+			}
+			backup, err := os.ReadFile(filepath.Join(out, "changed.txt.bak"))
+			if tt.backup && string(backup) != "local edit\n" {
+				t.Errorf("backup: got %q, %v", backup, err)
+			}
+			if !tt.backup && err == nil {
+				t.Errorf("unexpected backup")
+			}
+		})
+	}
+}
+
+func TestReconstructNewerWithoutTime(t *testing.T) {
+	// Without -time the staged copy is as new as the run, so "newer" has to
+	// go by the time the bundle records
+	recorded := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	dir := collectFiles(t, map[string][]byte{"changed.txt": []byte("from the bundle\n")}, func(p *config.Parameters) {
+		if err := os.Chtimes(filepath.Join(p.RootDir, "changed.txt"), recorded, recorded); err != nil {
+			t.Fatal(err)
+		}
+	})
+	bundlePath := filepath.Join(dir, "src_collated_part1.fb")
+
+	tests := []struct {
+		name  string
+		local time.Time
+		want  string
+	}{
+		{"local is newer", recorded.Add(time.Hour), "local edit\n"},
+		{"bundle is newer", recorded.Add(-time.Hour), "from the bundle\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), "out")
+			if err := os.MkdirAll(out, 0755); err != nil {
+				t.Fatal(err)
+			}
+			local := filepath.Join(out, "changed.txt")
+			if err := os.WriteFile(local, []byte("local edit\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(local, tt.local, tt.local); err != nil {
+				t.Fatal(err)
+			}
+
+			params := &config.Parameters{OutputDir: out, OnConflict: "newer", PreserveTimestamp: false}
+			if err := FromFile(bundlePath, params); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := os.ReadFile(local); string(got) != tt.want {
+				t.Errorf("changed.txt: got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
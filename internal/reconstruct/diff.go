@@ -0,0 +1,393 @@
+package reconstruct
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/jonathanleahy/folder-bundler/internal/collect"
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+	"github.com/jonathanleahy/folder-bundler/internal/fileutils"
+	"github.com/jonathanleahy/folder-bundler/internal/secrets"
+	"github.com/jonathanleahy/folder-bundler/internal/textdiff"
+)
+
+// diffEntry is what is compared of one entry on either side of a diff
+type diffEntry struct {
+	Type   string `json:"type"`
+	Size   int64  `json:"size,omitempty"`
+	Mode   string `json:"mode,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	Target string `json:"target,omitempty"`
+	// Secrets redacted before the content was hashed
+	Redacted int `json:"redacted,omitempty"`
+}
+
+// diffChange is one entry that differs between the two sides
+type diffChange struct {
+	Path   string     `json:"path"`
+	Change string     `json:"change"`
+	Old    *diffEntry `json:"old,omitempty"`
+	New    *diffEntry `json:"new,omitempty"`
+	Patch  string     `json:"patch,omitempty"`
+}
+
+// diffSide is a bundle or a directory being compared
+type diffSide struct {
+	name    string
+	bundle  *bundle
+	dir     string
+	entries map[string]*diffEntry
+	// Redacts directory files as collect -secrets redact would
+	scanner *secrets.Scanner
+}
+
+// Diff compares two bundles, or a bundle and a directory walked as collect
+// would walk it, by SHA-256, and prints the entries that were added, removed,
+// modified, had their mode changed or, for symlinks, were retargeted. With
+// -secrets redact, directory files are redacted before they are hashed, as
+// collect would redact them. With -patch, modified text files are shown as
+// unified diffs. It returns the number of entries that differ.
+func Diff(oldPath, newPath string, params *config.Parameters) (int, error) {
+	oldSide, err := loadDiffSide(oldPath, params)
+	if err != nil {
+		return 0, err
+	}
+	newSide, err := loadDiffSide(newPath, params)
+	if err != nil {
+		return 0, err
+	}
+
+	changes := compareSides(oldSide, newSide)
+	if params.DiffPatch {
+		if err := addPatches(changes, oldSide, newSide); err != nil {
+			return 0, err
+		}
+	}
+
+	if params.JSONOutput {
+		enc := json.NewEncoder(os.Stdout)
+		for _, c := range changes {
+			if err := enc.Encode(c); err != nil {
+				return 0, err
+			}
+		}
+		return len(changes), nil
+	}
+	printChanges(changes, oldSide, newSide)
+	return len(changes), nil
+}
+
+// loadDiffSide reads the entries of a bundle, or of a directory with the
+// collect rules in params
+func loadDiffSide(path string, params *config.Parameters) (*diffSide, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	side := &diffSide{name: path, entries: make(map[string]*diffEntry)}
+	if info.IsDir() {
+		side.dir = path
+		if params.SecretsMode == secrets.ModeRedact {
+			if side.scanner, err = secrets.NewScanner(params.SecretPatterns); err != nil {
+				return nil, err
+			}
+		}
+		return side, collect.Walk(path, params, func(relPath string, info os.FileInfo) error {
+			e, err := side.directoryEntry(relPath, info, params.MaxFileSize)
+			if err != nil {
+				return fmt.Errorf("error reading %s: %v", relPath, err)
+			}
+			side.entries[filepath.ToSlash(relPath)] = e
+			return nil
+		})
+	}
+	return loadBundleSide(path)
+}
+
+// loadBundleSide reads the entries of a bundle
+func loadBundleSide(path string) (*diffSide, error) {
+	b, err := readBundle(path, io.Discard)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+	side := &diffSide{name: path, entries: make(map[string]*diffEntry), bundle: b}
+	unhashed := false
+	for _, f := range b.files {
+		if f.path == "" || f.isDeleted || (f.isChunk && f.chunkIndex != 1) {
+			continue
+		}
+		e := &diffEntry{}
+		switch {
+		case f.isDirectory:
+			e.Type = "dir"
+		case f.isSymlink:
+			e.Type = "symlink"
+			e.Target = f.symlinkTarget
+		case f.isSkipped:
+			e.Type = "skipped"
+			e.Size = f.size
+		default:
+			e.Type = "file"
+			e.Size = f.size
+			e.SHA256 = f.sha256Hash
+			e.Redacted = f.redacted
+			unhashed = unhashed || (e.SHA256 == "" && !f.isChunk)
+		}
+		if f.hasMode {
+			e.Mode = fmt.Sprintf("%04o", f.mode)
+		}
+		side.entries[filepath.ToSlash(f.path)] = e
+	}
+
+	// Bundles written before hashes were recorded are hashed from their content
+	if unhashed {
+		err := b.walk(func(f *FileInfo, content io.Reader) error {
+			e := side.entries[filepath.ToSlash(f.path)]
+			if f.isChunk || e == nil || e.Type != "file" || e.SHA256 != "" {
+				return nil
+			}
+			sum, _, err := copyContent(io.Discard, f, content)
+			e.SHA256 = sum
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", path, err)
+		}
+	}
+	return side, nil
+}
+
+// directoryEntry describes a file on disk the way collect would record it
+func (s *diffSide) directoryEntry(relPath string, info os.FileInfo, maxFileSize int64) (*diffEntry, error) {
+	path := filepath.Join(s.dir, relPath)
+	e := &diffEntry{Mode: fmt.Sprintf("%04o", info.Mode().Perm())}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, err
+		}
+		e.Type, e.Target, e.Mode = "symlink", target, ""
+	case info.IsDir():
+		e.Type = "dir"
+	case info.Size() > maxFileSize:
+		e.Type, e.Size = "skipped", info.Size()
+	case s.scanner != nil:
+		// Redaction needs the whole file, which -max bounds
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		data, e.Redacted = s.redact(relPath, data)
+		hash := sha256.Sum256(data)
+		e.Type, e.Size, e.SHA256 = "file", int64(len(data)), hex.EncodeToString(hash[:])
+	default:
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		hash := sha256.New()
+		size, err := io.Copy(hash, file)
+		if err != nil {
+			return nil, err
+		}
+		e.Type, e.Size, e.SHA256 = "file", size, hex.EncodeToString(hash.Sum(nil))
+	}
+	return e, nil
+}
+
+// redact replaces the secrets in text content when the side has a scanner,
+// and returns the content and the number of secrets replaced
+func (s *diffSide) redact(relPath string, content []byte) ([]byte, int) {
+	if s.scanner == nil || !fileutils.IsTextFile(content) {
+		return content, 0
+	}
+	redacted, findings := s.scanner.Scan(filepath.ToSlash(relPath), string(content), true)
+	if len(findings) == 0 {
+		return content, 0
+	}
+	return []byte(redacted), len(findings)
+}
+
+// compareSides lists the entries that differ, ordered by path
+func compareSides(oldSide, newSide *diffSide) []*diffChange {
+	paths := make(map[string]bool)
+	for path := range oldSide.entries {
+		paths[path] = true
+	}
+	for path := range newSide.entries {
+		paths[path] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	var changes []*diffChange
+	for _, path := range sorted {
+		o, n := oldSide.entries[path], newSide.entries[path]
+		c := &diffChange{Path: path, Old: o, New: n}
+		switch {
+		case o == nil:
+			c.Change = "added"
+		case n == nil:
+			c.Change = "removed"
+		case o.Type != n.Type:
+			c.Change = "modified"
+		case o.Type == "symlink":
+			if o.Target == n.Target {
+				continue
+			}
+			c.Change = "retargeted"
+		case o.Size != n.Size, o.SHA256 != "" && n.SHA256 != "" && o.SHA256 != n.SHA256:
+			c.Change = "modified"
+		case o.Mode != "" && n.Mode != "" && o.Mode != n.Mode:
+			c.Change = "mode"
+		default:
+			continue
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// addPatches adds a unified diff to every modified file, or a note that
+// they differ if either is binary or they are too far apart to diff
+func addPatches(changes []*diffChange, oldSide, newSide *diffSide) error {
+	wanted := make(map[string]bool)
+	for _, c := range changes {
+		if c.Change == "modified" && c.Old.Type == "file" && c.New.Type == "file" {
+			wanted[c.Path] = true
+		}
+	}
+	if len(wanted) == 0 {
+		return nil
+	}
+	oldContent, err := oldSide.contents(wanted)
+	if err != nil {
+		return err
+	}
+	newContent, err := newSide.contents(wanted)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range changes {
+		if !wanted[c.Path] {
+			continue
+		}
+		a, b := oldContent[c.Path], newContent[c.Path]
+		if !fileutils.IsTextFile(a) || !fileutils.IsTextFile(b) {
+			c.Patch = fmt.Sprintf("Binary files a/%s and b/%s differ\n", c.Path, c.Path)
+			continue
+		}
+		patch, err := textdiff.Unified("a/"+c.Path, "b/"+c.Path, string(a), string(b), 3)
+		if err != nil {
+			// Too far apart to diff in reasonable time
+			patch = fmt.Sprintf("Files a/%s and b/%s differ\n", c.Path, c.Path)
+		}
+		c.Patch = patch
+	}
+	return nil
+}
+
+// contents reads the content of the given files
+func (s *diffSide) contents(paths map[string]bool) (map[string][]byte, error) {
+	content := make(map[string][]byte)
+	if s.bundle == nil {
+		for path := range paths {
+			data, err := os.ReadFile(filepath.Join(s.dir, filepath.FromSlash(path)))
+			if err != nil {
+				return nil, err
+			}
+			content[path], _ = s.redact(filepath.FromSlash(path), data)
+		}
+		return content, nil
+	}
+
+	// Chunks of split files arrive in order
+	err := s.bundle.walk(func(f *FileInfo, r io.Reader) error {
+		path := filepath.ToSlash(f.path)
+		if !paths[path] || f.isDirectory || f.isSymlink || f.isSkipped {
+			return nil
+		}
+		var buf bytes.Buffer
+		buf.Write(content[path])
+		if r != nil {
+			if _, err := io.Copy(&buf, decodedContent(f, r)); err != nil {
+				return fmt.Errorf("error reading %s: %v", f.path, err)
+			}
+		}
+		content[path] = buf.Bytes()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", s.name, err)
+	}
+	return content, nil
+}
+
+// printChanges prints one line per change, their patches and a summary
+func printChanges(changes []*diffChange, oldSide, newSide *diffSide) {
+	fmt.Printf("Comparing %s with %s\n", oldSide.name, newSide.name)
+	if len(changes) == 0 {
+		fmt.Printf("\nNo differences\n")
+		return
+	}
+
+	fmt.Printf("\nChanges:\n")
+	counts := make(map[string]int)
+	for _, c := range changes {
+		counts[c.Change]++
+		detail := ""
+		switch c.Change {
+		case "modified":
+			if c.Old.Type != c.New.Type {
+				detail = fmt.Sprintf(" (%s -> %s)", c.Old.Type, c.New.Type)
+			} else if c.Old.Type != "dir" {
+				detail = fmt.Sprintf(" (%s -> %s)", formatSize(c.Old.Size), formatSize(c.New.Size))
+			}
+		case "mode":
+			detail = fmt.Sprintf(" (%s -> %s)", c.Old.Mode, c.New.Mode)
+		case "retargeted":
+			detail = fmt.Sprintf(" (%s -> %s)", c.Old.Target, c.New.Target)
+		}
+		// Redacted content can't match the unredacted file it came from
+		if c.Change == "modified" && c.Old.Type == "file" && c.New.Type == "file" && (c.Old.Redacted > 0) != (c.New.Redacted > 0) {
+			detail += " (secrets redacted on one side only; compare with -secrets redact)"
+		}
+		path := c.Path
+		if (c.Old != nil && c.Old.Type == "dir") || (c.New != nil && c.New.Type == "dir") {
+			path += "/"
+		}
+		fmt.Printf("  %-11s %s%s\n", c.Change, path, detail)
+	}
+
+	for _, c := range changes {
+		if c.Patch != "" {
+			fmt.Printf("\n%s", c.Patch)
+		}
+	}
+
+	fmt.Printf("\nDiff summary:\n")
+	for _, kind := range []struct{ change, label string }{
+		{"added", "Added"},
+		{"removed", "Removed"},
+		{"modified", "Modified"},
+		{"mode", "Mode changed"},
+		{"retargeted", "Symlinks retargeted"},
+	} {
+		if counts[kind.change] > 0 {
+			fmt.Printf("  %s: %d\n", kind.label, counts[kind.change])
+		}
+	}
+}
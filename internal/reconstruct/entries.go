@@ -0,0 +1,371 @@
+package reconstruct
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// readerSize is the read buffer of an entry reader. Content lines longer than
+// this are streamed in pieces, so it bounds memory use, not line length.
+const readerSize = 64 * 1024
+
+// entryReader reads the entries of one part, or of a decompressed bundle,
+// one at a time. The content of the entry last returned by next can be read
+// from content until next is called again; whatever isn't read is skipped.
+type entryReader struct {
+	r *bufio.Reader
+	// Set when reading a part file, so skipped content can be seeked over
+	file     *os.File
+	fileSize int64
+	// Quoted paths were introduced with format 4
+	version int
+	quoted  bool
+
+	// Header fields, known once the first entry has been returned
+	rootDir    string
+	partNumber int
+	manifest   *manifest
+	// Bundle an incremental bundle applies to
+	baseID string
+	// Part being read, when entries of several parts come through one stream
+	partAt func() int
+
+	readingManifest bool
+	// Set after the header of the -git-context diff, which isn't an entry
+	readingGitDiff bool
+	// A line read ahead while looking for the end of an entry
+	pending    string
+	hasPending bool
+
+	// Content of the current entry, and the check that it ended properly
+	content io.Reader
+	finish  func() error
+}
+
+// isEntryHeader reports whether a line starts a new entry, or the git diff
+// section that may follow the last one
+func isEntryHeader(line string) bool {
+	return line == "## Git Diff" ||
+		strings.HasPrefix(line, "## File: ") ||
+		strings.HasPrefix(line, "## File Chunk: ") ||
+		strings.HasPrefix(line, "## Directory: ") ||
+		strings.HasPrefix(line, "## Symlink: ") ||
+		strings.HasPrefix(line, "## Deleted: ")
+}
+
+// entry starts a new entry in the part being read
+func (er *entryReader) entry(f FileInfo) *FileInfo {
+	f.part = er.partNumber
+	if er.partAt != nil {
+		f.part = er.partAt()
+	}
+	return &f
+}
+
+func (er *entryReader) readLine() (string, error) {
+	if er.hasPending {
+		er.hasPending = false
+		return er.pending, nil
+	}
+	return readLine(er.r)
+}
+
+// next returns the next entry, or io.EOF after the last one
+func (er *entryReader) next() (*FileInfo, error) {
+	if err := er.skipContent(); err != nil {
+		return nil, err
+	}
+
+	var current *FileInfo
+	for {
+		// Markers and fields are matched without a trailing carriage return
+		raw, err := er.readLine()
+		if err == io.EOF {
+			if current != nil {
+				return current, nil
+			}
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		line := strings.TrimSuffix(raw, "\r")
+
+		if er.readingManifest {
+			if line == "--- MANIFEST END ---" {
+				er.readingManifest = false
+			} else if err := er.manifest.parseLine(line); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// An entry without content ends where the next one starts
+		if current != nil && isEntryHeader(line) {
+			er.pending, er.hasPending = raw, true
+			return current, nil
+		}
+
+		// Content with a recorded length is read as exactly that many bytes
+		if length, isBase64, ok := parseContentBegin(line); ok {
+			if current == nil && er.readingGitDiff {
+				er.readingGitDiff = false
+				er.startFramed("the git diff", length, strings.HasSuffix(raw, "\r"))
+				if err := er.skipContent(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if current == nil {
+				return nil, fmt.Errorf("file content without a file header")
+			}
+			current.isBase64 = isBase64
+			er.startFramed(current.path, length, strings.HasSuffix(raw, "\r"))
+			return current, nil
+		}
+		if line == "--- FILE CONTENT BEGIN ---" || line == "--- FILE CONTENT BEGIN (BASE64) ---" {
+			if current == nil {
+				return nil, fmt.Errorf("file content without a file header")
+			}
+			current.isBase64 = line == "--- FILE CONTENT BEGIN (BASE64) ---"
+			er.content = newMarkerReader(er.r, current.path, strings.HasSuffix(raw, "\r"))
+			er.finish = nil
+			return current, nil
+		}
+
+		if current == nil {
+			if err := er.parseHeaderLine(line); err != nil {
+				return nil, err
+			}
+		}
+
+		switch {
+		case strings.HasPrefix(line, "## Directory: "):
+			dirPath, _, err := parsePath(strings.TrimPrefix(line, "## Directory: "), er.quoted)
+			if err != nil {
+				return nil, err
+			}
+			if dirPath == "." {
+				dirPath = ""
+			}
+			// Convert forward slashes to OS-specific path separator
+			current = er.entry(FileInfo{
+				path:        filepath.FromSlash(dirPath),
+				isDirectory: true,
+			})
+
+		case strings.HasPrefix(line, "## Symlink: "):
+			// A " (Error reading target...)" suffix is ignored
+			path, _, err := parsePath(strings.TrimPrefix(line, "## Symlink: "), er.quoted)
+			if err != nil {
+				return nil, err
+			}
+			current = er.entry(FileInfo{
+				path:      filepath.FromSlash(path),
+				isSymlink: true,
+			})
+
+		case strings.HasPrefix(line, "## File: "):
+			path, suffix, err := parsePath(strings.TrimPrefix(line, "## File: "), er.quoted)
+			if err != nil {
+				return nil, err
+			}
+			current = er.entry(FileInfo{
+				path:      filepath.FromSlash(path),
+				isSkipped: strings.HasPrefix(suffix, " (Skipped - Size"),
+			})
+			if current.isSkipped {
+				fmt.Sscanf(suffix, " (Skipped - Size %d exceeds max %d)", &current.size, &current.skippedMax)
+			}
+
+		case strings.HasPrefix(line, "## Deleted: "):
+			path, _, err := parsePath(strings.TrimPrefix(line, "## Deleted: "), er.quoted)
+			if err != nil {
+				return nil, err
+			}
+			current = er.entry(FileInfo{
+				path:      filepath.FromSlash(path),
+				isDeleted: true,
+			})
+
+		case strings.HasPrefix(line, "## File Chunk: "):
+			path, _, err := parsePath(strings.TrimPrefix(line, "## File Chunk: "), er.quoted)
+			if err != nil {
+				return nil, err
+			}
+			current = er.entry(FileInfo{
+				path:    filepath.FromSlash(path),
+				isChunk: true,
+			})
+
+		case current != nil:
+			if err := er.parseField(current, line); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// parseHeaderLine reads the part header and the manifest that come before
+// the first entry
+func (er *entryReader) parseHeaderLine(line string) error {
+	switch {
+	case strings.HasPrefix(line, "# Project Files Summary - Part "):
+		fmt.Sscanf(strings.TrimPrefix(line, "# Project Files Summary - Part "), "%d", &er.partNumber)
+
+	case strings.HasPrefix(line, "Parts: "):
+		if er.manifest == nil {
+			er.manifest = &manifest{}
+		}
+		fmt.Sscanf(strings.TrimPrefix(line, "Parts: "), "%d", &er.manifest.parts)
+
+	case line == "--- MANIFEST BEGIN ---":
+		if er.manifest == nil {
+			er.manifest = &manifest{}
+		}
+		er.readingManifest = true
+
+	case line == "## Git Diff":
+		er.readingGitDiff = true
+
+	case strings.HasPrefix(line, "Base Bundle ID: "):
+		er.baseID = strings.TrimPrefix(line, "Base Bundle ID: ")
+
+	case strings.HasPrefix(line, "Root Directory: "):
+		dir, _, err := parsePath(strings.TrimPrefix(line, "Root Directory: "), er.quoted)
+		if err != nil {
+			return err
+		}
+		er.rootDir = dir
+	}
+	return nil
+}
+
+// parseField reads one field line of an entry
+func (er *entryReader) parseField(f *FileInfo, line string) error {
+	switch {
+	case strings.HasPrefix(line, "Chunk: "):
+		if f.isChunk {
+			fmt.Sscanf(strings.TrimPrefix(line, "Chunk: "), "%d of %d", &f.chunkIndex, &f.chunkTotal)
+		}
+
+	case strings.HasPrefix(line, "Offset: "):
+		if f.isChunk {
+			fmt.Sscanf(strings.TrimPrefix(line, "Offset: "), "%d", &f.chunkOffset)
+		}
+
+	case strings.HasPrefix(line, "Chunk Size: "):
+		if f.isChunk {
+			fmt.Sscanf(strings.TrimPrefix(line, "Chunk Size: "), "%d", &f.chunkSize)
+		}
+
+	case strings.HasPrefix(line, "Chunk SHA-256: "):
+		if f.isChunk {
+			f.chunkHash = strings.TrimPrefix(line, "Chunk SHA-256: ")
+		}
+
+	case strings.HasPrefix(line, "Size: "):
+		size := strings.TrimPrefix(line, "Size: ")
+		size = strings.TrimSuffix(size, " bytes")
+		if _, err := fmt.Sscanf(size, "%d", &f.size); err == nil {
+			f.hasSize = true
+		}
+
+	case strings.HasPrefix(line, "SHA-256: "):
+		f.sha256Hash = strings.TrimPrefix(line, "SHA-256: ")
+
+	case strings.HasPrefix(line, "Redacted: "):
+		fmt.Sscanf(strings.TrimPrefix(line, "Redacted: "), "%d secret(s)", &f.redacted)
+
+	case strings.HasPrefix(line, "Base SHA-256: "):
+		f.baseHash = strings.TrimPrefix(line, "Base SHA-256: ")
+
+	case strings.HasPrefix(line, "Last Modified: "):
+		timeStr := strings.TrimPrefix(line, "Last Modified: ")
+		f.lastModified, _ = time.Parse(time.RFC3339, timeStr)
+
+	case strings.HasPrefix(line, "Mode: "):
+		var mode uint32
+		if _, err := fmt.Sscanf(strings.TrimPrefix(line, "Mode: "), "%o", &mode); err == nil {
+			f.mode = os.FileMode(mode).Perm()
+			f.hasMode = true
+		}
+
+	case strings.HasPrefix(line, "Owner: "):
+		if _, err := fmt.Sscanf(strings.TrimPrefix(line, "Owner: "), "%d:%d", &f.uid, &f.gid); err == nil {
+			f.hasOwner = true
+		}
+
+	case strings.HasPrefix(line, "Target: "):
+		if f.isSymlink {
+			target, _, err := parsePath(strings.TrimPrefix(line, "Target: "), er.quoted)
+			if err != nil {
+				return err
+			}
+			f.symlinkTarget = target
+		}
+	}
+	return nil
+}
+
+// startFramed makes content with a recorded length the current content
+func (er *entryReader) startFramed(path string, length int64, crlf bool) {
+	fr := framedReader{r: er.r, path: path, length: length, remaining: length}
+	if crlf {
+		er.content = &crlfFramedReader{fr}
+	} else {
+		er.content = &fr
+	}
+	er.finish = func() error { return finishFramed(er.r, path, length, crlf) }
+}
+
+// skipContent passes over whatever is left of the current entry's content
+// and checks that it ended properly
+func (er *entryReader) skipContent() error {
+	if er.content == nil {
+		return nil
+	}
+	content, finish := er.content, er.finish
+	er.content, er.finish = nil, nil
+
+	if fr, ok := content.(*framedReader); ok && er.file != nil {
+		if err := er.seek(fr); err != nil {
+			return err
+		}
+	} else if _, err := io.Copy(io.Discard, content); err != nil {
+		return err
+	}
+	if finish != nil {
+		return finish()
+	}
+	return nil
+}
+
+// seek skips the rest of framed content without reading it
+func (er *entryReader) seek(fr *framedReader) error {
+	if fr.remaining <= int64(er.r.Buffered()) {
+		_, err := er.r.Discard(int(fr.remaining))
+		fr.remaining = 0
+		return err
+	}
+
+	pos, err := er.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	pos += fr.remaining - int64(er.r.Buffered())
+	if pos > er.fileSize {
+		return fr.shortError()
+	}
+	if _, err := er.file.Seek(pos, io.SeekStart); err != nil {
+		return err
+	}
+	er.r.Reset(er.file)
+	fr.remaining = 0
+	return nil
+}
@@ -0,0 +1,84 @@
+package reconstruct
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// readEntries streams the entries of bundle content and returns the content
+// of each entry by path
+func readEntries(t *testing.T, content string) map[string]string {
+	t.Helper()
+
+	entries := make(map[string]string)
+	_, err := source{name: "test", content: []byte(content)}.entries(func(f *FileInfo, r io.Reader) error {
+		var data []byte
+		if r != nil {
+			var err error
+			if data, err = io.ReadAll(r); err != nil {
+				return err
+			}
+		}
+		entries[f.path] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestParseLongLines(t *testing.T) {
+	// Lines around the read buffer size, in both the marker and the length
+	// format, with and without a CRLF conversion of the bundle
+	for _, n := range []int{readerSize - 2, readerSize - 1, readerSize, readerSize + 1, 3*readerSize + 7} {
+		line := strings.Repeat("x", n)
+		want := line + "\r\n" + line
+
+		marker := "# Project Files Summary - Part 1\n\nRoot Directory: x\n\n---\n\n" +
+			"## File: a.txt\n\n--- FILE CONTENT BEGIN ---\n" + want + "\n@CONTENT-END@\n--- FILE CONTENT END ---\n"
+		framed := fmt.Sprintf("# folder-bundle format: 4\n# Project Files Summary - Part 1\n\nRoot Directory: x\n\n---\n\n"+
+			"## File: a.txt\n\n--- FILE CONTENT BEGIN (%d bytes) ---\n%s\n--- FILE CONTENT END ---\n", len(want), want)
+		if got := readEntries(t, marker)["a.txt"]; got != want {
+			t.Errorf("marker format, %d byte lines: got %d bytes", n, len(got))
+		}
+		if got := readEntries(t, framed)["a.txt"]; got != want {
+			t.Errorf("length format, %d byte lines: got %d bytes", n, len(got))
+		}
+
+		// A CRLF conversion can't be told apart from CRLF content
+		want = line + "\n" + line
+		crlf := strings.ReplaceAll(strings.ReplaceAll(marker, "\r\n", "\n"), "\n", "\r\n")
+		if got := readEntries(t, crlf)["a.txt"]; got != want {
+			t.Errorf("CRLF marker format, %d byte lines: got %d bytes", n, len(got))
+		}
+	}
+}
+
+func TestParseSkipsGitDiff(t *testing.T) {
+	// The -git-context diff holds lines that look like markers
+	patch := "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-- FILE CONTENT END ---\n+## File: fake.txt\n"
+	bundle := "# folder-bundle format: 4\n# Project Files Summary - Part 1\n\nRoot Directory: x\n\n" +
+		"## Git Diff\n\nRange: main..HEAD\n\nContext Lines: 3\n\n" +
+		fmt.Sprintf("--- FILE CONTENT BEGIN (%d bytes) ---\n%s\n--- FILE CONTENT END ---\n\n---\n\n", len(patch), patch) +
+		"## File: a.txt\n\n--- FILE CONTENT BEGIN (4 bytes) ---\none\n\n--- FILE CONTENT END ---\n"
+	got := readEntries(t, bundle)
+	if len(got) != 1 || got["a.txt"] != "one\n" {
+		t.Errorf("got %q", got)
+	}
+
+	// Bundles now end with the diff, in as many pieces as the parts need
+	bundle = "# folder-bundle format: 4\n# Project Files Summary - Part 1\n\nRoot Directory: x\n\n---\n\n" +
+		"## Directory: docs\n\n" +
+		"## File: a.txt\n\n--- FILE CONTENT BEGIN (4 bytes) ---\none\n\n--- FILE CONTENT END ---\n\n"
+	for i := 1; i <= 2; i++ {
+		bundle += fmt.Sprintf("## Git Diff\n\nRange: main..HEAD\n\nContext Lines: 3\n\nPiece: %d of 2\n\n", i) +
+			fmt.Sprintf("--- FILE CONTENT BEGIN (%d bytes) ---\n%s\n--- FILE CONTENT END ---\n\n", len(patch), patch)
+	}
+	got = readEntries(t, bundle)
+	if len(got) != 2 || got["a.txt"] != "one\n" {
+		t.Errorf("got %q", got)
+	}
+}
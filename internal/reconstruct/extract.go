@@ -0,0 +1,212 @@
+package reconstruct
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+	"github.com/jonathanleahy/folder-bundler/internal/glob"
+)
+
+// Extract reconstructs only the entries of a bundle that match one of
+// patterns, paths or globs relative to the bundle root. A pattern that
+// matches a directory selects everything below it. Entries are written like
+// reconstruct writes them, or with -stdout the content of the matching
+// files is written to standard output, one after another.
+func Extract(inputFile string, patterns []string, params *config.Parameters) error {
+	for _, pattern := range patterns {
+		if err := glob.Validate(pattern); err != nil {
+			return fmt.Errorf("invalid pattern '%s': %v", pattern, err)
+		}
+	}
+
+	// Standard output is for file content only
+	log := io.Writer(os.Stdout)
+	if params.ExtractStdout {
+		log = os.Stderr
+	}
+	fmt.Fprintf(log, "Extracting from: %s\n", inputFile)
+
+	b, err := readBundle(inputFile, log)
+	if err != nil {
+		return err
+	}
+	matched := b.selectEntries(patterns)
+	if matched == 0 {
+		return fmt.Errorf("no entries match %s", strings.Join(patterns, ", "))
+	}
+	fmt.Fprintf(log, "Selected %d of the bundle's entries\n", matched)
+
+	if params.ExtractStdout {
+		return extractToWriter(b, os.Stdout)
+	}
+	return reconstructBundle(b, params)
+}
+
+// selectEntries narrows the bundle to the entries that match one of
+// patterns or are below a directory that does, and the directories that
+// contain them. It returns how many entries matched.
+func (b *bundle) selectEntries(patterns []string) int {
+	b.selected = make(map[string]bool)
+	matched := 0
+	for _, f := range b.files {
+		path := filepath.ToSlash(f.path)
+		if path == "" || b.selected[f.path] {
+			continue
+		}
+		if !selects(patterns, path) {
+			continue
+		}
+		b.selected[f.path] = true
+		matched++
+		for dir := filepath.Dir(f.path); dir != "."; dir = filepath.Dir(dir) {
+			b.selected[dir] = true
+		}
+	}
+	b.selected[""] = true
+
+	var files []FileInfo
+	for _, f := range b.files {
+		if b.selected[f.path] {
+			files = append(files, f)
+		}
+	}
+	b.files = files
+	return matched
+}
+
+// selects reports whether one of patterns matches a slash-separated entry
+// path or one of the directories it is in
+func selects(patterns []string, path string) bool {
+	parts := strings.Split(path, "/")
+	for i := len(parts); i > 0; i-- {
+		dir := strings.Join(parts[:i], "/")
+		for _, pattern := range patterns {
+			if glob.Match(pattern, dir) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// extractToWriter writes the content of the selected files to w in bundle
+// order. Each file is staged in a temporary file first and only copied to w
+// once its size and hash match what the bundle records, so a corrupt file is
+// never written. Directories, symlinks and skipped files have no content and
+// are left out.
+func extractToWriter(b *bundle, w io.Writer) error {
+	out := bufio.NewWriter(w)
+	var failed []string
+
+	// Chunks of split files arrive in order, each file staged on its own
+	staged := make(map[string]*stagedContent)
+	defer func() {
+		for _, sc := range staged {
+			sc.remove()
+		}
+	}()
+	emit := func(sc *stagedContent, path string, ok bool) error {
+		delete(staged, path)
+		defer sc.remove()
+		if !ok {
+			failed = append(failed, path)
+			return nil
+		}
+		return sc.copyTo(out)
+	}
+
+	err := b.walk(func(f *FileInfo, content io.Reader) error {
+		switch {
+		case f.isDirectory, f.isDeleted:
+			// Nothing to write
+
+		case f.isSymlink:
+			fmt.Fprintf(os.Stderr, "  Skipping symlink: %s -> %s\n", f.path, f.symlinkTarget)
+
+		case f.isSkipped:
+			fmt.Fprintf(os.Stderr, "  Skipping %s: it was too large to be collected\n", f.path)
+
+		case f.isChunk:
+			sc := staged[f.path]
+			if sc == nil {
+				var err error
+				if sc, err = newStagedContent(); err != nil {
+					return err
+				}
+				sc.chunks = newChunkVerifier(*f, sc.file)
+				staged[f.path] = sc
+			}
+			last, err := sc.chunks.write(f, content)
+			if err != nil || !last {
+				return err
+			}
+			ok, err := sc.chunks.close()
+			if err != nil {
+				return err
+			}
+			return emit(sc, f.path, ok)
+
+		default:
+			sc, err := newStagedContent()
+			if err != nil {
+				return err
+			}
+			staged[f.path] = sc
+			sum, size, err := copyContent(sc.file, f, content)
+			if err != nil {
+				return fmt.Errorf("error extracting file %s: %v", f.path, err)
+			}
+			ok := (!f.hasSize || size == f.size) && (f.sha256Hash == "" || sum == f.sha256Hash)
+			return emit(sc, f.path, ok)
+		}
+		return nil
+	})
+	if err == nil {
+		err = out.Flush()
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(failed) > 0 {
+		for _, path := range failed {
+			fmt.Fprintf(os.Stderr, "  Failed size or hash verification, not written: %s\n", path)
+		}
+		return fmt.Errorf("%d file(s) failed verification", len(failed))
+	}
+	return nil
+}
+
+// stagedContent holds the content of one file in a temporary file until it
+// has been verified
+type stagedContent struct {
+	file   *os.File
+	chunks *chunkWriter
+}
+
+func newStagedContent() (*stagedContent, error) {
+	file, err := os.CreateTemp("", "bundler-extract-*")
+	if err != nil {
+		return nil, fmt.Errorf("error staging extracted content: %v", err)
+	}
+	return &stagedContent{file: file}, nil
+}
+
+// copyTo writes the staged content to w
+func (sc *stagedContent) copyTo(w io.Writer) error {
+	if _, err := sc.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("error reading staged content: %v", err)
+	}
+	_, err := io.Copy(w, sc.file)
+	return err
+}
+
+func (sc *stagedContent) remove() {
+	sc.file.Close()
+	os.Remove(sc.file.Name())
+}
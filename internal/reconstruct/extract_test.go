@@ -0,0 +1,104 @@
+package reconstruct
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+)
+
+func TestExtract(t *testing.T) {
+	files := map[string][]byte{
+		"cmd/server/main.go": []byte("package main\n"),
+		"cmd/tool/main.go":   []byte("package main // tool\n"),
+		"docs/logo.png":      {0x89, 'P', 'N', 'G', 0, 0xff},
+		"README.md":          []byte("# readme\n"),
+	}
+	for _, compress := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compress=%v", compress), func(t *testing.T) {
+			dir := collectFiles(t, files, func(p *config.Parameters) {
+				p.EnableCompression = compress
+				p.CompressionStrategy = "auto"
+			})
+			bundlePath := filepath.Join(dir, "src_collated_part1.fb")
+			out := filepath.Join(dir, "out")
+			params := &config.Parameters{OutputDir: out}
+			if err := Extract(bundlePath, []string{"cmd/server/main.go", "docs"}, params); err != nil {
+				t.Fatalf("extract: %v", err)
+			}
+			for name, want := range files {
+				got, err := os.ReadFile(filepath.Join(out, name))
+				selected := name == "cmd/server/main.go" || name == "docs/logo.png"
+				switch {
+				case selected && !bytes.Equal(got, want):
+					t.Errorf("%s: got %q, want %q (%v)", name, got, want, err)
+				case !selected && err == nil:
+					t.Errorf("%s was extracted", name)
+				}
+			}
+
+			// The same files, one after another
+			b, err := readBundle(bundlePath, io.Discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.selectEntries([]string{"**/main.go"})
+			var buf bytes.Buffer
+			if err := extractToWriter(b, &buf); err != nil {
+				t.Fatal(err)
+			}
+			if want := "package main\npackage main // tool\n"; buf.String() != want {
+				t.Errorf("stdout: got %q, want %q", buf.String(), want)
+			}
+		})
+	}
+}
+
+func TestExtractToWriterHoldsBackCorruptFiles(t *testing.T) {
+	files := map[string][]byte{
+		"a.txt": []byte("first file\n"),
+		"b.txt": []byte("second file\n"),
+	}
+	dir := collectFiles(t, files, nil)
+	bundlePath := filepath.Join(dir, "src_collated_part1.fb")
+	original, err := os.ReadFile(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, corrupt := range map[string]func([]byte) []byte{
+		"hash": func(b []byte) []byte {
+			return bytes.Replace(b, []byte("second file\n"), []byte("SECOND FILE\n"), 1)
+		},
+		"size": func(b []byte) []byte {
+			return bytes.Replace(b, []byte("Size: 12 bytes"), []byte("Size: 13 bytes"), 1)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			corrupted := corrupt(original)
+			if bytes.Equal(corrupted, original) {
+				t.Fatal("bundle was not corrupted")
+			}
+			if err := os.WriteFile(bundlePath, corrupted, 0644); err != nil {
+				t.Fatal(err)
+			}
+			b, err := readBundle(bundlePath, io.Discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.selectEntries([]string{"*.txt"})
+			var buf bytes.Buffer
+			if err := extractToWriter(b, &buf); err == nil {
+				t.Error("extract of a corrupt file succeeded")
+			}
+			// The good file is written, the corrupt one never is
+			if want := "first file\n"; buf.String() != want {
+				t.Errorf("stdout: got %q, want %q", buf.String(), want)
+			}
+		})
+	}
+}
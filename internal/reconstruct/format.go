@@ -0,0 +1,79 @@
+package reconstruct
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+)
+
+// oldestFormat is the oldest format version this version can read
+const oldestFormat = 3
+
+// formatReader returns a reader for the entries of a part written in one
+// format version
+type formatReader func(r *bufio.Reader) *entryReader
+
+// formatReaders holds a reader for every format this version can read.
+// Format 3 covers bundles from v3.0 to v3.3: content between marker lines
+// and plain paths. Format 4 frames content by its length and quotes paths
+// that can't be written as plain text.
+var formatReaders = map[int]formatReader{
+	3: func(r *bufio.Reader) *entryReader { return &entryReader{r: r, version: 3} },
+	4: func(r *bufio.Reader) *entryReader { return &entryReader{r: r, version: 4, quoted: true} },
+}
+
+// newEntryReader returns the reader for a part's format version, which
+// parseFormatLine has checked is one in formatReaders
+func newEntryReader(r *bufio.Reader, version int) *entryReader {
+	return formatReaders[version](r)
+}
+
+// parseFormatLine returns the version a format line declares
+func parseFormatLine(line string) (int, error) {
+	value := strings.TrimSpace(strings.TrimPrefix(line, config.FormatLinePrefix))
+	version, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid format line: %q", line)
+	}
+	if formatReaders[version] == nil {
+		if version > config.FormatVersion {
+			return 0, fmt.Errorf("bundle format %d is newer than this folder-bundler (v%s reads formats %d to %d); install a newer release to read it",
+				version, config.Version, oldestFormat, config.FormatVersion)
+		}
+		return 0, fmt.Errorf("bundle format %d is not supported", version)
+	}
+	return version, nil
+}
+
+// splitFormatLine separates the format version line from the rest of a
+// part. Parts without one are format 3.
+func splitFormatLine(content []byte) (int, []byte, error) {
+	if !bytes.HasPrefix(content, []byte(config.FormatLinePrefix)) {
+		return 3, content, nil
+	}
+
+	line, rest, _ := bytes.Cut(content, []byte("\n"))
+	version, err := parseFormatLine(string(line))
+	if err != nil {
+		return 0, nil, err
+	}
+	return version, rest, nil
+}
+
+// readFormatLine reads the format version line at the start of r, if there
+// is one. Parts without one are format 3.
+func readFormatLine(r *bufio.Reader) (int, error) {
+	prefix, _ := r.Peek(len(config.FormatLinePrefix))
+	if string(prefix) != config.FormatLinePrefix {
+		return 3, nil
+	}
+	line, err := readLine(r)
+	if err != nil {
+		return 0, err
+	}
+	return parseFormatLine(line)
+}
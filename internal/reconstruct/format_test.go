@@ -0,0 +1,172 @@
+package reconstruct
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+)
+
+func TestSplitFormatLine(t *testing.T) {
+	tests := []struct {
+		content string
+		version int
+		wantErr string
+	}{
+		{"# Project Files Summary - Part 1\n", 3, ""},
+		{"# folder-bundle format: 4\n# Project Files Summary - Part 1\n", 4, ""},
+		{"# folder-bundle format: 4\r\n# Compression: none\n", 4, ""},
+		{"# folder-bundle format: 99\n", 0, "newer than this folder-bundler"},
+		{"# folder-bundle format: 2\n", 0, "is not supported"},
+		{"# folder-bundle format: x\n", 0, "invalid format line"},
+	}
+
+	for _, tt := range tests {
+		version, _, err := splitFormatLine([]byte(tt.content))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%q: got error %v, want %q", tt.content, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || version != tt.version {
+			t.Errorf("%q: got %d, %v, want %d", tt.content, version, err, tt.version)
+		}
+	}
+}
+
+func TestFormatReaders(t *testing.T) {
+	// Every format up to the one collect writes needs a reader
+	for version := oldestFormat; version <= config.FormatVersion; version++ {
+		if formatReaders[version] == nil {
+			t.Errorf("no reader for format %d", version)
+		}
+	}
+}
+
+func TestUpgradeFormat3(t *testing.T) {
+	dir := t.TempDir()
+	bundlePath := filepath.Join(dir, "app_collated_part1.fb")
+
+	// As written by v3.3, including a content line that looks like a v4 marker
+	v3 := "# Project Files Summary - Part 1\n\nGenerated on: 2024-01-01T00:00:00Z\n\nRoot Directory: app\n\n---\n\n" +
+		"## Directory: docs\n\n" +
+		"## File: docs/big.bin (Skipped - Size 5000000 exceeds max 1048576)\n\n" +
+		"## File: docs/\"quoted\".md\n\nSize: 36 bytes\n\nSHA-256: 3c1b1bc4bc0c5e5bd2b2d2a05b16c7cb81cf8dbf18d9f0be6f6a2d0e1c4e0b6b\n\n" +
+		"Last Modified: 2024-01-01T00:00:00Z\n\n--- FILE CONTENT BEGIN ---\n--- FILE CONTENT BEGIN (9 bytes) ---\n@CONTENT-END@\n--- FILE CONTENT END ---\n\n"
+	if err := os.WriteFile(bundlePath, []byte(v3), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The hash above is made up, so the upgrade must refuse the bundle
+	if err := Upgrade(bundlePath, &config.Parameters{MaxOutputSize: 1 << 20}); err == nil ||
+		!strings.Contains(err.Error(), "fails verification") {
+		t.Fatalf("damaged bundle: got error %v", err)
+	}
+
+	v3 = strings.Replace(v3, "SHA-256: 3c1b1bc4bc0c5e5bd2b2d2a05b16c7cb81cf8dbf18d9f0be6f6a2d0e1c4e0b6b\n\n", "", 1)
+	if err := os.WriteFile(bundlePath, []byte(v3), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Upgrade(bundlePath, &config.Parameters{MaxOutputSize: 1 << 20}); err != nil {
+		t.Fatalf("upgrade: %v", err)
+	}
+
+	content, err := os.ReadFile(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(content), config.FormatLine()) {
+		t.Fatalf("upgraded bundle does not start with the format line:\n%s", content)
+	}
+	// The skipped file is carried over as it was recorded
+	if !strings.Contains(string(content), "## File: docs/big.bin (Skipped - Size 5000000 exceeds max 1048576)\n") ||
+		!strings.Contains(string(content), "skipped\t5000000\t-\t-\t1\tdocs/big.bin\n") {
+		t.Errorf("upgraded bundle lost the skipped file:\n%s", content)
+	}
+
+	b, err := readBundle(bundlePath, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.format != config.FormatVersion || b.rootDir != "app" {
+		t.Errorf("got format %d, root %q", b.format, b.rootDir)
+	}
+
+	if err := FromFile(bundlePath, &config.Parameters{OutputDir: filepath.Join(dir, "out")}); err != nil {
+		t.Fatalf("reconstruct: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "out", "docs", `"quoted".md`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "--- FILE CONTENT BEGIN (9 bytes) ---" {
+		t.Errorf("content: got %q", got)
+	}
+}
+
+func TestUpgradeReplacesParts(t *testing.T) {
+	dir := t.TempDir()
+	old := map[string]string{
+		"app_collated_part1.fb": "# Project Files Summary - Part 1\n\nRoot Directory: app\n\n---\n\n" +
+			"## File: a.txt\n\n--- FILE CONTENT BEGIN ---\none\n@CONTENT-END@\n--- FILE CONTENT END ---\n\n",
+		"app_collated_part2.fb": "# Project Files Summary - Part 2\n\nRoot Directory: app\n\n---\n\n" +
+			"## File: b.txt\n\n--- FILE CONTENT BEGIN ---\ntwo\n@CONTENT-END@\n--- FILE CONTENT END ---\n\n",
+	}
+	for name, content := range old {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bundlePath := filepath.Join(dir, "app_collated_part1.fb")
+	names := func() []string {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		return names
+	}
+
+	// A collection that fails leaves the old bundle as it was
+	blocker := filepath.Join(dir, "app_collated.upgrade_part1.fb.tmp")
+	if err := os.Mkdir(blocker, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := Upgrade(bundlePath, &config.Parameters{MaxOutputSize: 1 << 20}); err == nil {
+		t.Fatal("upgrade succeeded without room for its parts")
+	}
+	for name, content := range old {
+		if got, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(got) != content {
+			t.Errorf("%s was changed: %v", name, err)
+		}
+	}
+	if got := names(); len(got) != 3 {
+		t.Errorf("failed upgrade left %v", got)
+	}
+	if err := os.Remove(blocker); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both files fit in one new part, and the old part 2 is removed
+	if err := Upgrade(bundlePath, &config.Parameters{MaxOutputSize: 1 << 20}); err != nil {
+		t.Fatalf("upgrade: %v", err)
+	}
+	if got := names(); len(got) != 1 || got[0] != "app_collated_part1.fb" {
+		t.Errorf("after upgrade: got %v, want app_collated_part1.fb", got)
+	}
+	if err := FromFile(bundlePath, &config.Parameters{OutputDir: filepath.Join(dir, "out")}); err != nil {
+		t.Fatalf("reconstruct: %v", err)
+	}
+	for name, want := range map[string]string{"a.txt": "one", "b.txt": "two"} {
+		if got, err := os.ReadFile(filepath.Join(dir, "out", name)); err != nil || string(got) != want {
+			t.Errorf("%s: got %q, %v", name, got, err)
+		}
+	}
+}
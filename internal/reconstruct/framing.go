@@ -0,0 +1,248 @@
+package reconstruct
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// contentBegin matches the content marker of the length-prefixed format. The
+// older marker format has no length and is read up to its end marker instead.
+var contentBegin = regexp.MustCompile(`^--- FILE CONTENT BEGIN \((BASE64, )?(\d+) bytes\) ---$`)
+
+// pathSuffixes are the notes the collector appends to unquoted entry paths
+var pathSuffixes = []string{" (Skipped - Size", " (Error reading target"}
+
+// readLine reads one line without its trailing '\n'. It returns io.EOF only
+// when there is nothing left to read.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err == io.EOF {
+		if line == "" {
+			return "", io.EOF
+		}
+		return line, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return line[:len(line)-1], nil
+}
+
+// parseContentBegin recognises a length-prefixed content marker
+func parseContentBegin(line string) (length int64, isBase64 bool, ok bool) {
+	m := contentBegin.FindStringSubmatch(line)
+	if m == nil {
+		return 0, false, false
+	}
+	length, err := strconv.ParseInt(m[2], 10, 64)
+	if err != nil {
+		return 0, false, false
+	}
+	return length, m[1] != "", true
+}
+
+// framedReader reads content with a recorded length
+type framedReader struct {
+	r         *bufio.Reader
+	path      string
+	length    int64
+	remaining int64
+}
+
+func (fr *framedReader) Read(p []byte) (int, error) {
+	if fr.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > fr.remaining {
+		p = p[:fr.remaining]
+	}
+	n, err := fr.r.Read(p)
+	fr.remaining -= int64(n)
+	if err == io.EOF {
+		return n, fr.shortError()
+	}
+	return n, err
+}
+
+func (fr *framedReader) shortError() error {
+	return fmt.Errorf("content of %s is shorter than its recorded %d bytes", fr.path, fr.length)
+}
+
+// crlfFramedReader reads content with a recorded length from a bundle that
+// was converted to CRLF. The recorded length counts the original LF line
+// endings, so the carriage returns added before them are dropped.
+type crlfFramedReader struct {
+	framedReader
+}
+
+func (cr *crlfFramedReader) Read(p []byte) (int, error) {
+	if cr.remaining <= 0 {
+		return 0, io.EOF
+	}
+	n := 0
+	for n < len(p) && cr.remaining > 0 {
+		c, err := cr.r.ReadByte()
+		if err != nil {
+			return n, cr.shortError()
+		}
+		if c == '\r' {
+			if next, err := cr.r.Peek(1); err == nil && next[0] == '\n' {
+				continue
+			}
+		}
+		p[n] = c
+		n++
+		cr.remaining--
+	}
+	return n, nil
+}
+
+// finishFramed checks that the end marker follows content with a recorded length
+func finishFramed(r *bufio.Reader, path string, length int64, crlf bool) error {
+	blank, err := readLine(r)
+	if crlf {
+		blank = strings.TrimSuffix(blank, "\r")
+	}
+	if err != nil || blank != "" {
+		return fmt.Errorf("content of %s does not match its recorded length of %d bytes", path, length)
+	}
+	end, err := readLine(r)
+	if err != nil || strings.TrimSuffix(end, "\r") != "--- FILE CONTENT END ---" {
+		return fmt.Errorf("content of %s is not followed by its end marker", path)
+	}
+	return nil
+}
+
+// markerReader reads content in the older marker format, up to the end
+// marker line. Lines are joined with '\n' and the newline before the marker
+// is not part of the content. Lines longer than the read buffer are passed
+// through in pieces; they can't be a marker.
+type markerReader struct {
+	r    *bufio.Reader
+	path string
+	// Set when the bundle was converted to CRLF, so the carriage return
+	// ending each line is dropped
+	crlf bool
+
+	buf         []byte
+	atLineStart bool
+	firstLine   bool
+	heldCR      bool
+	done        bool
+}
+
+func newMarkerReader(r *bufio.Reader, path string, crlf bool) *markerReader {
+	return &markerReader{r: r, path: path, crlf: crlf, atLineStart: true, firstLine: true}
+}
+
+func (mr *markerReader) Read(p []byte) (int, error) {
+	for len(mr.buf) == 0 {
+		if mr.done {
+			return 0, io.EOF
+		}
+		if err := mr.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, mr.buf)
+	mr.buf = mr.buf[n:]
+	return n, nil
+}
+
+// fill reads the next line, or the next piece of a long line
+func (mr *markerReader) fill() error {
+	slice, err := mr.r.ReadSlice('\n')
+	if err == io.EOF && len(slice) == 0 {
+		return fmt.Errorf("content of %s is not followed by its end marker", mr.path)
+	}
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return err
+	}
+
+	// slice is only valid until the next read
+	mr.buf = mr.buf[:0]
+	if err == bufio.ErrBufferFull {
+		if mr.atLineStart {
+			mr.startLine()
+		}
+		mr.atLineStart = false
+		mr.releaseCR(slice)
+		if mr.crlf && slice[len(slice)-1] == '\r' {
+			// It may end the line
+			mr.buf = append(mr.buf, slice[:len(slice)-1]...)
+			mr.heldCR = true
+			return nil
+		}
+		mr.buf = append(mr.buf, slice...)
+		return nil
+	}
+
+	body := strings.TrimSuffix(string(slice), "\n")
+	trimmed := strings.TrimSuffix(body, "\r")
+	if mr.atLineStart {
+		if trimmed == "--- FILE CONTENT END ---" {
+			mr.done = true
+			return nil
+		}
+		if trimmed == "@CONTENT-END@" {
+			// Our content end marker isn't part of the content
+			return nil
+		}
+		mr.startLine()
+	}
+	if mr.heldCR && body != "" {
+		mr.buf = append(mr.buf, '\r')
+	}
+	mr.heldCR = false
+	if mr.crlf {
+		body = trimmed
+	}
+	mr.buf = append(mr.buf, body...)
+	mr.atLineStart = true
+	return nil
+}
+
+// startLine separates a new content line from the one before it
+func (mr *markerReader) startLine() {
+	if !mr.firstLine {
+		mr.buf = append(mr.buf, '\n')
+	}
+	mr.firstLine = false
+}
+
+// releaseCR passes on a carriage return held back from the previous piece of
+// a long line, now that it is known not to end the line
+func (mr *markerReader) releaseCR(next []byte) {
+	if mr.heldCR && len(next) > 0 {
+		mr.buf = append(mr.buf, '\r')
+	}
+	mr.heldCR = false
+}
+
+// parsePath reads an entry path, either quoted (as format 4 writes paths
+// with newlines, control characters or surrounding spaces) or as plain text,
+// and returns any note that follows it
+func parsePath(s string, quoted bool) (path, suffix string, err error) {
+	if quoted && strings.HasPrefix(s, `"`) {
+		quoted, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid quoted path %s: %v", s, err)
+		}
+		path, err = strconv.Unquote(quoted)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid quoted path %s: %v", s, err)
+		}
+		return path, s[len(quoted):], nil
+	}
+
+	for _, note := range pathSuffixes {
+		if idx := strings.Index(s, note); idx != -1 {
+			return s[:idx], s[idx:], nil
+		}
+	}
+	return s, "", nil
+}
@@ -0,0 +1,206 @@
+package reconstruct
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/jonathanleahy/folder-bundler/internal/collect"
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+)
+
+// ReadBase reads the bundle an incremental collect is made against, which
+// must be a full bundle with a bundle ID
+func ReadBase(path string) (*collect.Base, error) {
+	side, err := loadBundleSide(path)
+	if err != nil {
+		return nil, err
+	}
+	b := side.bundle
+	switch {
+	case b.baseID != "":
+		return nil, fmt.Errorf("%s is itself an incremental bundle; collect against a full bundle", path)
+	case b.id == "":
+		return nil, fmt.Errorf("%s has no bundle ID; run upgrade on it first", path)
+	}
+
+	base := &collect.Base{ID: b.id, Entries: make(map[string]collect.BaseEntry)}
+	for p, e := range side.entries {
+		base.Entries[p] = collect.BaseEntry{Kind: e.Type, Size: e.Size, Hash: e.SHA256, Mode: e.Mode, Target: e.Target}
+	}
+	return base, nil
+}
+
+// incrementalBase prepares reconstructing an incremental bundle. With -base
+// it reads the base bundle, which must be the one the incremental bundle
+// was collected against, to be reconstructed first. Otherwise the bundle is
+// applied to the tree already in dest, which must match the base bundle.
+func incrementalBase(b *bundle, dest string, params *config.Parameters) (*bundle, error) {
+	if b.baseID == "" {
+		if params.Base != "" {
+			return nil, fmt.Errorf("-base only applies to incremental bundles")
+		}
+		return nil, nil
+	}
+	fmt.Printf("  Incremental bundle, applies to bundle %s\n", b.baseID)
+
+	if params.Base == "" {
+		return nil, checkBaseTree(b, dest)
+	}
+
+	fmt.Printf("\nReading base bundle: %s\n", params.Base)
+	base, err := readBundle(params.Base, os.Stdout)
+	if err != nil {
+		return nil, err
+	}
+	if base.baseID != "" {
+		return nil, fmt.Errorf("base %s is itself an incremental bundle", params.Base)
+	}
+	if base.id != b.baseID {
+		return nil, fmt.Errorf("%s is not the base of this bundle: its bundle ID is %s, but the incremental bundle applies to %s", params.Base, base.id, b.baseID)
+	}
+	return base, nil
+}
+
+// checkBaseTree checks that dest holds the tree an incremental bundle was
+// collected against: the files it replaces or deletes must still be the base
+// bundle's, and the files it adds must not be there yet. Files that already
+// have the new content, from an earlier run, are accepted.
+func checkBaseTree(b *bundle, dest string) error {
+	info, err := os.Stat(dest)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%s doesn't exist; an incremental bundle is applied to the tree of its base bundle %s (use -base to reconstruct the base bundle first)", dest, b.baseID)
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s exists and is not a directory", dest)
+	}
+
+	var mismatched []string
+	deleted := make(map[string]bool)
+	for _, f := range b.files {
+		if f.isDirectory || f.isSymlink || f.isSkipped || (f.isChunk && f.chunkIndex != 1) {
+			continue
+		}
+		sum, exists, err := existingHash(filepath.Join(dest, f.path))
+		if err != nil {
+			return err
+		}
+
+		if f.isDeleted {
+			deleted[f.path] = true
+			// A directory or symlink may have replaced it on an earlier run
+			if exists && f.baseHash != "" && sum != "" && sum != f.baseHash {
+				mismatched = append(mismatched, fmt.Sprintf("%s differs from the file it deletes", f.path))
+			}
+			continue
+		}
+		switch {
+		case !exists:
+			if f.baseHash != "" {
+				mismatched = append(mismatched, fmt.Sprintf("%s is missing", f.path))
+			}
+		case sum == f.sha256Hash:
+			// Already up to date
+		case f.baseHash == "":
+			if !deleted[f.path] {
+				mismatched = append(mismatched, fmt.Sprintf("%s is not in the base bundle", f.path))
+			}
+		case sum != f.baseHash:
+			mismatched = append(mismatched, fmt.Sprintf("%s differs from the file it replaces", f.path))
+		}
+	}
+	if len(mismatched) == 0 {
+		return nil
+	}
+
+	fmt.Printf("\nBase mismatch:\n")
+	for i, m := range mismatched {
+		if i == maxListedEntries {
+			fmt.Printf("    ... and %d more\n", len(mismatched)-i)
+			break
+		}
+		fmt.Printf("    - %s\n", m)
+	}
+	return fmt.Errorf("%s doesn't match base bundle %s (%d files differ); nothing was changed (use -base to reconstruct from the base bundle)", dest, b.baseID, len(mismatched))
+}
+
+// existingHash returns the SHA-256 of a file on disk and whether there is
+// anything at path. Anything but a regular file has no hash; a file where
+// the path needs a directory means there is nothing.
+func existingHash(path string) (string, bool, error) {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if !info.Mode().IsRegular() {
+		return "", true, nil
+	}
+	sum, err := fileHash(path)
+	if err != nil {
+		return "", true, err
+	}
+	return hex.EncodeToString(sum), true, nil
+}
+
+// removeDeleted removes the paths an incremental bundle deletes from the
+// destination, recording them in j so a failed merge brings them back.
+// Directories are only removed once empty; files the destination has that
+// the bundle doesn't know about are kept, and so are the directories
+// holding them, which are returned.
+func removeDeleted(j *mergeJournal, deleted []string, allowUnsafe bool) (int, []string, error) {
+	root := newDirWriter(j.dest)
+	confined := newConfinement(root)
+	removed := 0
+	var kept []string
+	for _, path := range deleted {
+		if !allowUnsafe {
+			if err := confined.check(path, true); err != nil {
+				return removed, kept, err
+			}
+		}
+		info, err := root.Lstat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return removed, kept, err
+		}
+		if info.IsDir() {
+			if err := j.removeDir(path, info.Mode().Perm()); err != nil {
+				kept = append(kept, path)
+				continue
+			}
+		} else if err := j.remove(path); err != nil {
+			return removed, kept, fmt.Errorf("error deleting %s: %v", path, err)
+		}
+		confined.replaced(path)
+		removed++
+	}
+	return removed, kept, nil
+}
+
+// printDeletions reports what an incremental bundle deleted
+func printDeletions(removed int, kept []string) {
+	fmt.Printf("\nDeleted by the incremental bundle: %d\n", removed)
+	if len(kept) > 0 {
+		fmt.Printf("  Kept, as they hold files the bundle doesn't know about:\n")
+		for _, path := range kept {
+			fmt.Printf("    - %s/\n", path)
+		}
+	}
+}
+
+// isDir reports whether path is a directory, not following symlinks
+func isDir(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.IsDir()
+}
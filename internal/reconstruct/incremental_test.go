@@ -0,0 +1,146 @@
+package reconstruct
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jonathanleahy/folder-bundler/internal/collect"
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+	"github.com/jonathanleahy/folder-bundler/internal/secrets"
+)
+
+func TestIncremental(t *testing.T) {
+	files := map[string][]byte{
+		"same.txt":     []byte("same\n"),
+		"changed.txt":  []byte("before\n"),
+		"gone/old.txt": []byte("gone\n"),
+	}
+	dir := collectFiles(t, files, nil)
+	src := filepath.Join(dir, "src")
+	base := filepath.Join(dir, "src_collated_part1.fb")
+
+	// Change the tree and collect what changed since the base bundle
+	if err := os.WriteFile(filepath.Join(src, "changed.txt"), []byte("after\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "added.txt"), []byte("added\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(src, "gone")); err != nil {
+		t.Fatal(err)
+	}
+	params := &config.Parameters{
+		MaxFileSize:   1 << 20,
+		MaxOutputSize: 1 << 20,
+		RootDir:       src,
+		RootLabel:     "src",
+		OutputBase:    filepath.Join(dir, "src_incremental"),
+		SecretsMode:   secrets.ModeOff,
+		Since:         base,
+	}
+	if err := collect.CollectIncremental(params, ReadBase); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	incremental := filepath.Join(dir, "src_incremental_part1.fb")
+	data, err := os.ReadFile(incremental)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("## File: same.txt")) {
+		t.Errorf("unchanged same.txt is in the incremental bundle")
+	}
+
+	want := map[string][]byte{
+		"same.txt":    []byte("same\n"),
+		"changed.txt": []byte("after\n"),
+		"added.txt":   []byte("added\n"),
+	}
+	check := func(out string) {
+		t.Helper()
+		for name, content := range readFiles(t, out, want) {
+			if !bytes.Equal(content, want[name]) {
+				t.Errorf("%s: got %q, want %q", name, content, want[name])
+			}
+		}
+		if _, err := os.Stat(filepath.Join(out, "gone")); !os.IsNotExist(err) {
+			t.Errorf("gone/ wasn't deleted: %v", err)
+		}
+	}
+
+	// Applied to the base tree, and with -base into a new directory
+	out := filepath.Join(dir, "out")
+	if err := FromFile(base, &config.Parameters{OutputDir: out}); err != nil {
+		t.Fatalf("reconstruct base: %v", err)
+	}
+	if err := FromFile(incremental, &config.Parameters{OutputDir: out}); err != nil {
+		t.Fatalf("reconstruct onto base: %v", err)
+	}
+	check(out)
+	fresh := filepath.Join(dir, "fresh")
+	if err := FromFile(incremental, &config.Parameters{OutputDir: fresh, Base: base}); err != nil {
+		t.Fatalf("reconstruct with -base: %v", err)
+	}
+	check(fresh)
+
+	// A tree that isn't the base is left alone
+	other := filepath.Join(dir, "other")
+	if err := FromFile(base, &config.Parameters{OutputDir: other}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(other, "changed.txt"), []byte("edited\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := FromFile(incremental, &config.Parameters{OutputDir: other}); err == nil {
+		t.Errorf("applied to a tree that doesn't match the base")
+	}
+	if _, err := os.Stat(filepath.Join(other, "gone", "old.txt")); err != nil {
+		t.Errorf("mismatched tree was changed: %v", err)
+	}
+}
+
+func TestIncrementalBaseDirectoryModes(t *testing.T) {
+	files := map[string][]byte{
+		"private/a.txt": []byte("a\n"),
+		"shared/b.txt":  []byte("b\n"),
+	}
+	dir := collectFiles(t, files, func(p *config.Parameters) {
+		if err := os.Chmod(filepath.Join(p.RootDir, "private"), 0700); err != nil {
+			t.Fatal(err)
+		}
+	})
+	src := filepath.Join(dir, "src")
+	base := filepath.Join(dir, "src_collated_part1.fb")
+
+	// Only shared/ changes, so only the base bundle records private/
+	if err := os.Chmod(filepath.Join(src, "shared"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	params := &config.Parameters{
+		MaxFileSize:   1 << 20,
+		MaxOutputSize: 1 << 20,
+		RootDir:       src,
+		RootLabel:     "src",
+		OutputBase:    filepath.Join(dir, "src_incremental"),
+		SecretsMode:   secrets.ModeOff,
+		Since:         base,
+	}
+	if err := collect.CollectIncremental(params, ReadBase); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+
+	out := filepath.Join(dir, "out")
+	if err := FromFile(filepath.Join(dir, "src_incremental_part1.fb"), &config.Parameters{OutputDir: out, Base: base}); err != nil {
+		t.Fatalf("reconstruct with -base: %v", err)
+	}
+	for path, want := range map[string]os.FileMode{"private": 0700, "shared": 0750} {
+		info, err := os.Stat(filepath.Join(out, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s: mode %04o, want %04o", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package reconstruct
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+	"github.com/jonathanleahy/folder-bundler/internal/fileutils"
+	"github.com/jonathanleahy/folder-bundler/internal/glob"
+)
+
+// listEntry is one line of a listing. Files split across parts are listed
+// once, with every part they are in.
+type listEntry struct {
+	Path     string `json:"path"`
+	Type     string `json:"type"`
+	Size     int64  `json:"size,omitempty"`
+	Mode     string `json:"mode,omitempty"`
+	Modified string `json:"modified,omitempty"`
+	SHA256   string `json:"sha256,omitempty"`
+	Target   string `json:"target,omitempty"`
+	Parts    []int  `json:"parts"`
+
+	info FileInfo
+}
+
+// List prints the entries of a bundle as they are read: as a tree, with
+// -long as one line of metadata per entry, or with -json as one JSON object
+// per line. Only entries matching one of patterns are listed, if any are
+// given. Content is skipped, so listing doesn't depend on the bundle's size.
+func List(inputFile string, patterns []string, params *config.Parameters) error {
+	for _, pattern := range patterns {
+		if err := glob.Validate(pattern); err != nil {
+			return fmt.Errorf("invalid pattern '%s': %v", pattern, err)
+		}
+	}
+
+	b, err := openBundle(inputFile)
+	if err != nil {
+		return err
+	}
+
+	l := &lister{params: params, patterns: patterns, chunks: make(map[string]*listEntry)}
+	if params.JSONOutput {
+		l.json = json.NewEncoder(os.Stdout)
+	}
+	err = b.walk(func(f *FileInfo, _ io.Reader) error {
+		return l.add(f)
+	})
+	if err != nil {
+		return fmt.Errorf("error reading bundle: %v", err)
+	}
+
+	// Files whose last chunk is missing, in path order like the rest
+	var unfinished []*listEntry
+	for _, e := range l.chunks {
+		unfinished = append(unfinished, e)
+	}
+	sort.Slice(unfinished, func(i, j int) bool { return unfinished[i].Path < unfinished[j].Path })
+	for _, e := range unfinished {
+		if err := l.print(e); err != nil {
+			return err
+		}
+	}
+	if l.json == nil {
+		fmt.Printf("\n%s, %s, %s\n", plural(l.dirs, "directory", "directories"), plural(l.files, "file", "files"), formatSize(l.size))
+	}
+	return nil
+}
+
+// lister prints entries as they are read
+type lister struct {
+	params   *config.Parameters
+	patterns []string
+	json     *json.Encoder
+	// Chunks of split files seen so far
+	chunks map[string]*listEntry
+	// Directories that contain the entry being printed in the tree, and
+	// whether each has been printed yet
+	open    []string
+	printed []bool
+
+	dirs, files int
+	size        int64
+}
+
+func (l *lister) add(f *FileInfo) error {
+	if f.isDirectory && f.path == "" {
+		return nil
+	}
+
+	e := &listEntry{Path: filepath.ToSlash(f.path), Parts: []int{f.part}, info: *f}
+	if f.isChunk {
+		// Listed once its last chunk has been read
+		if first := l.chunks[f.path]; first != nil {
+			if first.Parts[len(first.Parts)-1] != f.part {
+				first.Parts = append(first.Parts, f.part)
+			}
+			e = first
+		} else {
+			l.chunks[f.path] = e
+		}
+		if f.chunkIndex != f.chunkTotal {
+			return nil
+		}
+		delete(l.chunks, f.path)
+	}
+	return l.print(e)
+}
+
+// print prints an entry if it matches the patterns
+func (l *lister) print(e *listEntry) error {
+	f := e.info
+	switch {
+	case f.isDirectory:
+		e.Type = "dir"
+	case f.isSymlink:
+		e.Type = "symlink"
+		e.Target = f.symlinkTarget
+	case f.isSkipped:
+		e.Type = "skipped"
+		e.Size = f.size
+	case f.isDeleted:
+		e.Type = "deleted"
+	default:
+		e.Type = "file"
+		e.Size = f.size
+		e.SHA256 = f.sha256Hash
+	}
+	if f.hasMode {
+		e.Mode = fmt.Sprintf("%04o", f.mode)
+	}
+	if !f.lastModified.IsZero() {
+		e.Modified = f.lastModified.Format(time.RFC3339)
+	}
+
+	matched := l.matches(e.Path)
+	if matched {
+		if f.isDirectory {
+			l.dirs++
+		} else if !f.isSymlink && !f.isDeleted {
+			l.files++
+			l.size += e.Size
+		}
+	}
+
+	switch {
+	case l.json != nil:
+		if matched {
+			return l.json.Encode(e)
+		}
+	case l.params.ListLong:
+		if matched {
+			fmt.Println(longLine(e))
+		}
+	default:
+		l.tree(e, matched)
+	}
+	return nil
+}
+
+// matches reports whether an entry is listed: with patterns, those extract
+// would select, so a directory pattern lists everything below it
+func (l *lister) matches(path string) bool {
+	return len(l.patterns) == 0 || selects(l.patterns, path)
+}
+
+// tree prints an entry indented below the directories that contain it,
+// printing any of them that haven't been yet because they didn't match
+func (l *lister) tree(e *listEntry, matched bool) {
+	for len(l.open) > 0 && !strings.HasPrefix(e.Path, l.open[len(l.open)-1]+"/") {
+		l.open = l.open[:len(l.open)-1]
+		l.printed = l.printed[:len(l.printed)-1]
+	}
+
+	if matched {
+		for i, dir := range l.open {
+			if !l.printed[i] {
+				fmt.Printf("%s%s/\n", strings.Repeat("  ", i), fileutils.QuotePath(treeName(dir, l.open[:i])))
+				l.printed[i] = true
+			}
+		}
+		name := fileutils.QuotePath(treeName(e.Path, l.open))
+		indent := strings.Repeat("  ", len(l.open))
+		switch e.Type {
+		case "dir":
+			fmt.Printf("%s%s/\n", indent, name)
+		case "symlink":
+			fmt.Printf("%s%s -> %s\n", indent, name, fileutils.QuotePath(e.Target))
+		case "skipped":
+			fmt.Printf("%s%s (skipped, %s)\n", indent, name, formatSize(e.Size))
+		case "deleted":
+			fmt.Printf("%s%s (deleted)\n", indent, name)
+		default:
+			fmt.Printf("%s%s (%s)\n", indent, name, formatSize(e.Size))
+		}
+	}
+
+	if e.Type == "dir" {
+		l.open = append(l.open, e.Path)
+		l.printed = append(l.printed, matched)
+	}
+}
+
+// plural renders a count with the singular or plural noun that goes with it
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return "1 " + one
+	}
+	return fmt.Sprintf("%d %s", n, many)
+}
+
+// treeName is a path relative to the innermost of the directories it is in
+func treeName(path string, open []string) string {
+	if len(open) == 0 {
+		return path
+	}
+	return strings.TrimPrefix(path, open[len(open)-1]+"/")
+}
+
+// longLine renders an entry for -long: mode, size, modification time, parts,
+// SHA-256 and path
+func longLine(e *listEntry) string {
+	mode := "-"
+	if e.Mode != "" {
+		fm := e.info.mode
+		switch e.Type {
+		case "dir":
+			fm |= os.ModeDir
+		case "symlink":
+			fm |= os.ModeSymlink
+		}
+		mode = fm.String()
+	}
+	modified := "-"
+	if !e.info.lastModified.IsZero() {
+		modified = e.info.lastModified.Local().Format("2006-01-02 15:04")
+	}
+	parts := make([]string, len(e.Parts))
+	for i, p := range e.Parts {
+		parts[i] = fmt.Sprint(p)
+	}
+	hash := e.SHA256
+	if hash == "" {
+		hash = "-"
+	}
+
+	// Paths are quoted as in the bundle, so odd names can't break the line
+	path := fileutils.QuotePath(e.Path)
+	switch e.Type {
+	case "dir":
+		path += "/"
+	case "symlink":
+		path += " -> " + fileutils.QuotePath(e.Target)
+	case "skipped":
+		path += " (skipped)"
+	case "deleted":
+		path += " (deleted)"
+	}
+	return fmt.Sprintf("%-10s %12d  %s  part %-5s %-64s  %s", mode, e.Size, modified, strings.Join(parts, ","), hash, path)
+}
@@ -0,0 +1,177 @@
+package reconstruct
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+)
+
+func TestListTracksParts(t *testing.T) {
+	files := make(map[string][]byte)
+	for i := 0; i < 20; i++ {
+		files[fmt.Sprintf("pkg/file%02d.go", i)] = bytes.Repeat([]byte(fmt.Sprintf("var v%d = %d\n", i, i)), 1000)
+	}
+	for _, compress := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compress=%v", compress), func(t *testing.T) {
+			dir := collectFiles(t, files, func(p *config.Parameters) {
+				p.EnableCompression = compress
+				p.CompressionStrategy = "auto"
+				p.MaxOutputSize = 32 * 1024
+				p.MaxMemory = 1 << 20
+			})
+			b, err := openBundle(filepath.Join(dir, "src_collated_part1.fb"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Entries are numbered with the part they are in, in order
+			last := 0
+			err = b.walk(func(f *FileInfo, _ io.Reader) error {
+				if f.part < last || f.part > len(b.parts) {
+					t.Errorf("%s: part %d after part %d of %d", f.path, f.part, last, len(b.parts))
+				}
+				last = f.part
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(b.parts) < 2 || last != len(b.parts) {
+				t.Errorf("last entry in part %d of %d", last, len(b.parts))
+			}
+		})
+	}
+}
+
+// captureStdout returns what fn prints to standard output
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	done := make(chan string)
+	go func() {
+		out, _ := io.ReadAll(r)
+		done <- string(out)
+	}()
+	fn()
+	w.Close()
+	return <-done
+}
+
+func TestListQuotesPaths(t *testing.T) {
+	files := map[string][]byte{"dir\nname/two\nlines.txt": []byte("x\n")}
+	dir := collectFiles(t, files, func(p *config.Parameters) {
+		if err := os.Symlink("odd\ttarget", filepath.Join(p.RootDir, "link")); err != nil {
+			t.Fatal(err)
+		}
+	})
+	bundle := filepath.Join(dir, "src_collated_part1.fb")
+	list := func(params *config.Parameters) string {
+		return captureStdout(t, func() {
+			if err := List(bundle, nil, params); err != nil {
+				t.Errorf("list: %v", err)
+			}
+		})
+	}
+
+	tree := list(&config.Parameters{})
+	for _, want := range []string{"\"dir\\nname\"/\n", "  \"two\\nlines.txt\" (", "link -> \"odd\\ttarget\"\n"} {
+		if !strings.Contains(tree, want) {
+			t.Errorf("tree: no %q in\n%s", want, tree)
+		}
+	}
+	long := list(&config.Parameters{ListLong: true})
+	for _, want := range []string{"  \"dir\\nname\"/\n", "  \"dir\\nname/two\\nlines.txt\"\n", "  link -> \"odd\\ttarget\"\n"} {
+		if !strings.Contains(long, want) {
+			t.Errorf("-long: no %q in\n%s", want, long)
+		}
+	}
+
+	// JSON carries the paths as they are
+	jsonOut := list(&config.Parameters{JSONOutput: true})
+	for _, want := range []string{`"path":"dir\nname/two\nlines.txt"`, `"target":"odd\ttarget"`} {
+		if !strings.Contains(jsonOut, want) {
+			t.Errorf("-json: no %s in\n%s", want, jsonOut)
+		}
+	}
+}
+
+func TestListUnfinishedChunks(t *testing.T) {
+	// Files whose last chunk is missing are listed after the rest, by path
+	bundle := "# folder-bundle format: 4\n# Project Files Summary - Part 1\n\nRoot Directory: x\n\n---\n\n"
+	var want []string
+	for i := 9; i >= 0; i-- {
+		bundle += fmt.Sprintf("## File Chunk: f%d.txt\n\nChunk: 1 of 2\n\nOffset: 0\n\nChunk Size: 2 bytes\n\n"+
+			"--- FILE CONTENT BEGIN (2 bytes) ---\nx\n\n--- FILE CONTENT END ---\n\n", i)
+		want = append([]string{fmt.Sprintf(`"path":"f%d.txt"`, i)}, want...)
+	}
+	path := filepath.Join(t.TempDir(), "bundle.fb")
+	if err := os.WriteFile(path, []byte(bundle), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := captureStdout(t, func() {
+		if err := List(path, nil, &config.Parameters{JSONOutput: true}); err != nil {
+			t.Errorf("list: %v", err)
+		}
+	})
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("got %d entries, want %d:\n%s", len(lines), len(want), out)
+	}
+	for i, line := range lines {
+		if !strings.Contains(line, want[i]) {
+			t.Errorf("entry %d: got %s, want %s", i, line, want[i])
+		}
+	}
+}
+
+func TestListDirectoryPattern(t *testing.T) {
+	files := map[string][]byte{
+		"sub/a.txt":      []byte("a\n"),
+		"sub/deep/b.txt": []byte("b\n"),
+		"other/c.txt":    []byte("c\n"),
+		"subway/d.txt":   []byte("d\n"),
+		"readme.md":      []byte("r\n"),
+	}
+	dir := collectFiles(t, files, nil)
+	bundle := filepath.Join(dir, "src_collated_part1.fb")
+
+	// A directory lists everything below it, as extract selects it
+	out := captureStdout(t, func() {
+		if err := List(bundle, []string{"sub"}, &config.Parameters{}); err != nil {
+			t.Errorf("list: %v", err)
+		}
+	})
+	for _, want := range []string{"sub/\n", "  a.txt (", "  deep/\n", "    b.txt (", "\n2 directories, 2 files,"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("no %q in\n%s", want, out)
+		}
+	}
+	for _, unwanted := range []string{"c.txt", "d.txt", "readme.md"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("%s listed in\n%s", unwanted, out)
+		}
+	}
+
+	out = captureStdout(t, func() {
+		if err := List(bundle, []string{"sub/deep"}, &config.Parameters{}); err != nil {
+			t.Errorf("list: %v", err)
+		}
+	})
+	if !strings.Contains(out, "\n1 directory, 1 file,") {
+		t.Errorf("counts not singular in\n%s", out)
+	}
+}
@@ -0,0 +1,108 @@
+package reconstruct
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxListedEntries caps how many missing entries an error lists
+const maxListedEntries = 10
+
+// manifest is the table of contents at the top of part 1
+type manifest struct {
+	// Number of parts in the bundle; 0 for compressed bundles
+	parts   int
+	entries []manifestEntry
+}
+
+type manifestEntry struct {
+	kind string
+	path string
+	// Parts holding the entry, 0 when unknown
+	firstPart int
+	lastPart  int
+}
+
+// parseLine parses one tab-separated line of the manifest:
+// type, size, sha256, language, part and path
+func (m *manifest) parseLine(line string) error {
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+	fields := strings.SplitN(line, "\t", 6)
+	if len(fields) != 6 {
+		return fmt.Errorf("malformed manifest line: %q", line)
+	}
+
+	path, _, err := parsePath(fields[5], true)
+	if err != nil {
+		return err
+	}
+	entry := manifestEntry{kind: fields[0], path: path}
+	if part := fields[4]; part != "-" {
+		if n, _ := fmt.Sscanf(part, "%d-%d", &entry.firstPart, &entry.lastPart); n == 1 {
+			entry.lastPart = entry.firstPart
+		}
+	}
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+// check compares the manifest with the entries found in the parts that were
+// read, and reports missing parts and the entries they held
+func (m *manifest) check(files []FileInfo, seenParts map[int]bool) error {
+	var missingParts []int
+	for part := 1; part <= m.parts; part++ {
+		if !seenParts[part] {
+			missingParts = append(missingParts, part)
+		}
+	}
+
+	found := make(map[string]bool)
+	for _, f := range files {
+		found[filepath.ToSlash(f.path)] = true
+	}
+
+	var missing []string
+	for _, e := range m.entries {
+		if found[e.path] {
+			continue
+		}
+		where := ""
+		if e.firstPart > 0 {
+			where = fmt.Sprintf(" (part %d)", e.firstPart)
+			if e.lastPart != e.firstPart {
+				where = fmt.Sprintf(" (parts %d-%d)", e.firstPart, e.lastPart)
+			}
+		}
+		missing = append(missing, fmt.Sprintf("%s %s%s", e.kind, e.path, where))
+	}
+
+	if len(missingParts) == 0 && len(missing) == 0 {
+		return nil
+	}
+
+	var msg strings.Builder
+	msg.WriteString("bundle is incomplete")
+	if len(missingParts) > 0 {
+		sort.Ints(missingParts)
+		parts := make([]string, len(missingParts))
+		for i, p := range missingParts {
+			parts[i] = fmt.Sprint(p)
+		}
+		fmt.Fprintf(&msg, ": missing part(s) %s of %d", strings.Join(parts, ", "), m.parts)
+	}
+	if len(missing) > 0 {
+		fmt.Fprintf(&msg, "\n%d of %d manifest entries not found:", len(missing), len(m.entries))
+		for i, entry := range missing {
+			if i == maxListedEntries {
+				fmt.Fprintf(&msg, "\n  ... and %d more", len(missing)-maxListedEntries)
+				break
+			}
+			msg.WriteString("\n  - " + entry)
+		}
+	}
+	return fmt.Errorf("%s", msg.String())
+}
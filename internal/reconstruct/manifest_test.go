@@ -0,0 +1,71 @@
+package reconstruct
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+)
+
+func TestReconstructIncompleteBundle(t *testing.T) {
+	t.Run("missing entry", func(t *testing.T) {
+		files := map[string][]byte{"a.txt": []byte("one\n"), "docs/b.txt": []byte("two\n")}
+		dir := collectFiles(t, files, nil)
+		bundle := filepath.Join(dir, "src_collated_part1.fb")
+		content, err := os.ReadFile(bundle)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Cut the entry out of the part, leaving it in the manifest
+		const endMarker = "--- FILE CONTENT END ---\n"
+		start := bytes.Index(content, []byte("## File: docs/b.txt\n"))
+		if start < 0 {
+			t.Fatalf("entry not found in bundle:\n%s", content)
+		}
+		end := start + bytes.Index(content[start:], []byte(endMarker)) + len(endMarker)
+		content = append(content[:start:start], content[end:]...)
+		if err := os.WriteFile(bundle, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		out := filepath.Join(dir, "out")
+		err = FromFile(bundle, &config.Parameters{OutputDir: out})
+		if err == nil || !strings.Contains(err.Error(), "1 of 3 manifest entries not found") ||
+			!strings.Contains(err.Error(), "file docs/b.txt (part 1)") {
+			t.Errorf("got %v, want docs/b.txt reported missing", err)
+		}
+		if _, err := os.Stat(out); !os.IsNotExist(err) {
+			t.Errorf("output written from an incomplete bundle: %v", err)
+		}
+	})
+
+	t.Run("missing part", func(t *testing.T) {
+		files := make(map[string][]byte)
+		for i := 0; i < 20; i++ {
+			files[fmt.Sprintf("pkg/file%02d.go", i)] = bytes.Repeat([]byte(fmt.Sprintf("var v%d = %d\n", i, i)), 1000)
+		}
+		dir := collectFiles(t, files, func(p *config.Parameters) {
+			p.MaxOutputSize = 32 * 1024
+		})
+		if _, err := os.Stat(filepath.Join(dir, "src_collated_part3.fb")); err != nil {
+			t.Fatalf("want at least 3 parts: %v", err)
+		}
+		if err := os.Remove(filepath.Join(dir, "src_collated_part2.fb")); err != nil {
+			t.Fatal(err)
+		}
+
+		out := filepath.Join(dir, "out")
+		err := FromFile(filepath.Join(dir, "src_collated_part1.fb"), &config.Parameters{OutputDir: out})
+		if err == nil || !strings.Contains(err.Error(), "part(s) 2 are missing") {
+			t.Errorf("got %v, want part 2 reported missing", err)
+		}
+		if _, err := os.Stat(out); !os.IsNotExist(err) {
+			t.Errorf("output written from an incomplete bundle: %v", err)
+		}
+	})
+}
@@ -0,0 +1,154 @@
+package reconstruct
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+)
+
+// partFileName matches the name of one part of a bundle
+var partFileName = regexp.MustCompile(`^(.*)_part(\d+)\.fb$`)
+
+// headerLines is how far into a part its identifying header lines may appear
+const headerLines = 20
+
+// partFile is one part of a bundle as identified by its header
+type partFile struct {
+	path     string
+	bundleID string
+	part     int
+	total    int
+}
+
+// discoverParts finds the parts of the bundle that inputFile belongs to,
+// ordered by part number. Only files named <base>_part<N>.fb whose header
+// carries the same bundle ID as inputFile are considered. Duplicate or
+// missing parts are reported as an error.
+func discoverParts(inputFile string) ([]partFile, error) {
+	first, err := readPartHeader(inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading input file %s: %v", inputFile, err)
+	}
+
+	m := partFileName.FindStringSubmatch(filepath.Base(inputFile))
+	if m == nil {
+		// A single bundle file that doesn't follow the part naming
+		return []partFile{first}, nil
+	}
+
+	dir := filepath.Dir(inputFile)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error finding collated files: %v", err)
+	}
+
+	var parts []partFile
+	for _, entry := range entries {
+		mm := partFileName.FindStringSubmatch(entry.Name())
+		if mm == nil || mm[1] != m[1] || entry.IsDir() {
+			// e.g. app_collated_v2_part1.fb when looking for app_collated
+			continue
+		}
+		match := filepath.Join(dir, entry.Name())
+		pf, err := readPartHeader(match)
+		if err != nil {
+			return nil, fmt.Errorf("error reading input file %s: %v", match, err)
+		}
+		if pf.bundleID != first.bundleID {
+			fmt.Fprintf(os.Stderr, "  Skipping %s: it belongs to another bundle\n", match)
+			continue
+		}
+		if pf.part == 0 {
+			// Bundles written before part headers carried their number
+			pf.part, _ = strconv.Atoi(mm[2])
+		}
+		parts = append(parts, pf)
+	}
+
+	sort.Slice(parts, func(i, j int) bool { return parts[i].part < parts[j].part })
+	if err := checkParts(parts); err != nil {
+		return nil, err
+	}
+	return parts, nil
+}
+
+// checkParts reports duplicate part numbers and gaps in the sequence
+func checkParts(parts []partFile) error {
+	seen := make(map[int]string)
+	total := 0
+	for _, pf := range parts {
+		if other, ok := seen[pf.part]; ok {
+			return fmt.Errorf("part %d found more than once: %s and %s", pf.part, other, pf.path)
+		}
+		seen[pf.part] = pf.path
+		if pf.total > total {
+			total = pf.total
+		}
+	}
+
+	// Without totals in the headers, only gaps before the last part can be seen
+	if total == 0 && len(parts) > 0 {
+		total = parts[len(parts)-1].part
+	}
+
+	var missing []string
+	for i := 1; i <= total; i++ {
+		if _, ok := seen[i]; !ok {
+			missing = append(missing, strconv.Itoa(i))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("bundle has %d parts but part(s) %s are missing", total, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// readPartHeader reads the bundle ID and part numbers from the first lines of
+// a part, with or without a compression header
+func readPartHeader(path string) (partFile, error) {
+	pf := partFile{path: path}
+	file, err := os.Open(path)
+	if err != nil {
+		return pf, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	compressed := false
+	for i := 0; i < headerLines && scanner.Scan(); i++ {
+		line := scanner.Text()
+		if i == 0 && strings.HasPrefix(line, config.FormatLinePrefix) {
+			// The compression header, if any, follows the format line
+			continue
+		}
+		if i <= 1 && strings.HasPrefix(line, "# Compression: ") {
+			compressed = true
+		}
+		if compressed {
+			// The compressed payload starts after the first empty line
+			if line == "" {
+				break
+			}
+			line = strings.TrimPrefix(line, "# ")
+		}
+
+		switch {
+		case strings.HasPrefix(line, "Bundle ID: "):
+			pf.bundleID = strings.TrimPrefix(line, "Bundle ID: ")
+		case strings.HasPrefix(line, "Part: "):
+			fmt.Sscanf(strings.TrimPrefix(line, "Part: "), "%d of %d", &pf.part, &pf.total)
+		case line == "---":
+			// End of the part header
+			return pf, nil
+		}
+	}
+	// Read errors surface when the part itself is read
+	return pf, nil
+}
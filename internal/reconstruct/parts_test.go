@@ -0,0 +1,58 @@
+package reconstruct
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writePart(t *testing.T, dir, name, bundleID string, part, total int) {
+	t.Helper()
+	header := fmt.Sprintf("# Project Files Summary - Part %d\n\nBundle ID: %s\n\nPart: %d of %d\n\nRoot Directory: x\n\n---\n\n", part, bundleID, part, total)
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(header), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiscoverPartsOrdersNumerically(t *testing.T) {
+	dir := t.TempDir()
+	for i := 1; i <= 12; i++ {
+		writePart(t, dir, fmt.Sprintf("app_collated_part%d.fb", i), "aaaa", i, 12)
+	}
+	// An unrelated bundle with a similar name and a stale part from an earlier run
+	writePart(t, dir, "app_collated_v2_part1.fb", "bbbb", 1, 1)
+	writePart(t, dir, "app_collated_part13.fb", "cccc", 13, 13)
+
+	parts, err := discoverParts(filepath.Join(dir, "app_collated_part1.fb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 12 {
+		t.Fatalf("got %d parts, want 12", len(parts))
+	}
+	for i, pf := range parts {
+		if pf.part != i+1 || !strings.HasSuffix(pf.path, fmt.Sprintf("_part%d.fb", i+1)) {
+			t.Errorf("parts[%d] = %s (part %d)", i, pf.path, pf.part)
+		}
+	}
+}
+
+func TestDiscoverPartsReportsGapsAndDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	writePart(t, dir, "app_collated_part1.fb", "aaaa", 1, 4)
+	writePart(t, dir, "app_collated_part3.fb", "aaaa", 3, 4)
+
+	_, err := discoverParts(filepath.Join(dir, "app_collated_part1.fb"))
+	if err == nil || !strings.Contains(err.Error(), "part(s) 2, 4 are missing") {
+		t.Errorf("missing parts: got error %v", err)
+	}
+
+	writePart(t, dir, "app_collated_part2.fb", "aaaa", 3, 4)
+	writePart(t, dir, "app_collated_part4.fb", "aaaa", 4, 4)
+	_, err = discoverParts(filepath.Join(dir, "app_collated_part1.fb"))
+	if err == nil || !strings.Contains(err.Error(), "part 3 found more than once") {
+		t.Errorf("duplicate part: got error %v", err)
+	}
+}
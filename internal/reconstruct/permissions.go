@@ -0,0 +1,52 @@
+package reconstruct
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+	"github.com/jonathanleahy/folder-bundler/internal/fileutils"
+)
+
+// applyPermissions restores the recorded mode of a file or directory, less
+// the -umask bits, and with -owner its recorded owner
+func applyPermissions(root *dirWriter, f FileInfo, params *config.Parameters) error {
+	if f.hasMode {
+		if err := root.Chmod(f.path, f.mode&^params.Umask); err != nil {
+			return err
+		}
+	}
+	if params.PreserveOwner && f.hasOwner && fileutils.CanChown() {
+		if err := root.Lchown(f.path, f.uid, f.gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyDirectoryPermissions restores directory modes, deepest first so that
+// a directory made read-only doesn't block changes to the ones below it
+func applyDirectoryPermissions(root *dirWriter, files []FileInfo, params *config.Parameters) error {
+	if params.PreserveOwner && !fileutils.CanChown() {
+		fmt.Printf("  Warning: -owner needs root; file owners were not restored\n")
+	}
+
+	var dirs []FileInfo
+	for _, f := range files {
+		if f.isDirectory && f.path != "" {
+			dirs = append(dirs, f)
+		}
+	}
+	sort.SliceStable(dirs, func(i, j int) bool {
+		return strings.Count(dirs[i].path, string(os.PathSeparator)) > strings.Count(dirs[j].path, string(os.PathSeparator))
+	})
+
+	for _, d := range dirs {
+		if err := applyPermissions(root, d, params); err != nil {
+			return fmt.Errorf("error restoring permissions of %s: %v", d.path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package reconstruct
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+	"github.com/jonathanleahy/folder-bundler/internal/fileutils"
+)
+
+func TestReconstructPermissions(t *testing.T) {
+	files := map[string][]byte{
+		"run.sh":         []byte("#!/bin/sh\n"),
+		"secret/key.txt": []byte("key\n"),
+	}
+	owned := fileutils.CanChown()
+	dir := collectFiles(t, files, func(p *config.Parameters) {
+		for path, mode := range map[string]os.FileMode{"run.sh": 0755, "secret/key.txt": 0600, "secret": 0700} {
+			if err := os.Chmod(filepath.Join(p.RootDir, path), mode); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if owned {
+			if err := os.Lchown(filepath.Join(p.RootDir, "run.sh"), 1234, 1234); err != nil {
+				t.Fatal(err)
+			}
+			p.PreserveOwner = true
+		}
+	})
+	bundle := filepath.Join(dir, "src_collated_part1.fb")
+	if owned {
+		content, err := os.ReadFile(bundle)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(content), "Owner: 1234:1234") {
+			t.Errorf("bundle doesn't record the owner of run.sh")
+		}
+	}
+
+	modes := func(t *testing.T, out string, want map[string]os.FileMode) {
+		t.Helper()
+		for path, mode := range want {
+			info, err := os.Stat(filepath.Join(out, path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := info.Mode().Perm(); got != mode {
+				t.Errorf("%s: mode %04o, want %04o", path, got, mode)
+			}
+		}
+	}
+
+	t.Run("modes", func(t *testing.T) {
+		out := filepath.Join(dir, "out")
+		if err := FromFile(bundle, &config.Parameters{OutputDir: out}); err != nil {
+			t.Fatalf("reconstruct: %v", err)
+		}
+		modes(t, out, map[string]os.FileMode{"run.sh": 0755, "secret/key.txt": 0600, "secret": 0700})
+	})
+
+	t.Run("umask", func(t *testing.T) {
+		out := filepath.Join(dir, "umask")
+		if err := FromFile(bundle, &config.Parameters{OutputDir: out, Umask: 0077}); err != nil {
+			t.Fatalf("reconstruct: %v", err)
+		}
+		modes(t, out, map[string]os.FileMode{"run.sh": 0700, "secret/key.txt": 0600, "secret": 0700})
+	})
+
+	t.Run("owner", func(t *testing.T) {
+		if !owned {
+			t.Skip("changing owners needs root")
+		}
+		out := filepath.Join(dir, "owner")
+		if err := FromFile(bundle, &config.Parameters{OutputDir: out, PreserveOwner: true}); err != nil {
+			t.Fatalf("reconstruct: %v", err)
+		}
+		info, err := os.Lstat(filepath.Join(out, "run.sh"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uid, gid, ok := fileutils.FileOwner(info); !ok || uid != 1234 || gid != 1234 {
+			t.Errorf("run.sh: owner %d:%d, want 1234:1234", uid, gid)
+		}
+
+		// Without -owner the recorded owner is ignored
+		out = filepath.Join(dir, "no-owner")
+		if err := FromFile(bundle, &config.Parameters{OutputDir: out}); err != nil {
+			t.Fatalf("reconstruct: %v", err)
+		}
+		if info, err = os.Lstat(filepath.Join(out, "run.sh")); err != nil {
+			t.Fatal(err)
+		}
+		if uid, _, _ := fileutils.FileOwner(info); uid == 1234 {
+			t.Errorf("run.sh: owner restored without -owner")
+		}
+	})
+}
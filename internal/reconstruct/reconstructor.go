@@ -2,12 +2,15 @@ package reconstruct
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -17,122 +20,471 @@ import (
 
 type FileInfo struct {
 	path         string
-	content      strings.Builder
 	size         int64
+	hasSize      bool
 	sha256Hash   string
 	lastModified time.Time
 	isDirectory  bool
 	isSymlink    bool
 	symlinkTarget string
 	isBase64     bool
+	// Permission bits and owner, when recorded
+	mode     os.FileMode
+	hasMode  bool
+	uid      int
+	gid      int
+	hasOwner bool
+	// Set for a file that was too big to be collected, with the limit it
+	// exceeded
+	isSkipped  bool
+	skippedMax int64
+	// Set for one chunk of a file that was split across parts
+	isChunk    bool
+	chunkIndex int
+	chunkTotal int
+	chunkOffset int64
+	chunkSize  int64
+	chunkHash  string
+	// Part of the bundle the entry was read from
+	part int
+	// Set for a path an incremental bundle deletes
+	isDeleted bool
+	// What an incremental bundle expects the file it replaces or deletes to hash to
+	baseHash string
+	// Number of secrets collect redacted from the content
+	redacted int
 }
 
 func FromFile(inputFile string, params *config.Parameters) error {
 	fmt.Printf("Starting reconstruction from: %s\n", inputFile)
-	
-	basePath := strings.TrimSuffix(inputFile, "_part1.fb")
-	basePath = strings.TrimSuffix(basePath, ".fb")
-	pattern := basePath + "*.fb"
 
-	matches, err := filepath.Glob(pattern)
+	b, err := readBundle(inputFile, os.Stdout)
+	if err != nil {
+		return err
+	}
+	return reconstructBundle(b, params)
+}
+
+// reconstructBundle writes the entries of a bundle that was read into its
+// destination, staging them first
+func reconstructBundle(b *bundle, params *config.Parameters) error {
+	// Files go to -o if given, and never outside the current directory otherwise
+	rootDir := params.OutputDir
+	if rootDir == "" {
+		var err error
+		if rootDir, err = destinationFor(b.rootDir, params.AllowUnsafe); err != nil {
+			return err
+		}
+	}
+
+	// An incremental bundle goes on top of its base bundle or the tree in rootDir
+	base, err := incrementalBase(b, rootDir, params)
 	if err != nil {
-		return fmt.Errorf("error finding collated files: %v", err)
+		return err
 	}
 
-	if len(matches) == 0 {
-		return fmt.Errorf("no collated files found matching pattern: %s", pattern)
+	// Files are staged next to the destination and moved into place at the end.
+	// A resumed run would write the base bundle over what is staged.
+	st, err := newStaging(rootDir, b, params.Resume && base == nil)
+	if err != nil {
+		return err
+	}
+	defer st.close()
+
+	var failed []string
+	if base != nil {
+		failed, err = reconstructFiles(st.dir, base, params, nil)
+	}
+	if err == nil && len(failed) == 0 {
+		failed, err = reconstructFiles(st.dir, b, params, st)
+	}
+	if err == nil && len(failed) > 0 {
+		err = fmt.Errorf("%d file(s) failed verification", len(failed))
+	}
+	if err != nil {
+		// Damaged content would be written again on resume
+		st.rollback(params.Resume && len(failed) == 0)
+		return err
+	}
+
+	policy := conflictPolicy(params)
+	report, err := st.commit(policy, params.AllowUnsafe)
+	report.print(policy)
+	if err != nil {
+		st.rollback(params.Resume)
+		return err
+	}
+	// Directory permissions last, so read-only directories can still be filled
+	return applyDirectoryPermissions(newDirWriter(rootDir), withBaseFiles(b, base), params)
+}
+
+// withBaseFiles returns the entries of an incremental bundle after those of
+// its base bundle, leaving out the ones it deletes, so that its own win
+func withBaseFiles(b, base *bundle) []FileInfo {
+	if base == nil {
+		return b.files
+	}
+	deleted := make(map[string]bool)
+	for _, f := range b.files {
+		if f.isDeleted {
+			deleted[f.path] = true
+		}
+	}
+	var files []FileInfo
+	for _, f := range base.files {
+		if !deleted[f.path] {
+			files = append(files, f)
+		}
 	}
+	return append(files, b.files...)
+}
 
-	fmt.Printf("Found %d file(s) to process\n", len(matches))
+// bundle is what was read from the headers of all parts of a bundle. Entry
+// content stays in the parts and is streamed from them by walk.
+type bundle struct {
+	id      string
+	rootDir string
+	// Set for an incremental bundle: the bundle it applies to
+	baseID string
+	// Format of the parts, and the part files they were read from
+	format  int
+	parts   []string
+	sources []source
+	// Every entry without its content
+	files []FileInfo
+	// Paths walk is limited to, nil for every entry
+	selected map[string]bool
+}
 
-	var allFiles []FileInfo
-	var rootDir string
+// source is one stream of entries: an uncompressed part, the parts of a
+// bundle compressed window by window, or the decompressed content of a
+// bundle compressed in one piece
+type source struct {
+	name string
+	// The part to read, or the parts of a windowed bundle, as absolute paths
+	path    string
+	windows []string
+	content []byte
+}
 
-	for _, match := range matches {
-		fmt.Printf("  Processing: %s\n", match)
-		currentRootDir, files, err := parseInputFile(match)
+// readBundle reads and checks the headers of every part of the bundle that
+// inputFile belongs to. Content is skipped, so memory use doesn't grow with
+// the size of the bundle. Progress is written to log.
+func readBundle(inputFile string, log io.Writer) (*bundle, error) {
+	b, err := openBundle(inputFile)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(log, "Found %d file(s) to process\n", len(b.parts))
+
+	var bundleManifest *manifest
+	seenParts := make(map[int]bool)
+	for _, s := range b.sources {
+		fmt.Fprintf(log, "  Processing: %s\n", s.name)
+		er, err := s.entries(func(f *FileInfo, _ io.Reader) error {
+			b.files = append(b.files, *f)
+			return nil
+		})
 		if err != nil {
-			return fmt.Errorf("error parsing input file %s: %v", match, err)
+			return nil, fmt.Errorf("error parsing input file %s: %v", s.name, err)
 		}
 
-		if rootDir == "" {
-			rootDir = currentRootDir
-		} else if rootDir != currentRootDir {
-			fmt.Printf("  Warning: Inconsistent root directories found. Using %s\n", rootDir)
+		if er.rootDir == "" {
+			return nil, fmt.Errorf("root directory not found in input file %s", s.name)
+		}
+		if b.rootDir == "" {
+			b.rootDir = er.rootDir
+		} else if b.rootDir != er.rootDir {
+			fmt.Fprintf(log, "  Warning: Inconsistent root directories found in %s. Using %s\n", s.name, b.rootDir)
+		}
+		if er.manifest != nil {
+			bundleManifest = er.manifest
 		}
+		if er.baseID != "" {
+			b.baseID = er.baseID
+		}
+		if er.version > b.format {
+			b.format = er.version
+		}
+		seenParts[er.partNumber] = true
+	}
 
-		allFiles = append(allFiles, files...)
+	// Refuse to build anything from an incomplete bundle
+	if bundleManifest != nil {
+		if err := bundleManifest.check(b.files, seenParts); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(log, "Manifest: all %d entries present\n", len(bundleManifest.entries))
 	}
+	if err := checkChunks(b.files); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
 
-	return reconstructFiles(rootDir, allFiles, params)
+// openBundle finds the parts of the bundle that inputFile belongs to and
+// sets up the sources their entries are read from, without reading them.
+// Bundles compressed in one piece (before windows were introduced) are
+// decompressed in memory.
+func openBundle(inputFile string) (*bundle, error) {
+	// Parts are found by name, matched by bundle ID and ordered by part number
+	parts, err := discoverParts(inputFile)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &bundle{id: parts[0].bundleID}
+	var compressedParts []*compressedPart
+	var windowed []string
+	for _, pf := range parts {
+		b.parts = append(b.parts, pf.path)
+		header, err := compressionHeaderOf(pf.path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading input file %s: %v", pf.path, err)
+		}
+		path, err := filepath.Abs(pf.path)
+		if err != nil {
+			return nil, err
+		}
+		if header == nil {
+			b.sources = append(b.sources, source{name: pf.path, path: path})
+			continue
+		}
+		if _, ok := header["Windows"]; ok {
+			// Windows run on from one part into the next
+			windowed = append(windowed, path)
+			continue
+		}
+
+		// Parts of a split compressed bundle are stitched together once all are read
+		content, err := os.ReadFile(pf.path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading input file %s: %v", pf.path, err)
+		}
+		_, body, err := splitFormatLine(content)
+		if err != nil {
+			return nil, fmt.Errorf("error reading input file %s: %v", pf.path, err)
+		}
+		compressedParts = append(compressedParts, splitCompressionHeader(body))
+	}
+
+	if len(windowed) > 0 {
+		name := fmt.Sprintf("%d compressed part(s)", len(windowed))
+		b.sources = append(b.sources, source{name: name, windows: windowed})
+	}
+
+	if len(compressedParts) > 0 {
+		payload, metadata, err := stitchCompressedParts(compressedParts)
+		if err != nil {
+			return nil, err
+		}
+		decompressed, err := decompress(payload, metadata, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error handling compression: %v", err)
+		}
+		name := fmt.Sprintf("%d compressed part(s)", len(compressedParts))
+		b.sources = append(b.sources, source{name: name, content: decompressed})
+	}
+	return b, nil
 }
 
-func parseInputFile(filename string) (string, []FileInfo, error) {
-	// Read entire file content first
-	content, err := os.ReadFile(filename)
+// compressionHeaderOf returns the compression header of a part, or nil if
+// the part isn't compressed
+func compressionHeaderOf(path string) (map[string]string, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
+	defer file.Close()
 
-	// Check for compression headers and decompress if needed
-	decompressedContent, err := handleCompression(content)
+	r := bufio.NewReader(file)
+	if _, err := readFormatLine(r); err != nil {
+		return nil, err
+	}
+	return readCompressionHeader(r)
+}
+
+// open returns a reader for the entries of the source, and what to close
+// once it has been read
+func (s source) open() (*entryReader, io.Closer, error) {
+	if s.windows != nil || s.content != nil {
+		var r *bufio.Reader
+		var closer io.Closer = io.NopCloser(nil)
+		var wr *windowReader
+		if s.windows != nil {
+			wr = newWindowReader(s.windows)
+			r, closer = bufio.NewReaderSize(wr, readerSize), wr
+		} else {
+			r = bufio.NewReaderSize(bytes.NewReader(s.content), readerSize)
+		}
+		version, err := readFormatLine(r)
+		if err != nil {
+			closer.Close()
+			return nil, nil, err
+		}
+		er := newEntryReader(r, version)
+		if wr != nil {
+			// The stream runs on across parts; find the one being read
+			er.partAt = func() int { return wr.partAt(wr.offset - int64(r.Buffered())) }
+		}
+		return er, closer, nil
+	}
+
+	file, err := os.Open(s.path)
 	if err != nil {
-		return "", nil, fmt.Errorf("error handling compression: %v", err)
+		return nil, nil, err
 	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	r := bufio.NewReaderSize(file, readerSize)
+	version, err := readFormatLine(r)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	er := newEntryReader(r, version)
+	er.file = file
+	er.fileSize = info.Size()
+	return er, file, nil
+}
 
+// entries calls fn for every entry of the source in order, with a reader for
+// the entry's content (nil if it has none). Content fn doesn't read is
+// skipped. It returns the reader, which holds the source's header fields.
+func (s source) entries(fn func(f *FileInfo, content io.Reader) error) (*entryReader, error) {
+	er, closer, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
 
-	// Parse the (decompressed) content
-	return parseContent(decompressedContent)
+	for {
+		f, err := er.next()
+		if err == io.EOF {
+			return er, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := fn(f, er.content); err != nil {
+			return nil, err
+		}
+	}
 }
 
-func handleCompression(content []byte) ([]byte, error) {
-	// Check if content starts with compression header
-	contentStr := string(content)
-	lines := strings.Split(contentStr, "\n")
-	
-	
-	if len(lines) < 1 || !strings.HasPrefix(lines[0], "# Compression: ") {
-		// Not compressed, return as-is
-		return content, nil
-	}
-
-	// Extract compression metadata
-	var compressionType string
-	var compressedStart int
-	currentLine := 0
-
-	// Parse compression headers
-	for currentLine < len(lines) {
-		line := lines[currentLine]
-		if strings.HasPrefix(line, "# Compression: ") {
-			compressionType = strings.TrimPrefix(line, "# Compression: ")
-		} else if strings.HasPrefix(line, "# Original Size: ") {
-			// Skip
-		} else if strings.HasPrefix(line, "# Compressed Size: ") {
-			// Skip
-		} else if strings.HasPrefix(line, "# Ratio: ") {
-			// Skip
-		} else if line == "" {
+// walk streams every entry of the bundle to fn, in bundle order, or only
+// the selected ones if the bundle was narrowed by selectEntries
+func (b *bundle) walk(fn func(f *FileInfo, content io.Reader) error) error {
+	each := fn
+	if b.selected != nil {
+		each = func(f *FileInfo, content io.Reader) error {
+			if !b.selected[f.path] {
+				return nil
+			}
+			return fn(f, content)
+		}
+	}
+	for _, s := range b.sources {
+		if _, err := s.entries(each); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compressedPart is one file of a compressed bundle: the compression header
+// fields and its slice of the compressed payload
+type compressedPart struct {
+	metadata   string
+	part       int
+	totalParts int
+	payload    []byte
+}
+
+// splitCompressionHeader separates the "# Compression:" header from the
+// payload. It returns nil if the content does not start with such a header.
+func splitCompressionHeader(content []byte) *compressedPart {
+	if !bytes.HasPrefix(content, []byte("# Compression: ")) {
+		// Not compressed
+		return nil
+	}
+
+	cp := &compressedPart{part: 1, totalParts: 1}
+	rest := content
+	for len(rest) > 0 {
+		end := bytes.IndexByte(rest, '\n')
+		if end == -1 {
+			end = len(rest)
+		}
+		line := string(rest[:end])
+
+		if line == "" {
 			// Empty line after headers
-			compressedStart = currentLine + 1
+			rest = rest[min(end+1, len(rest)):]
 			break
-		} else {
+		}
+		if !strings.HasPrefix(line, "# ") {
 			// Non-header line, content starts here
-			compressedStart = currentLine
 			break
 		}
-		currentLine++
+
+		switch {
+		case strings.HasPrefix(line, "# Compression: "):
+			cp.metadata = strings.TrimPrefix(line, "# Compression: ")
+		case strings.HasPrefix(line, "# Part: "):
+			fmt.Sscanf(strings.TrimPrefix(line, "# Part: "), "%d of %d", &cp.part, &cp.totalParts)
+		}
+		// Original Size, Compressed Size and Ratio are informational
+		rest = rest[min(end+1, len(rest)):]
 	}
 
-	if compressionType == "" || compressedStart == 0 {
+	if cp.metadata == "" {
 		// No valid compression header found
-		return content, nil
+		return nil
+	}
+	cp.payload = rest
+	return cp
+}
+
+// stitchCompressedParts orders the parts of a compressed bundle, checks that
+// none are missing, and joins their payloads back into one compressed stream
+func stitchCompressedParts(parts []*compressedPart) ([]byte, string, error) {
+	sort.Slice(parts, func(i, j int) bool { return parts[i].part < parts[j].part })
+
+	total := parts[0].totalParts
+	var missing []string
+	seen := make(map[int]bool)
+	for _, cp := range parts {
+		if cp.totalParts != total || cp.metadata != parts[0].metadata {
+			return nil, "", fmt.Errorf("compressed parts belong to different bundles")
+		}
+		if seen[cp.part] {
+			return nil, "", fmt.Errorf("compressed part %d found more than once", cp.part)
+		}
+		seen[cp.part] = true
+	}
+	for i := 1; i <= total; i++ {
+		if !seen[i] {
+			missing = append(missing, fmt.Sprint(i))
+		}
+	}
+	if len(missing) > 0 {
+		return nil, "", fmt.Errorf("compressed bundle has %d parts but part(s) %s are missing", total, strings.Join(missing, ", "))
 	}
 
-	// Get compressed content
-	compressedLines := lines[compressedStart:]
-	compressedContent := []byte(strings.Join(compressedLines, "\n"))
+	var payload bytes.Buffer
+	for _, cp := range parts {
+		payload.Write(cp.payload)
+	}
+	return payload.Bytes(), parts[0].metadata, nil
+}
 
+// decompress restores compressed content, with the shared dictionary it was
+// compressed against if there is one
+func decompress(compressedContent []byte, compressionType string, dictionary []byte) ([]byte, error) {
 	// Initialize compression if not already done
 	if err := compression.InitializeStrategies(); err != nil {
 		return nil, fmt.Errorf("failed to initialize compression strategies: %v", err)
@@ -140,6 +492,7 @@ func handleCompression(content []byte) ([]byte, error) {
 
 	// Create selector and decompress
 	selector := compression.NewSelector(compression.DefaultRegistry)
+	selector.SetDictionary(dictionary)
 	decompressed, err := selector.DecompressContent(compressedContent, compressionType)
 	if err != nil {
 		return nil, fmt.Errorf("decompression failed: %v", err)
@@ -148,208 +501,176 @@ func handleCompression(content []byte) ([]byte, error) {
 	return decompressed, nil
 }
 
-func parseContent(content []byte) (string, []FileInfo, error) {
-	var files []FileInfo
-	var currentFile *FileInfo
-	var rootDir string
-	isReadingCode := false
-	isFirstContentLine := true
+// reconstructFiles streams the entries of the bundle into rootDir, writing
+// and hashing each file as it is read. It returns the files that failed
+// size or hash verification. Directory permissions are left to the caller.
+// When staged, entries written by an earlier run are skipped, progress is
+// recorded and a signal stops the run.
+func reconstructFiles(rootDir string, b *bundle, params *config.Parameters, st *staging) ([]string, error) {
+	fmt.Printf("\nReconstructing project structure:\n")
+	if st != nil {
+		fmt.Printf("  Root directory: %s\n", st.dest)
+	} else {
+		fmt.Printf("  Root directory: %s\n", rootDir)
+	}
+	fmt.Printf("  Total items: %d\n", len(b.files))
 
-	scanner := bufio.NewScanner(strings.NewReader(string(content)))
-	for scanner.Scan() {
-		line := scanner.Text()
+	// Refuse entries that would write outside rootDir before writing anything
+	if err := reportUnsafe(findUnsafeEntries(b.files, params.SkipSymlinks), params.AllowUnsafe); err != nil {
+		return nil, err
+	}
+	
+	root := newDirWriter(rootDir)
+	if err := root.MkdirAll("", 0755); err != nil {
+		return nil, fmt.Errorf("error creating root directory: %v", err)
+	}
 
+	dirCount := 0
+	fileCount := 0
+	symlinkCount := 0
+	deletedCount := 0
+	totalSize := int64(0)
+	verifiedCount := 0
+	failedVerifications := []string{}
+
+	countFile := func(f FileInfo, size int64, verified bool) {
+		fileCount++
+		totalSize += size
+		// A file without a hash can still fail its recorded size
 		switch {
-		case strings.HasPrefix(line, "Root Directory: "):
-			rootDir = strings.TrimPrefix(line, "Root Directory: ")
+		case !verified:
+			failedVerifications = append(failedVerifications, f.path)
+		case f.sha256Hash != "":
+			verifiedCount++
+		}
+	}
 
-		case strings.HasPrefix(line, "## Directory: "):
-			if currentFile != nil && !isReadingCode {
-				files = append(files, *currentFile)
-				currentFile = nil
-			}
-			dirPath := strings.TrimPrefix(line, "## Directory: ")
-			if dirPath == "." {
-				dirPath = ""
-			}
-			// Convert forward slashes to OS-specific path separator
-			dirPath = filepath.FromSlash(dirPath)
-			files = append(files, FileInfo{
-				path:        dirPath,
-				isDirectory: true,
-			})
-
-		case strings.HasPrefix(line, "## Symlink: "):
-			if currentFile != nil && !isReadingCode {
-				files = append(files, *currentFile)
-			}
-			path := strings.TrimPrefix(line, "## Symlink: ")
-			if idx := strings.Index(path, " (Error"); idx != -1 {
-				path = path[:idx]
-			}
-			// Convert forward slashes to OS-specific path separator
-			path = filepath.FromSlash(path)
-			currentFile = &FileInfo{
-				path:      path,
-				isSymlink: true,
-			}
+	// Split files are written chunk by chunk as their parts are read
+	chunked := make(map[string]*chunkWriter)
+	defer func() {
+		for _, cw := range chunked {
+			cw.file.Close()
+		}
+	}()
 
-		case strings.HasPrefix(line, "## File: "):
-			if currentFile != nil && !isReadingCode {
-				files = append(files, *currentFile)
-			}
-			path := strings.TrimPrefix(line, "## File: ")
-			if idx := strings.Index(path, " (Skipped - Size:"); idx != -1 {
-				path = path[:idx]
-			}
-			// Convert forward slashes to OS-specific path separator
-			path = filepath.FromSlash(path)
-			currentFile = &FileInfo{
-				path:        path,
-				isDirectory: false,
-			}
+	// Symlinks already on disk are checked as each entry is written
+	confined := newConfinement(root)
+	checkPath := func(f *FileInfo) error {
+		if params.AllowUnsafe || f.path == "" || (f.isSymlink && params.SkipSymlinks) || f.isSkipped {
+			return nil
+		}
+		return confined.check(f.path, f.isSymlink || f.isDeleted)
+	}
 
-		case strings.HasPrefix(line, "Size: "):
-			if currentFile != nil {
-				size := strings.TrimPrefix(line, "Size: ")
-				size = strings.TrimSuffix(size, " bytes")
-				fmt.Sscanf(size, "%d", &currentFile.size)
+	write := func(f *FileInfo, content io.Reader) error {
+		if err := checkPath(f); err != nil {
+			return err
+		}
+		switch {
+		case f.isDirectory:
+			if f.path != "" {
+				if err := root.MkdirAll(f.path, 0755); err != nil {
+					return fmt.Errorf("error creating directory %s: %v", f.path, err)
+				}
+				dirCount++
 			}
 
-		case strings.HasPrefix(line, "SHA-256: "):
-			if currentFile != nil {
-				currentFile.sha256Hash = strings.TrimPrefix(line, "SHA-256: ")
-			}
+		case f.isSkipped:
+			fmt.Printf("  Skipping %s: it was too large to be collected\n", f.path)
 
-		case strings.HasPrefix(line, "Last Modified: "):
-			if currentFile != nil {
-				timeStr := strings.TrimPrefix(line, "Last Modified: ")
-				currentFile.lastModified, _ = time.Parse(time.RFC3339, timeStr)
+		case f.isDeleted:
+			// Only staged when the base bundle was reconstructed first; the
+			// destination's copy is removed when the staged tree is merged
+			if _, err := root.Lstat(f.path); err == nil {
+				if err := root.Remove(f.path); err != nil {
+					return fmt.Errorf("error deleting %s: %v", f.path, err)
+				}
+				confined.replaced(f.path)
 			}
+			deletedCount++
 
-		case strings.HasPrefix(line, "Target: "):
-			if currentFile != nil && currentFile.isSymlink {
-				currentFile.symlinkTarget = strings.TrimPrefix(line, "Target: ")
+		case f.isSymlink:
+			if params.SkipSymlinks {
+				fmt.Printf("  Skipping symlink: %s -> %s\n", f.path, f.symlinkTarget)
+				return nil
 			}
-
-		case line == "--- FILE CONTENT BEGIN ---":
-			if !isReadingCode {
-				isReadingCode = true
-				isFirstContentLine = true
-				if currentFile != nil {
-					currentFile.isBase64 = false
+			if err := reconstructSymlink(root, *f); err != nil {
+				// Check if it's a permission error on Windows
+				if strings.Contains(err.Error(), "A required privilege is not held") || 
+				   strings.Contains(err.Error(), "client") ||
+				   strings.Contains(err.Error(), "privilege") {
+					return fmt.Errorf("error creating symlink %s: %v\n\nTip: Creating symbolic links on Windows requires administrator privileges.\nYou can either:\n  1. Run this command as Administrator\n  2. Enable Developer Mode in Windows Settings\n  3. Use the -skip-symlinks flag to skip symbolic links", f.path, err)
 				}
+				return fmt.Errorf("error reconstructing symlink %s: %v", f.path, err)
 			}
-
-		case line == "--- FILE CONTENT BEGIN (BASE64) ---":
-			if !isReadingCode {
-				isReadingCode = true
-				isFirstContentLine = true
-				if currentFile != nil {
-					currentFile.isBase64 = true
+			confined.replaced(f.path)
+			symlinkCount++
+
+		case f.isChunk:
+			cw := chunked[f.path]
+			if cw == nil {
+				var err error
+				if cw, err = newChunkWriter(root, *f); err != nil {
+					return fmt.Errorf("error reconstructing file %s: %v", f.path, err)
 				}
+				chunked[f.path] = cw
 			}
-
-		case line == "--- FILE CONTENT END ---":
-			if isReadingCode {
-				isReadingCode = false
+			last, err := cw.write(f, content)
+			if err != nil || !last {
+				return err
+			}
+			delete(chunked, f.path)
+			verified, err := cw.close()
+			if err != nil {
+				return fmt.Errorf("error reconstructing file %s: %v", f.path, err)
 			}
+			if err := finishFile(root, cw.first, params); err != nil {
+				return err
+			}
+			countFile(cw.first, cw.offset, verified)
 
 		default:
-			if isReadingCode && currentFile != nil {
-				// Skip our content end marker
-				if line == "@CONTENT-END@" {
-					// Don't add this line to content
-				} else {
-					if !isFirstContentLine {
-						currentFile.content.WriteString("\n")
-					}
-					currentFile.content.WriteString(line)
-					isFirstContentLine = false
-				}
+			verified, size, err := reconstructFileWithVerification(root, *f, content)
+			if err != nil {
+				return fmt.Errorf("error reconstructing file %s: %v", f.path, err)
+			}
+			if err := finishFile(root, *f, params); err != nil {
+				return err
 			}
+			countFile(*f, size, verified)
 		}
+		return nil
 	}
 
-	if currentFile != nil && !isReadingCode {
-		files = append(files, *currentFile)
-	}
-
-	if err := scanner.Err(); err != nil {
-		return "", nil, err
-	}
-
-	if rootDir == "" {
-		return "", nil, fmt.Errorf("root directory not found in input file")
-	}
-
-	return rootDir, files, nil
-}
-
-func reconstructFiles(rootDir string, files []FileInfo, params *config.Parameters) error {
-	fmt.Printf("\nReconstructing project structure:\n")
-	fmt.Printf("  Root directory: %s\n", rootDir)
-	fmt.Printf("  Total items: %d\n", len(files))
-	
-	if err := os.MkdirAll(rootDir, 0755); err != nil {
-		return fmt.Errorf("error creating root directory: %v", err)
-	}
-
-	if err := os.Chdir(rootDir); err != nil {
-		return fmt.Errorf("error changing to root directory: %v", err)
-	}
-
-	dirCount := 0
-	fileCount := 0
-	symlinkCount := 0
-	totalSize := int64(0)
-	verifiedCount := 0
-	failedVerifications := []string{}
-
-	// First create all directories
-	for _, f := range files {
-		if f.isDirectory && f.path != "" {
-			if err := os.MkdirAll(f.path, 0755); err != nil {
-				return fmt.Errorf("error creating directory %s: %v", f.path, err)
+	entry := 0
+	err := b.walk(func(f *FileInfo, content io.Reader) error {
+		if st != nil {
+			if st.interrupted() {
+				return errInterrupted
 			}
-			dirCount++
-		}
-	}
-
-	// Then create all files and symlinks
-	for _, f := range files {
-		if !f.isDirectory {
-			if f.isSymlink {
-				if params.SkipSymlinks {
-					fmt.Printf("  Skipping symlink: %s -> %s\n", f.path, f.symlinkTarget)
-				} else {
-					if err := reconstructSymlink(f); err != nil {
-						// Check if it's a permission error on Windows
-						if strings.Contains(err.Error(), "A required privilege is not held") || 
-						   strings.Contains(err.Error(), "client") ||
-						   strings.Contains(err.Error(), "privilege") {
-							return fmt.Errorf("error creating symlink %s: %v\n\nTip: Creating symbolic links on Windows requires administrator privileges.\nYou can either:\n  1. Run this command as Administrator\n  2. Enable Developer Mode in Windows Settings\n  3. Use the -skip-symlinks flag to skip symbolic links", f.path, err)
-						}
-						return fmt.Errorf("error reconstructing symlink %s: %v", f.path, err)
-					}
-					symlinkCount++
-				}
-			} else {
-				verified, err := reconstructFileWithVerification(f, params.PreserveTimestamp)
-				if err != nil {
-					return fmt.Errorf("error reconstructing file %s: %v", f.path, err)
-				}
-				fileCount++
-				totalSize += int64(len(f.content.String()))
-				if f.sha256Hash != "" {
-					if verified {
-						verifiedCount++
-					} else {
-						failedVerifications = append(failedVerifications, f.path)
-					}
-				}
+			if entry < st.done {
+				// Written by the run being resumed
+				entry++
+				return nil
+			}
+			if content != nil {
+				content = &stopReader{r: content, stop: st.stop}
 			}
 		}
+
+		if err := write(f, content); err != nil {
+			return err
+		}
+		entry++
+
+		// A checkpoint never falls inside a split file or after a damaged one
+		if st != nil && len(chunked) == 0 && len(failedVerifications) == 0 {
+			st.progress(entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	fmt.Printf("\nReconstruction complete:\n")
@@ -358,6 +679,9 @@ func reconstructFiles(rootDir string, files []FileInfo, params *config.Parameter
 	if symlinkCount > 0 {
 		fmt.Printf("  Symlinks created: %d\n", symlinkCount)
 	}
+	if deletedCount > 0 {
+		fmt.Printf("  Deletions: %d\n", deletedCount)
+	}
 	fmt.Printf("  Total size: %s\n", formatSize(totalSize))
 	
 	if verifiedCount > 0 || len(failedVerifications) > 0 {
@@ -371,6 +695,19 @@ func reconstructFiles(rootDir string, files []FileInfo, params *config.Parameter
 		}
 	}
 
+	return failedVerifications, nil
+}
+
+// finishFile restores the timestamp and permissions of a written file
+func finishFile(root *dirWriter, f FileInfo, params *config.Parameters) error {
+	if params.PreserveTimestamp && !f.lastModified.IsZero() {
+		if err := root.Chtimes(f.path, f.lastModified, f.lastModified); err != nil {
+			return fmt.Errorf("error setting file time of %s: %v", f.path, err)
+		}
+	}
+	if err := applyPermissions(root, f, params); err != nil {
+		return fmt.Errorf("error restoring permissions of %s: %v", f.path, err)
+	}
 	return nil
 }
 
@@ -388,71 +725,82 @@ func formatSize(size int64) string {
 	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
 }
 
-func reconstructFileWithVerification(f FileInfo, preserveTimestamp bool) (bool, error) {
+// reconstructFileWithVerification writes a file from its content as it is
+// read, hashing it on the way. It returns whether the size and hash matched
+// those recorded, and the number of bytes written.
+func reconstructFileWithVerification(root *dirWriter, f FileInfo, content io.Reader) (bool, int64, error) {
 	dir := filepath.Dir(f.path)
 	if dir != "." {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return false, fmt.Errorf("error creating parent directory: %v", err)
+		if err := root.MkdirAll(dir, 0755); err != nil {
+			return false, 0, fmt.Errorf("error creating parent directory: %v", err)
 		}
 	}
 
-	file, err := os.Create(f.path)
+	file, err := root.Create(f.path)
 	if err != nil {
-		return false, fmt.Errorf("error creating file: %v", err)
+		return false, 0, fmt.Errorf("error creating file: %v", err)
 	}
 	defer file.Close()
 
-	content := f.content.String()
-	var fileContent []byte
-	
-	if f.isBase64 {
-		// Decode base64 content (remove newlines first)
-		cleanContent := strings.ReplaceAll(content, "\n", "")
-		decoded, err := base64.StdEncoding.DecodeString(cleanContent)
-		if err != nil {
-			return false, fmt.Errorf("error decoding base64 content: %v", err)
-		}
-		fileContent = decoded
-	} else {
-		fileContent = []byte(content)
+	sum, size, err := copyContent(file, &f, content)
+	if err != nil {
+		return false, 0, fmt.Errorf("error writing content: %v", err)
 	}
-	
-	if _, err := file.Write(fileContent); err != nil {
-		return false, fmt.Errorf("error writing content: %v", err)
+	if err := file.Close(); err != nil {
+		return false, 0, fmt.Errorf("error writing content: %v", err)
 	}
 
-	if preserveTimestamp && !f.lastModified.IsZero() {
-		if err := os.Chtimes(f.path, f.lastModified, f.lastModified); err != nil {
-			return false, fmt.Errorf("error setting file time: %v", err)
-		}
+	// Verify the size and hash if available, as verify does
+	if f.hasSize && size != f.size {
+		return false, size, nil
 	}
-
-	// Verify hash if available
 	if f.sha256Hash != "" {
-		hash := sha256.Sum256(fileContent)
-		calculatedHash := hex.EncodeToString(hash[:])
-		return calculatedHash == f.sha256Hash, nil
+		return sum == f.sha256Hash, size, nil
 	}
 
-	return true, nil
+	return true, size, nil
+}
+
+// copyContent decodes an entry's content into w, returning its SHA-256 in
+// hex and its size
+func copyContent(w io.Writer, f *FileInfo, content io.Reader) (string, int64, error) {
+	// An entry without a content block is an empty file
+	if content == nil {
+		content = strings.NewReader("")
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(w, hash), decodedContent(f, content))
+	if err != nil {
+		return "", size, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// decodedContent returns the raw bytes of an entry's content. Base64 content
+// is decoded as it is read; the line breaks it is wrapped at are ignored.
+func decodedContent(f *FileInfo, content io.Reader) io.Reader {
+	if f.isBase64 {
+		return base64.NewDecoder(base64.StdEncoding, content)
+	}
+	return content
 }
 
-func reconstructSymlink(f FileInfo) error {
+func reconstructSymlink(root *dirWriter, f FileInfo) error {
 	dir := filepath.Dir(f.path)
 	if dir != "." {
-		if err := os.MkdirAll(dir, 0755); err != nil {
+		if err := root.MkdirAll(dir, 0755); err != nil {
 			return fmt.Errorf("error creating parent directory: %v", err)
 		}
 	}
 
 	// Remove existing symlink if it exists
-	if _, err := os.Lstat(f.path); err == nil {
-		if err := os.Remove(f.path); err != nil {
+	if _, err := root.Lstat(f.path); err == nil {
+		if err := root.Remove(f.path); err != nil {
 			return fmt.Errorf("error removing existing symlink: %v", err)
 		}
 	}
 
-	if err := os.Symlink(f.symlinkTarget, f.path); err != nil {
+	if err := root.Symlink(f.symlinkTarget, f.path); err != nil {
 		return fmt.Errorf("error creating symlink: %v", err)
 	}
 
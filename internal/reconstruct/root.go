@@ -0,0 +1,55 @@
+package reconstruct
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// dirWriter makes the file system changes of a reconstruction below one
+// directory. Names are relative to that directory, so reconstruction doesn't
+// depend on or change the working directory, and several can run at once.
+type dirWriter struct {
+	dir string
+}
+
+func newDirWriter(dir string) *dirWriter {
+	return &dirWriter{dir: dir}
+}
+
+// path returns the on-disk path of a name relative to the root
+func (w *dirWriter) path(name string) string {
+	return filepath.Join(w.dir, name)
+}
+
+func (w *dirWriter) MkdirAll(name string, perm os.FileMode) error {
+	return os.MkdirAll(w.path(name), perm)
+}
+
+func (w *dirWriter) Create(name string) (*os.File, error) {
+	return os.Create(w.path(name))
+}
+
+func (w *dirWriter) Symlink(target, name string) error {
+	return os.Symlink(target, w.path(name))
+}
+
+func (w *dirWriter) Lstat(name string) (os.FileInfo, error) {
+	return os.Lstat(w.path(name))
+}
+
+func (w *dirWriter) Remove(name string) error {
+	return os.Remove(w.path(name))
+}
+
+func (w *dirWriter) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(w.path(name), atime, mtime)
+}
+
+func (w *dirWriter) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(w.path(name), mode)
+}
+
+func (w *dirWriter) Lchown(name string, uid, gid int) error {
+	return os.Lchown(w.path(name), uid, gid)
+}
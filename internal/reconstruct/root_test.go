@@ -0,0 +1,51 @@
+package reconstruct
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+)
+
+func TestReconstructConcurrently(t *testing.T) {
+	files := map[string][]byte{
+		"main.go":        []byte("package main\n"),
+		"docs/README.md": bytes.Repeat([]byte("docs\n"), 1000),
+	}
+	dir := collectFiles(t, files, nil)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out := filepath.Join(dir, fmt.Sprintf("out%d", i))
+			errs[i] = FromFile(filepath.Join(dir, "src_collated_part1.fb"), &config.Parameters{OutputDir: out})
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("reconstruct %d: %v", i, err)
+		}
+		got := readFiles(t, filepath.Join(dir, fmt.Sprintf("out%d", i)), files)
+		for name, want := range files {
+			if !bytes.Equal(got[name], want) {
+				t.Errorf("out%d/%s: got %q, want %q", i, name, truncate(got[name]), truncate(want))
+			}
+		}
+	}
+	if now, _ := os.Getwd(); now != wd {
+		t.Errorf("working directory changed from %s to %s", wd, now)
+	}
+}
@@ -0,0 +1,145 @@
+package reconstruct
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jonathanleahy/folder-bundler/internal/collect"
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+	"github.com/jonathanleahy/folder-bundler/internal/secrets"
+)
+
+// roundTrip collects files into a bundle and reconstructs it, returning the
+// content of each reconstructed file
+func roundTrip(t *testing.T, files map[string][]byte) map[string][]byte {
+	t.Helper()
+	return roundTripWith(t, files, nil)
+}
+
+// roundTripWith is roundTrip with collect parameters changed by configure
+func roundTripWith(t *testing.T, files map[string][]byte, configure func(*config.Parameters)) map[string][]byte {
+	t.Helper()
+
+	dir := collectFiles(t, files, configure)
+	if err := FromFile(filepath.Join(dir, "src_collated_part1.fb"), &config.Parameters{OutputDir: filepath.Join(dir, "out")}); err != nil {
+		t.Fatalf("reconstruct: %v", err)
+	}
+	return readFiles(t, filepath.Join(dir, "out"), files)
+}
+
+// collectFiles writes files to a temporary directory and collects them into
+// a bundle named src_collated in it, returning the directory
+func collectFiles(t *testing.T, files map[string][]byte, configure func(*config.Parameters)) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Join(src, filepath.Dir(name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(src, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	params := &config.Parameters{
+		MaxFileSize:   1 << 20,
+		MaxOutputSize: 1 << 20,
+		RootDir:       src,
+		RootLabel:     "src",
+		OutputBase:    filepath.Join(dir, "src_collated"),
+		SecretsMode:   secrets.ModeOff,
+	}
+	if configure != nil {
+		configure(params)
+	}
+	if err := collect.ProcessDirectory(params); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	return dir
+}
+
+// readFiles reads the reconstructed copies of files from dir
+func readFiles(t *testing.T, dir string, files map[string][]byte) map[string][]byte {
+	t.Helper()
+
+	result := make(map[string][]byte)
+	for name := range files {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		result[name] = content
+	}
+	return result
+}
+
+func TestRoundTripLineEndings(t *testing.T) {
+	files := map[string][]byte{
+		"lf.txt":               []byte("one\ntwo\n"),
+		"crlf.txt":             []byte("one\r\ntwo\r\n"),
+		"cr.txt":               []byte("one\rtwo\r"),
+		"mixed.txt":            []byte("one\r\ntwo\nthree\rfour"),
+		"no-final-newline.txt": []byte("one\ntwo"),
+		"crlf-no-final.txt":    []byte("one\r\ntwo"),
+		"trailing-cr.txt":      []byte("one\r"),
+		"blank-lines.txt":      []byte("\n\n\r\n"),
+		"empty.txt":            []byte(""),
+		"long-line.txt":        bytes.Repeat([]byte("x"), 200*1024),
+	}
+
+	got := roundTrip(t, files)
+	for name, want := range files {
+		if !bytes.Equal(got[name], want) {
+			t.Errorf("%s: got %q, want %q", name, truncate(got[name]), truncate(want))
+		}
+	}
+}
+
+func TestRoundTripMarkerCollisions(t *testing.T) {
+	files := map[string][]byte{
+		// A README documenting the bundle format contains its markers
+		"README.md": []byte("## File: fake.go\n\nSize: 3 bytes\n\n--- FILE CONTENT BEGIN ---\nx\n@CONTENT-END@\n--- FILE CONTENT END ---\n" +
+			"--- FILE CONTENT BEGIN (4 bytes) ---\n## Directory: nope\n--- MANIFEST BEGIN ---\n"),
+		"new\nline.txt":      []byte("path with a newline"),
+		" spaced .txt":       []byte("path with surrounding spaces"),
+		`"quoted".txt`:       []byte("path with quotes"),
+		"tab\tand\\back.txt": []byte("path with a tab and a backslash"),
+	}
+
+	got := roundTrip(t, files)
+	for name, want := range files {
+		if !bytes.Equal(got[name], want) {
+			t.Errorf("%q: got %q, want %q", name, truncate(got[name]), truncate(want))
+		}
+	}
+}
+
+func TestParseCRLFConvertedBundle(t *testing.T) {
+	// A bundle that went through a CRLF conversion still yields the LF content
+	bundle := "# Project Files Summary - Part 1\r\n\r\nRoot Directory: x\r\n\r\n---\r\n\r\n" +
+		"## File: a.txt\r\n\r\n--- FILE CONTENT BEGIN ---\r\none\r\ntwo\r\n@CONTENT-END@\r\n--- FILE CONTENT END ---\r\n"
+	got := readEntries(t, bundle)
+	if len(got) != 1 || got["a.txt"] != "one\ntwo" {
+		t.Errorf("got %q", got)
+	}
+
+	// Recorded lengths count the original LF line endings
+	bundle = "# folder-bundle format: 4\r\n# Project Files Summary - Part 1\r\n\r\nRoot Directory: x\r\n\r\n---\r\n\r\n" +
+		"## File: a.txt\r\n\r\n--- FILE CONTENT BEGIN (8 bytes) ---\r\none\r\ntwo\r\n\r\n--- FILE CONTENT END ---\r\n\r\n" +
+		"## File: b.txt\r\n\r\n--- FILE CONTENT BEGIN (0 bytes) ---\r\n\r\n--- FILE CONTENT END ---\r\n"
+	got = readEntries(t, bundle)
+	if len(got) != 2 || got["a.txt"] != "one\ntwo\n" || got["b.txt"] != "" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func truncate(b []byte) []byte {
+	if len(b) > 40 {
+		return b[:40]
+	}
+	return b
+}
@@ -0,0 +1,205 @@
+package reconstruct
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxLinkHops bounds how many symlinks a target is followed through, so
+// symlink loops are caught
+const maxLinkHops = 40
+
+// unsafeEntry is an entry that would reach outside the destination directory
+type unsafeEntry struct {
+	path   string
+	reason string
+}
+
+// destinationFor returns where a bundle is reconstructed when no -o is given:
+// the root directory it records, if that is inside the current directory,
+// and otherwise a directory of the same name in the current directory
+func destinationFor(rootDir string, allowUnsafe bool) (string, error) {
+	root := filepath.FromSlash(rootDir)
+	if allowUnsafe || filepath.IsLocal(root) {
+		return root, nil
+	}
+	base := filepath.Base(root)
+	if !filepath.IsLocal(base) {
+		return "", fmt.Errorf("bundle root %s is outside the current directory; use -o to choose where to reconstruct it", rootDir)
+	}
+	fmt.Printf("  Note: bundle root %s is outside the current directory; reconstructing into %s (use -o to choose another destination)\n", rootDir, base)
+	return base, nil
+}
+
+// findUnsafeEntries lists the entries that would reach outside the
+// destination: absolute paths, paths that climb out of it with "..",
+// symlinks that point outside it, and entries written through a symlink
+// created earlier in the bundle. Symlinks are ignored with -skip-symlinks.
+func findUnsafeEntries(files []FileInfo, skipSymlinks bool) []unsafeEntry {
+	var unsafe []unsafeEntry
+	links := make(map[string]string)
+	for _, f := range files {
+		if f.path == "" && f.isDirectory {
+			continue
+		}
+		if f.isSymlink && skipSymlinks {
+			continue
+		}
+		if !filepath.IsLocal(f.path) {
+			unsafe = append(unsafe, unsafeEntry{f.path, "path leaves the destination directory"})
+			continue
+		}
+		if link := linkAncestor(f.path, links, !f.isSymlink); link != "" {
+			unsafe = append(unsafe, unsafeEntry{f.path, fmt.Sprintf("written through the symlink %s", link)})
+			continue
+		}
+		if !f.isSymlink {
+			continue
+		}
+
+		links[f.path] = f.symlinkTarget
+		if _, ok := resolveLink(f.path, links); !ok {
+			unsafe = append(unsafe, unsafeEntry{f.path, fmt.Sprintf("symlink target %s is outside the destination directory", f.symlinkTarget)})
+		}
+	}
+	return unsafe
+}
+
+// linkAncestor returns the first of path's parent directories, or path
+// itself if self is set, that is one of links
+func linkAncestor(path string, links map[string]string, self bool) string {
+	parts := strings.Split(path, string(filepath.Separator))
+	end := len(parts) - 1
+	if self {
+		end = len(parts)
+	}
+	for i := 1; i <= end; i++ {
+		prefix := filepath.Join(parts[:i]...)
+		if _, ok := links[prefix]; ok {
+			return prefix
+		}
+	}
+	return ""
+}
+
+// resolveLink follows the symlink at path through the symlinks of the bundle
+// and returns where it ends up. It reports false if the target leaves the
+// destination at any step or goes round a loop.
+func resolveLink(path string, links map[string]string) (string, bool) {
+	hops := 0
+	var resolve func(dir []string, target string) ([]string, bool)
+	resolve = func(dir []string, target string) ([]string, bool) {
+		target = filepath.FromSlash(target)
+		if filepath.IsAbs(target) || filepath.VolumeName(target) != "" || strings.HasPrefix(target, string(filepath.Separator)) {
+			return nil, false
+		}
+		current := append([]string(nil), dir...)
+		for _, name := range strings.Split(target, string(filepath.Separator)) {
+			switch name {
+			case "", ".":
+				continue
+			case "..":
+				if len(current) == 0 {
+					return nil, false
+				}
+				current = current[:len(current)-1]
+				continue
+			}
+			current = append(current, name)
+			next, ok := links[filepath.Join(current...)]
+			if !ok {
+				continue
+			}
+			if hops++; hops > maxLinkHops {
+				return nil, false
+			}
+			resolved, ok := resolve(current[:len(current)-1], next)
+			if !ok {
+				return nil, false
+			}
+			current = resolved
+		}
+		return current, true
+	}
+
+	dir := filepath.Dir(path)
+	var parts []string
+	if dir != "." {
+		parts = strings.Split(dir, string(filepath.Separator))
+	}
+	resolved, ok := resolve(parts, links[path])
+	if !ok {
+		return "", false
+	}
+	return filepath.Join(resolved...), true
+}
+
+// reportUnsafe refuses a bundle with unsafe entries, listing them, unless
+// allowUnsafe is set
+func reportUnsafe(unsafe []unsafeEntry, allowUnsafe bool) error {
+	if len(unsafe) == 0 {
+		return nil
+	}
+	if allowUnsafe {
+		fmt.Printf("  Warning: reconstructing %d unsafe entries (-allow-unsafe):\n", len(unsafe))
+	} else {
+		fmt.Printf("\nUnsafe entries:\n")
+	}
+	for _, u := range unsafe {
+		fmt.Printf("    - %s: %s\n", u.path, u.reason)
+	}
+	if allowUnsafe {
+		return nil
+	}
+	return fmt.Errorf("bundle has %d unsafe entries that would write outside the destination directory; use -allow-unsafe to reconstruct them anyway", len(unsafe))
+}
+
+// confinement checks, just before each write, that nothing on disk would
+// redirect it outside the destination: a symlink in place of one of the
+// entry's parent directories, or of the file itself
+type confinement struct {
+	root *dirWriter
+	// Directories already checked to be real directories
+	checked map[string]bool
+}
+
+func newConfinement(root *dirWriter) *confinement {
+	return &confinement{root: root, checked: make(map[string]bool)}
+}
+
+// check returns an error if writing path would follow a symlink. A symlink
+// at path itself is allowed when replacing it is intended.
+func (c *confinement) check(path string, replacing bool) error {
+	parts := strings.Split(path, string(filepath.Separator))
+	for i := 1; i <= len(parts); i++ {
+		prefix := filepath.Join(parts[:i]...)
+		last := i == len(parts)
+		if !last && c.checked[prefix] {
+			continue
+		}
+		info, err := c.root.Lstat(prefix)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if last && replacing {
+				return nil
+			}
+			return fmt.Errorf("%s would be written through the symlink %s", path, prefix)
+		}
+		if !last {
+			c.checked[prefix] = true
+		}
+	}
+	return nil
+}
+
+// replaced forgets what is known about a path that is replaced by a symlink
+func (c *confinement) replaced(path string) {
+	delete(c.checked, path)
+}
@@ -0,0 +1,57 @@
+package reconstruct
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFindUnsafeEntries(t *testing.T) {
+	file := func(path string) FileInfo { return FileInfo{path: filepath.FromSlash(path)} }
+	link := func(path, target string) FileInfo {
+		return FileInfo{path: filepath.FromSlash(path), isSymlink: true, symlinkTarget: target}
+	}
+
+	files := []FileInfo{
+		{path: "", isDirectory: true},
+		file("src/main.go"),
+		file("../outside.txt"),
+		file("src/../../outside.txt"),
+		file("/etc/passwd"),
+		link("ok-link", "src/main.go"),
+		link("up-link", "../src/main.go"),
+		link("src/sibling", "../ok-link"),
+		link("abs-link", "/etc"),
+		link("escape", "src/../.."),
+		link("here", "."),
+		link("via-here", "here/.."),
+		link("loop-a", "loop-b"),
+		link("loop-b", "loop-a"),
+		link("dir-link", "src"),
+		file("dir-link/injected.go"),
+		file("ok-link"),
+	}
+	unsafe := make(map[string]bool)
+	for _, u := range findUnsafeEntries(files, false) {
+		unsafe[filepath.ToSlash(u.path)] = true
+	}
+
+	want := []string{
+		"../outside.txt", "src/../../outside.txt", "/etc/passwd", "up-link", "abs-link",
+		"escape", "via-here", "loop-b", "dir-link/injected.go", "ok-link",
+	}
+	for _, path := range want {
+		if !unsafe[path] {
+			t.Errorf("%s was not reported as unsafe", path)
+		}
+	}
+	if len(unsafe) != len(want) {
+		t.Errorf("got %d unsafe entries, want %d: %v", len(unsafe), len(want), unsafe)
+	}
+
+	// Symlinks aren't created with -skip-symlinks
+	for _, u := range findUnsafeEntries(files, true) {
+		if u.path == "abs-link" || u.path == filepath.FromSlash("dir-link/injected.go") {
+			t.Errorf("%s reported with symlinks skipped", u.path)
+		}
+	}
+}
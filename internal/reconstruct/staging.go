@@ -0,0 +1,303 @@
+package reconstruct
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// checkpointInterval is how often the checkpoint is brought up to date
+const checkpointInterval = time.Second
+
+// errInterrupted is returned when reconstruction is stopped by a signal
+var errInterrupted = errors.New("interrupted")
+
+// staging is a reconstruction in progress. Files are written to a hidden
+// directory next to the destination and only moved into place once every
+// hash has been verified, so a failed or interrupted run leaves the
+// destination as it was. With -resume, the staging directory and a
+// checkpoint are kept when a run fails, and the next -resume run continues
+// from the checkpoint.
+type staging struct {
+	dest       string
+	dir        string
+	checkpoint string
+	// Where a merge keeps what it replaces until it is done, and the paths
+	// a failed merge couldn't restore
+	undo       string
+	unrestored []string
+	bundleID   string
+	total      int
+	// Paths an incremental bundle deletes from the destination
+	deleted []string
+	// When each file was last modified, as the bundle records it
+	modified map[string]time.Time
+	// Entries already written, in bundle order
+	done     int
+	lastSave time.Time
+	// Closed when the process is asked to stop
+	stop    chan struct{}
+	signals chan os.Signal
+}
+
+// stopReader reads content until the process is asked to stop, so large
+// files don't hold up an interrupt
+type stopReader struct {
+	r    io.Reader
+	stop chan struct{}
+}
+
+func (sr *stopReader) Read(p []byte) (int, error) {
+	select {
+	case <-sr.stop:
+		return 0, errInterrupted
+	default:
+		return sr.r.Read(p)
+	}
+}
+
+// newStaging prepares the staging directory for reconstructing b into dest,
+// continuing from a checkpoint if resume is set and there is one
+func newStaging(dest string, b *bundle, resume bool) (*staging, error) {
+	abs, err := filepath.Abs(dest)
+	if err != nil {
+		return nil, err
+	}
+	parent, name := filepath.Dir(abs), filepath.Base(abs)
+	st := &staging{
+		dest:       abs,
+		dir:        filepath.Join(parent, "."+name+".folder-bundler-partial"),
+		checkpoint: filepath.Join(parent, "."+name+".folder-bundler-checkpoint"),
+		undo:       filepath.Join(parent, "."+name+".folder-bundler-undo"),
+		bundleID:   b.id,
+		total:      len(b.files),
+		modified:   make(map[string]time.Time),
+		stop:       make(chan struct{}),
+		signals:    make(chan os.Signal, 1),
+	}
+	for _, f := range b.files {
+		if f.isDeleted {
+			st.deleted = append(st.deleted, f.path)
+		}
+		if !f.lastModified.IsZero() {
+			st.modified[f.path] = f.lastModified
+		}
+	}
+	// Left by a merge that was killed, and the only copy of what it replaced
+	if _, err := os.Lstat(st.undo); err == nil {
+		return nil, fmt.Errorf("%s holds files an interrupted reconstruct replaced in %s; move them back or remove it first", st.undo, st.dest)
+	}
+
+	if resume {
+		done, err := st.loadCheckpoint()
+		if err != nil {
+			return nil, err
+		}
+		if done > 0 {
+			fmt.Printf("  Resuming after %d of %d entries\n", done, st.total)
+			st.done = done
+		}
+	}
+	if st.done == 0 {
+		// Left over from a run that was killed, or one that can't be resumed
+		if err := st.clear(); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.MkdirAll(st.dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating staging directory: %v", err)
+	}
+
+	signal.Notify(st.signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		if _, ok := <-st.signals; ok {
+			close(st.stop)
+		}
+	}()
+	return st, nil
+}
+
+// interrupted reports whether the process has been asked to stop
+func (st *staging) interrupted() bool {
+	select {
+	case <-st.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// progress records that the first done entries are written, saving the
+// checkpoint now and then
+func (st *staging) progress(done int) {
+	st.done = done
+	if time.Since(st.lastSave) >= checkpointInterval {
+		st.saveCheckpoint()
+	}
+}
+
+// loadCheckpoint returns how many entries an earlier run wrote, or 0 if
+// there is nothing to resume
+func (st *staging) loadCheckpoint() (int, error) {
+	content, err := os.ReadFile(st.checkpoint)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error reading checkpoint: %v", err)
+	}
+	if _, err := os.Stat(st.dir); err != nil {
+		fmt.Printf("  Note: staging directory %s is gone; starting over\n", st.dir)
+		return 0, nil
+	}
+
+	var bundleID string
+	var total, done int
+	for _, line := range strings.Split(string(content), "\n") {
+		switch {
+		case strings.HasPrefix(line, "Bundle ID: "):
+			bundleID = strings.TrimPrefix(line, "Bundle ID: ")
+		case strings.HasPrefix(line, "Entries: "):
+			fmt.Sscanf(strings.TrimPrefix(line, "Entries: "), "%d", &total)
+		case strings.HasPrefix(line, "Done: "):
+			fmt.Sscanf(strings.TrimPrefix(line, "Done: "), "%d", &done)
+		}
+	}
+	if bundleID != st.bundleID || total != st.total || done > total {
+		return 0, fmt.Errorf("checkpoint %s belongs to another bundle; run without -resume to start over", st.checkpoint)
+	}
+	return done, nil
+}
+
+// saveCheckpoint writes the checkpoint, replacing the previous one whole
+func (st *staging) saveCheckpoint() error {
+	st.lastSave = time.Now()
+	content := fmt.Sprintf("Bundle ID: %s\nEntries: %d\nDone: %d\n", st.bundleID, st.total, st.done)
+	tmp := st.checkpoint + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0644); err != nil {
+		return fmt.Errorf("error writing checkpoint: %v", err)
+	}
+	if err := os.Rename(tmp, st.checkpoint); err != nil {
+		return fmt.Errorf("error writing checkpoint: %v", err)
+	}
+	return nil
+}
+
+// clear removes the staging directory and checkpoint
+func (st *staging) clear() error {
+	if err := os.RemoveAll(st.dir); err != nil {
+		return fmt.Errorf("error removing staging directory: %v", err)
+	}
+	if err := os.Remove(st.checkpoint); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing checkpoint: %v", err)
+	}
+	return nil
+}
+
+// close stops listening for signals
+func (st *staging) close() {
+	signal.Stop(st.signals)
+	close(st.signals)
+}
+
+// rollback abandons the reconstruction. The staging directory is removed,
+// or kept with its checkpoint if keep is set so a -resume run can continue.
+// A merge that failed partway has been undone by commit already; paths it
+// couldn't restore are listed, and the undo directory is kept for them.
+func (st *staging) rollback(keep bool) {
+	if len(st.unrestored) > 0 {
+		fmt.Printf("  Rolled back, but these paths in %s could not be restored:\n", st.dest)
+		for _, path := range st.unrestored {
+			fmt.Printf("    - %s\n", path)
+		}
+		fmt.Printf("  What they replaced is kept in %s, and the staged files in %s\n", st.undo, st.dir)
+		return
+	}
+	if keep && st.done > 0 {
+		if err := st.saveCheckpoint(); err == nil {
+			fmt.Printf("  %d of %d entries are kept in %s; run again with -resume to continue\n", st.done, st.total, st.dir)
+			return
+		}
+	}
+	if err := st.clear(); err != nil {
+		fmt.Printf("  Warning: %v\n", err)
+		return
+	}
+	fmt.Printf("  Rolled back; %s was left unchanged\n", st.dest)
+}
+
+// commit moves the staged tree into place: by renaming it if the destination
+// doesn't exist yet, and otherwise by merging it into the destination once
+// it is certain nothing conflicts. A merge that fails partway is undone. It
+// returns what -on-conflict did with files that differ from the ones
+// already there.
+func (st *staging) commit(policy string, allowUnsafe bool) (*conflictReport, error) {
+	info, err := os.Stat(st.dest)
+	if os.IsNotExist(err) {
+		if err := os.Rename(st.dir, st.dest); err != nil {
+			return nil, fmt.Errorf("error moving %s into place: %v", st.dest, err)
+		}
+		st.cleanUp(nil)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s exists and is not a directory", st.dest)
+	}
+
+	// A directory that already replaced a deleted entry on an earlier run stays
+	var remove []string
+	deleted := make(map[string]bool)
+	for _, path := range st.deleted {
+		if isDir(filepath.Join(st.dest, path)) && isDir(filepath.Join(st.dir, path)) {
+			continue
+		}
+		remove = append(remove, path)
+		deleted[path] = true
+	}
+	steps, conflicts, err := planMerge(st.dir, st.dest, "", policy, allowUnsafe, deleted, st.modified)
+	if err != nil {
+		return nil, err
+	}
+	if len(conflicts) > 0 {
+		return nil, conflictError(conflicts, st.dest)
+	}
+	// Deletions first, so what replaces a deleted path can move in; they
+	// are undone with the rest of the merge if it fails
+	j := &mergeJournal{stage: st.dir, dest: st.dest, undo: st.undo}
+	removed, kept, err := removeDeleted(j, remove, allowUnsafe)
+	var report *conflictReport
+	if err == nil {
+		report, err = applyMerge(j, steps)
+	}
+	if err != nil {
+		st.unrestored = j.rollback()
+		return nil, err
+	}
+	st.cleanUp(j)
+	if len(st.deleted) > 0 {
+		printDeletions(removed, kept)
+	}
+	return report, nil
+}
+
+// cleanUp removes what is left of a reconstruction that is in place. It can
+// no longer fail, so problems are only warned about.
+func (st *staging) cleanUp(j *mergeJournal) {
+	if j != nil {
+		if err := j.finish(); err != nil {
+			fmt.Printf("  Warning: %v\n", err)
+		}
+	}
+	if err := st.clear(); err != nil {
+		fmt.Printf("  Warning: %v\n", err)
+	}
+}
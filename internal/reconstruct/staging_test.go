@@ -0,0 +1,127 @@
+package reconstruct
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+)
+
+func TestReconstructRollsBack(t *testing.T) {
+	files := map[string][]byte{
+		"a.txt":     []byte("first\n"),
+		"sub/b.txt": []byte("second\n"),
+	}
+	dir := collectFiles(t, files, nil)
+	bundlePath := filepath.Join(dir, "src_collated_part1.fb")
+	content, err := os.ReadFile(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	damaged := bytes.Replace(content, []byte("second\n"), []byte("SECOND\n"), 1)
+	if err := os.WriteFile(bundlePath, damaged, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// An existing destination is left exactly as it was
+	out := filepath.Join(dir, "out")
+	if err := os.MkdirAll(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(out, "a.txt"), []byte("mine\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = FromFile(bundlePath, &config.Parameters{OutputDir: out})
+	if err == nil || !strings.Contains(err.Error(), "failed verification") {
+		t.Fatalf("damaged bundle: got error %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(out, "a.txt")); string(got) != "mine\n" {
+		t.Errorf("a.txt was changed to %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(out, "sub")); !os.IsNotExist(err) {
+		t.Errorf("sub was created in the destination")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.Contains(e.Name(), "folder-bundler") {
+			t.Errorf("%s was left behind", e.Name())
+		}
+	}
+
+	// Once repaired, the bundle is merged into the destination
+	if err := os.WriteFile(bundlePath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := FromFile(bundlePath, &config.Parameters{OutputDir: out}); err != nil {
+		t.Fatalf("reconstruct: %v", err)
+	}
+	got := readFiles(t, out, files)
+	for name, want := range files {
+		if !bytes.Equal(got[name], want) {
+			t.Errorf("%s: got %q, want %q", name, got[name], want)
+		}
+	}
+}
+
+func TestMergeRollsBack(t *testing.T) {
+	dir := t.TempDir()
+	stage, dest := filepath.Join(dir, "stage"), filepath.Join(dir, "dest")
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(stage, "a.txt"), "new a\n")
+	write(filepath.Join(stage, "b.txt"), "new b\n")
+	write(filepath.Join(stage, "sub", "c.txt"), "new c\n")
+	write(filepath.Join(dest, "a.txt"), "old a\n")
+	write(filepath.Join(dest, "b.txt"), "old b\n")
+	write(filepath.Join(dest, "gone", "old.txt"), "deleted\n")
+
+	// Deletions of an incremental bundle come first. The last step fails,
+	// as its staged file is missing.
+	j := &mergeJournal{stage: stage, dest: dest, undo: filepath.Join(dir, "undo")}
+	if removed, _, err := removeDeleted(j, []string{"gone/old.txt", "gone"}, false); err != nil || removed != 2 {
+		t.Fatalf("removeDeleted: removed %d, %v", removed, err)
+	}
+	_, err := applyMerge(j, []mergeStep{
+		{path: "a.txt", action: actionReplace, conflict: true},
+		{path: "b.txt", action: actionBackup, conflict: true},
+		{path: "sub", action: actionMove},
+		{path: "missing.txt", action: actionMove},
+	})
+	if err == nil {
+		t.Fatal("merge with a missing staged file succeeded")
+	}
+	if failed := j.rollback(); len(failed) > 0 {
+		t.Fatalf("not restored: %v", failed)
+	}
+
+	for path, want := range map[string]string{
+		filepath.Join(dest, "a.txt"):           "old a\n",
+		filepath.Join(dest, "b.txt"):           "old b\n",
+		filepath.Join(dest, "gone", "old.txt"): "deleted\n",
+		filepath.Join(stage, "a.txt"):          "new a\n",
+		filepath.Join(stage, "b.txt"):          "new b\n",
+		filepath.Join(stage, "sub", "c.txt"):   "new c\n",
+	} {
+		if got, err := os.ReadFile(path); err != nil || string(got) != want {
+			t.Errorf("%s: got %q (%v), want %q", path, got, err, want)
+		}
+	}
+	for _, path := range []string{filepath.Join(dest, "b.txt.bak"), filepath.Join(dest, "sub"), j.undo} {
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was left behind", path)
+		}
+	}
+}
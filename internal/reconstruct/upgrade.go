@@ -0,0 +1,136 @@
+package reconstruct
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jonathanleahy/folder-bundler/internal/collect"
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+	"github.com/jonathanleahy/folder-bundler/internal/secrets"
+)
+
+// Upgrade rewrites a bundle written in an older format in the current one.
+// The bundle is restored into a temporary directory and collected again,
+// and the new parts replace the old ones under the same names. Output
+// settings such as -out-max and -compress apply to the new bundle.
+func Upgrade(inputFile string, params *config.Parameters) error {
+	fmt.Printf("Upgrading: %s\n", inputFile)
+
+	b, err := readBundle(inputFile, os.Stdout)
+	if err != nil {
+		return err
+	}
+	if b.format == config.FormatVersion {
+		fmt.Printf("Bundle is already in format %d; nothing to do\n", config.FormatVersion)
+		return nil
+	}
+
+	tmpDir, err := os.MkdirTemp("", "folder-bundler-upgrade-")
+	if err != nil {
+		return fmt.Errorf("error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	restoreDir := filepath.Join(tmpDir, "root")
+	restoreParams := *params
+	restoreParams.PreserveTimestamp = true
+	restoreParams.SkipSymlinks = false
+	restoreParams.Umask = 0
+	restoreParams.PreserveOwner = false
+	failed, err := reconstructFiles(restoreDir, b, &restoreParams, nil)
+	if err != nil {
+		return err
+	}
+	if err := applyDirectoryPermissions(newDirWriter(restoreDir), b.files, &restoreParams); err != nil {
+		return err
+	}
+	// Don't carry corrupted content over under a fresh hash
+	if len(failed) > 0 {
+		return fmt.Errorf("%s fails verification; refusing to upgrade a damaged bundle", failed[0])
+	}
+
+	// Files the original collection skipped are recorded as skipped again;
+	// an empty stand-in keeps each in its place in the walk
+	skipped := make(map[string]config.SkippedFile)
+	for _, f := range b.files {
+		if !f.isSkipped {
+			continue
+		}
+		path := filepath.Join(restoreDir, f.path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("error creating directory: %v", err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			return fmt.Errorf("error creating file: %v", err)
+		}
+		skipped[filepath.ToSlash(f.path)] = config.SkippedFile{Size: f.size, MaxSize: f.skippedMax}
+	}
+
+	// Collect everything that was restored, exactly as it is
+	collectParams := *params
+	collectParams.RootDir = restoreDir
+	collectParams.RootLabel = b.rootDir
+	// The new parts are written under a temporary name next to the old ones,
+	// which they only replace once all of them have been written
+	base := upgradeBase(inputFile, b.rootDir)
+	collectParams.OutputBase = base + ".upgrade"
+	collectParams.Rules = nil
+	collectParams.IncludeHidden = true
+	collectParams.SkipGitignore = true
+	collectParams.MaxFileSize = math.MaxInt64
+	collectParams.SecretsMode = secrets.ModeOff
+	collectParams.ConfigFiles = nil
+	collectParams.Profile = ""
+	collectParams.Skipped = skipped
+	if err := collect.ProcessDirectory(&collectParams); err != nil {
+		return err
+	}
+
+	if err := replaceParts(b.parts, collectParams.OutputBase, base); err != nil {
+		return err
+	}
+
+	fmt.Printf("Upgraded to format %d: %s_part*.fb\n", config.FormatVersion, base)
+	return nil
+}
+
+// upgradeBase returns the part file prefix of the bundle inputFile belongs to
+func upgradeBase(inputFile, rootDir string) string {
+	dir := filepath.Dir(inputFile)
+	if m := partFileName.FindStringSubmatch(filepath.Base(inputFile)); m != nil {
+		return filepath.Join(dir, m[1])
+	}
+	if base := strings.TrimSuffix(filepath.Base(inputFile), ".fb"); base != "" {
+		return filepath.Join(dir, base)
+	}
+	return filepath.Join(dir, filepath.Base(rootDir)+"_collated")
+}
+
+// replaceParts moves the parts written under tmpBase to base, and removes
+// the old parts that no new part took the place of
+func replaceParts(oldParts []string, tmpBase, base string) error {
+	parts, err := discoverParts(tmpBase + "_part1.fb")
+	if err != nil {
+		return err
+	}
+	replaced := make(map[string]bool)
+	for _, pf := range parts {
+		name := fmt.Sprintf("%s_part%d.fb", base, pf.part)
+		if err := os.Rename(pf.path, name); err != nil {
+			return fmt.Errorf("error replacing %s: %v", name, err)
+		}
+		replaced[filepath.Clean(name)] = true
+	}
+	for _, part := range oldParts {
+		if replaced[filepath.Clean(part)] {
+			continue
+		}
+		if err := os.Remove(part); err != nil {
+			return fmt.Errorf("error removing old part %s: %v", part, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package reconstruct
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+)
+
+// Verify checks a bundle without writing anything: every part must be
+// present and readable, and every file's content must decode to its
+// recorded size and SHA-256. Each entry is reported, and an error is
+// returned if any of them fails.
+func Verify(inputFile string, params *config.Parameters) error {
+	fmt.Printf("Verifying: %s\n", inputFile)
+
+	b, err := readBundle(inputFile, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nEntries:\n")
+	verified, unhashed, skipped := 0, 0, 0
+	// An entry can fail more than one check; it is counted once
+	failed := make(map[string]bool)
+	fail := func(path, reason string) {
+		fmt.Printf("  FAILED   %s: %s\n", path, reason)
+		failed[path] = true
+	}
+	check := func(f FileInfo, sum string, size int64) {
+		switch {
+		case f.hasSize && size != f.size:
+			fail(f.path, fmt.Sprintf("%d bytes, recorded as %d", size, f.size))
+		case f.sha256Hash == "":
+			fmt.Printf("  OK       %s (%s, no SHA-256 recorded)\n", f.path, formatSize(size))
+			unhashed++
+		case sum != f.sha256Hash:
+			fail(f.path, "SHA-256 does not match")
+		default:
+			fmt.Printf("  OK       %s (%s)\n", f.path, formatSize(size))
+			verified++
+		}
+	}
+
+	// Chunks are checked as they are read; a file is reported with its last chunk
+	chunked := make(map[string]*chunkWriter)
+	brokenChunks := make(map[string]bool)
+	err = b.walk(func(f *FileInfo, content io.Reader) error {
+		switch {
+		case f.isDirectory, f.isSymlink, f.isDeleted:
+			// Nothing to check beyond their paths
+
+		case f.isSkipped:
+			fmt.Printf("  SKIPPED  %s: it was too large to be collected\n", f.path)
+			skipped++
+
+		case f.isChunk:
+			if brokenChunks[f.path] {
+				return nil
+			}
+			cw := chunked[f.path]
+			if cw == nil {
+				cw = newChunkVerifier(*f, io.Discard)
+				chunked[f.path] = cw
+			}
+			last, err := cw.write(f, content)
+			if err != nil {
+				fail(f.path, err.Error())
+				brokenChunks[f.path] = true
+				return nil
+			}
+			if last {
+				delete(chunked, f.path)
+				check(cw.first, hex.EncodeToString(cw.hash.Sum(nil)), cw.offset)
+			}
+
+		default:
+			sum, size, err := copyContent(io.Discard, f, content)
+			if err != nil {
+				fail(f.path, err.Error())
+				return nil
+			}
+			check(*f, sum, size)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error reading bundle: %v", err)
+	}
+
+	// Entries reconstruct would refuse to write
+	unsafe := findUnsafeEntries(b.files, params.SkipSymlinks)
+	if !params.AllowUnsafe {
+		for _, u := range unsafe {
+			fail(u.path, u.reason)
+		}
+	}
+
+	fmt.Printf("\nVerification summary:\n")
+	fmt.Printf("  Parts: %d, complete\n", len(b.parts))
+	fmt.Printf("  Entries: %d\n", len(b.files))
+	fmt.Printf("  Files verified: %d\n", verified)
+	if unhashed > 0 {
+		fmt.Printf("  Files without a recorded SHA-256: %d\n", unhashed)
+	}
+	if skipped > 0 {
+		fmt.Printf("  Files skipped at collection: %d\n", skipped)
+	}
+	if len(failed) > 0 {
+		fmt.Printf("  Failed: %d\n", len(failed))
+		return fmt.Errorf("%d entries failed verification", len(failed))
+	}
+	fmt.Printf("Bundle is valid\n")
+	return nil
+}
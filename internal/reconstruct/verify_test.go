@@ -0,0 +1,86 @@
+package reconstruct
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+)
+
+func TestVerify(t *testing.T) {
+	files := map[string][]byte{
+		"a.txt":   []byte("first\n"),
+		"bin.dat": {0, 1, 2, 0xff, 0xfe},
+	}
+	dir := collectFiles(t, files, nil)
+	bundlePath := filepath.Join(dir, "src_collated_part1.fb")
+	if err := Verify(bundlePath, &config.Parameters{}); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	content, err := os.ReadFile(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	damaged := bytes.Replace(content, []byte("first\n"), []byte("FIRST\n"), 1)
+	if err := os.WriteFile(bundlePath, damaged, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(bundlePath, &config.Parameters{}); err == nil || !strings.Contains(err.Error(), "1 entries failed") {
+		t.Errorf("damaged bundle: got error %v", err)
+	}
+
+	// Without a recorded size only the hash is checked
+	undamaged := regexp.MustCompile(`(?m)^Size: .*\n\n`).ReplaceAll(content, nil)
+	if err := os.WriteFile(bundlePath, undamaged, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(bundlePath, &config.Parameters{}); err != nil {
+		t.Errorf("bundle without sizes: %v", err)
+	}
+
+	// An entry that fails several checks is counted once
+	unsafe := "# Project Files Summary - Part 1\n\nRoot Directory: x\n\n---\n\n" +
+		"## File: ../evil.txt\n\nSize: 99 bytes\n\n--- FILE CONTENT BEGIN ---\nevil\n@CONTENT-END@\n--- FILE CONTENT END ---\n"
+	if err := os.WriteFile(bundlePath, []byte(unsafe), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(bundlePath, &config.Parameters{}); err == nil || !strings.Contains(err.Error(), "1 entries failed") {
+		t.Errorf("unsafe entry of the wrong size: got error %v", err)
+	}
+
+	// Nothing but the bundle was written
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Name() != "src" && e.Name() != "src_collated_part1.fb" {
+			t.Errorf("verify wrote %s", e.Name())
+		}
+	}
+}
+
+func TestReconstructChecksSize(t *testing.T) {
+	// Without a hash, reconstruct still checks the recorded size as verify does
+	dir := t.TempDir()
+	bundlePath := filepath.Join(dir, "bundle.fb")
+	for size, ok := range map[string]bool{"Size: 4 bytes\n\n": true, "Size: 99 bytes\n\n": false, "": true} {
+		bundle := "# Project Files Summary - Part 1\n\nRoot Directory: x\n\n---\n\n" +
+			"## File: a.txt\n\n" + size + "--- FILE CONTENT BEGIN ---\none\n\n@CONTENT-END@\n--- FILE CONTENT END ---\n"
+		if err := os.WriteFile(bundlePath, []byte(bundle), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := FromFile(bundlePath, &config.Parameters{OutputDir: t.TempDir()})
+		if ok && err != nil {
+			t.Errorf("%q: %v", size, err)
+		}
+		if !ok && (err == nil || !strings.Contains(err.Error(), "1 file(s) failed verification")) {
+			t.Errorf("%q: got error %v, want a failed verification", size, err)
+		}
+	}
+}
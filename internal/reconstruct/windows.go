@@ -0,0 +1,198 @@
+package reconstruct
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// windowBegin matches the line in front of a compressed window
+var windowBegin = regexp.MustCompile(`^--- WINDOW BEGIN \((\d+) bytes\) ---$`)
+
+// readCompressionHeader reads the "# Key: value" lines of a compression
+// header up to the empty line that ends it. It returns nil if r doesn't
+// start with a compression header.
+func readCompressionHeader(r *bufio.Reader) (map[string]string, error) {
+	prefix, _ := r.Peek(len("# Compression: "))
+	if string(prefix) != "# Compression: " {
+		return nil, nil
+	}
+
+	header := make(map[string]string)
+	for {
+		line, err := readLine(r)
+		if err == io.EOF || line == "" {
+			return header, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if key, value, ok := strings.Cut(strings.TrimPrefix(line, "# "), ": "); ok {
+			header[key] = value
+		}
+	}
+}
+
+// windowReader reads the parts of a bundle that was compressed window by
+// window as one stream, decompressing a window at a time
+type windowReader struct {
+	paths []string
+	file  *os.File
+	r     *bufio.Reader
+	// Decompressed content not read yet
+	window []byte
+	// Decompressed bytes read so far, and where each part's content starts
+	offset int64
+	starts []partStart
+	// Shared dictionary from part 1's header, if the windows use one
+	dictionary []byte
+}
+
+// partStart is the offset in the decompressed stream where a part begins
+type partStart struct {
+	offset int64
+	part   int
+}
+
+func newWindowReader(paths []string) *windowReader {
+	return &windowReader{paths: paths}
+}
+
+func (wr *windowReader) Read(p []byte) (int, error) {
+	for len(wr.window) == 0 {
+		if err := wr.nextWindow(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, wr.window)
+	wr.window = wr.window[n:]
+	wr.offset += int64(n)
+	return n, nil
+}
+
+// partAt returns the part that the decompressed content at offset came
+// from. Offsets must not go backwards between calls.
+func (wr *windowReader) partAt(offset int64) int {
+	for len(wr.starts) > 1 && wr.starts[1].offset <= offset {
+		wr.starts = wr.starts[1:]
+	}
+	if len(wr.starts) == 0 {
+		return 0
+	}
+	return wr.starts[0].part
+}
+
+// nextWindow reads and decompresses the next window, moving on to the next
+// part at the end of one
+func (wr *windowReader) nextWindow() error {
+	for {
+		if wr.r == nil {
+			if len(wr.paths) == 0 {
+				return io.EOF
+			}
+			if err := wr.openPart(wr.paths[0]); err != nil {
+				return fmt.Errorf("error reading input file %s: %v", wr.paths[0], err)
+			}
+			wr.paths = wr.paths[1:]
+		}
+
+		line, err := readLine(wr.r)
+		if err == io.EOF {
+			wr.Close()
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			continue
+		}
+		metadata, ok := strings.CutPrefix(line, "## Window: ")
+		if !ok {
+			return fmt.Errorf("unexpected line in %s: %q", wr.file.Name(), line)
+		}
+
+		window, err := wr.readWindow(metadata)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", wr.file.Name(), err)
+		}
+		wr.window = window
+		if len(window) > 0 {
+			return nil
+		}
+	}
+}
+
+// openPart opens a part and skips its format line and compression header
+func (wr *windowReader) openPart(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	wr.file = file
+	wr.r = bufio.NewReaderSize(file, readerSize)
+	if _, err := readFormatLine(wr.r); err != nil {
+		return err
+	}
+	header, err := readCompressionHeader(wr.r)
+	if err != nil {
+		return err
+	}
+	var part int
+	fmt.Sscanf(header["Part"], "%d", &part)
+	if encoded, ok := header["Dictionary"]; ok {
+		if wr.dictionary, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+			return fmt.Errorf("malformed shared dictionary: %v", err)
+		}
+	}
+	wr.starts = append(wr.starts, partStart{offset: wr.offset + int64(len(wr.window)), part: part})
+	return nil
+}
+
+// readWindow reads one compressed window and decompresses it
+func (wr *windowReader) readWindow(metadata string) ([]byte, error) {
+	var begin string
+	for begin == "" {
+		line, err := readLine(wr.r)
+		if err != nil {
+			return nil, fmt.Errorf("window without content")
+		}
+		begin = line
+	}
+	m := windowBegin.FindStringSubmatch(begin)
+	if m == nil {
+		return nil, fmt.Errorf("malformed window: %q", begin)
+	}
+	length, err := strconv.Atoi(m[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed window: %q", begin)
+	}
+
+	compressed := make([]byte, length)
+	if _, err := io.ReadFull(wr.r, compressed); err != nil {
+		return nil, fmt.Errorf("window is shorter than its recorded %d bytes", length)
+	}
+	if blank, err := readLine(wr.r); err != nil || blank != "" {
+		return nil, fmt.Errorf("window does not match its recorded length of %d bytes", length)
+	}
+	if end, err := readLine(wr.r); err != nil || end != "--- WINDOW END ---" {
+		return nil, fmt.Errorf("window is not followed by its end marker")
+	}
+
+	return decompress(compressed, metadata, wr.dictionary)
+}
+
+// Close closes the part being read
+func (wr *windowReader) Close() error {
+	if wr.file == nil {
+		return nil
+	}
+	err := wr.file.Close()
+	wr.file, wr.r = nil, nil
+	return err
+}
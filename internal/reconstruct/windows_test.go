@@ -0,0 +1,153 @@
+package reconstruct
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonathanleahy/folder-bundler/internal/config"
+)
+
+func TestRoundTripCompressedWindows(t *testing.T) {
+	binary := make([]byte, 100001)
+	for i := range binary {
+		binary[i] = byte(i * 7919 >> 3)
+	}
+	files := map[string][]byte{
+		"README.md": []byte("## File: fake.go\n--- WINDOW BEGIN (4 bytes) ---\n--- WINDOW END ---\n"),
+		"crlf.txt":  []byte("one\r\ntwo\r\n"),
+		// Streamed through the window in pieces that split runes and lines
+		"unicode.txt": bytes.Repeat([]byte("héllo wörld ✓\n"), 5000),
+		"image.bin":   binary,
+	}
+	for i := 0; i < 40; i++ {
+		var b strings.Builder
+		for j := 0; j < 200; j++ {
+			fmt.Fprintf(&b, "func handler%d_%d(w http.ResponseWriter, r *http.Request) error { return nil }\n", i, j)
+		}
+		files[fmt.Sprintf("pkg%d/handlers%d.go", i%4, i)] = []byte(b.String())
+	}
+
+	for _, strategy := range []string{"auto", "dictionary"} {
+		t.Run(strategy, func(t *testing.T) {
+			got := roundTripWith(t, files, func(p *config.Parameters) {
+				p.EnableCompression = true
+				p.CompressionStrategy = strategy
+				// Small enough for many windows and parts
+				p.MaxOutputSize = 64 * 1024
+				p.MaxMemory = 1 << 20
+			})
+			for name, want := range files {
+				if !bytes.Equal(got[name], want) {
+					t.Errorf("%s: got %q, want %q", name, truncate(got[name]), truncate(want))
+				}
+			}
+		})
+	}
+}
+
+func TestCompressedWindowsShareDictionary(t *testing.T) {
+	files := make(map[string][]byte)
+	for i := 0; i < 20; i++ {
+		var b strings.Builder
+		for j := 0; j < 200; j++ {
+			fmt.Fprintf(&b, "func handler%d_%d(w http.ResponseWriter, r *http.Request) error { return nil }\n", i, j)
+		}
+		files[fmt.Sprintf("pkg/handlers%d.go", i)] = []byte(b.String())
+	}
+	dir := collectFiles(t, files, func(p *config.Parameters) {
+		p.EnableCompression = true
+		p.CompressionStrategy = "dictionary"
+		p.MaxOutputSize = 64 * 1024
+		p.MaxMemory = 1 << 20
+	})
+
+	// The dictionary is built once and recorded in part 1's header; the
+	// windows only hold references to it
+	parts, err := filepath.Glob(filepath.Join(dir, "src_collated_part*.fb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared := 0
+	for _, part := range parts {
+		content, err := os.ReadFile(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header, _, _ := bytes.Cut(content, []byte("\n\n"))
+		if hasDictionary := bytes.Contains(header, []byte("\n# Dictionary: ")); hasDictionary != strings.HasSuffix(part, "_part1.fb") {
+			t.Errorf("%s: dictionary in header is %v", filepath.Base(part), hasDictionary)
+		}
+		if bytes.Contains(content, []byte("--- BEGIN DICTIONARY ---")) {
+			t.Errorf("%s: a window carries a dictionary of its own", filepath.Base(part))
+		}
+		shared += bytes.Count(content, []byte("## Window: shared-dictionary:"))
+	}
+	if shared < 2 {
+		t.Errorf("%d windows use the shared dictionary, want most of them", shared)
+	}
+
+	out := filepath.Join(dir, "out")
+	if err := FromFile(filepath.Join(dir, "src_collated_part1.fb"), &config.Parameters{OutputDir: out}); err != nil {
+		t.Fatalf("reconstruct: %v", err)
+	}
+	for name, content := range readFiles(t, out, files) {
+		if !bytes.Equal(content, files[name]) {
+			t.Errorf("%s: got %q, want %q", name, truncate(content), truncate(files[name]))
+		}
+	}
+}
+
+func TestRoundTripCompressedParts(t *testing.T) {
+	files := make(map[string][]byte)
+	for i := 0; i < 30; i++ {
+		var b strings.Builder
+		for j := 0; j < 300; j++ {
+			fmt.Fprintf(&b, "const value%d_%d = %d // %x\n", i, j, i*j, i*7919+j*104729)
+		}
+		files[fmt.Sprintf("pkg%d/values%d.go", i%3, i)] = []byte(b.String())
+	}
+
+	const maxOutput = 32 * 1024
+	dir := collectFiles(t, files, func(p *config.Parameters) {
+		p.EnableCompression = true
+		p.CompressionStrategy = "auto"
+		p.MaxOutputSize = maxOutput
+		p.MaxMemory = 1 << 20
+	})
+	parts, err := filepath.Glob(filepath.Join(dir, "src_collated_part*.fb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) < 2 {
+		t.Fatalf("got %d parts, want the bundle split", len(parts))
+	}
+
+	// Every part is within -out-max and says which of how many parts it is
+	for i := 1; i <= len(parts); i++ {
+		name := filepath.Join(dir, fmt.Sprintf("src_collated_part%d.fb", i))
+		content, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(content) > maxOutput {
+			t.Errorf("part %d: %d bytes, over -out-max %d", i, len(content), maxOutput)
+		}
+		if header := fmt.Sprintf("# Part: %d of %d\n", i, len(parts)); !bytes.Contains(content, []byte(header)) {
+			t.Errorf("part %d: no %q header", i, strings.TrimSpace(header))
+		}
+	}
+
+	out := filepath.Join(dir, "out")
+	if err := FromFile(filepath.Join(dir, "src_collated_part1.fb"), &config.Parameters{OutputDir: out}); err != nil {
+		t.Fatalf("reconstruct: %v", err)
+	}
+	for name, content := range readFiles(t, out, files) {
+		if !bytes.Equal(content, files[name]) {
+			t.Errorf("%s: got %q, want %q", name, truncate(content), truncate(files[name]))
+		}
+	}
+}
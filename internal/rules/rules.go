@@ -0,0 +1,135 @@
+package rules
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/jonathanleahy/folder-bundler/internal/glob"
+)
+
+// Rule is a single include or exclude glob matched against slash-separated
+// paths relative to the collection root. A trailing slash restricts the rule
+// to directories.
+type Rule struct {
+	Pattern string
+	Include bool
+	dirOnly bool
+}
+
+// Set is an ordered list of rules where the last matching rule wins
+type Set struct {
+	rules          []Rule
+	explicit       int
+	defaultExclude bool
+}
+
+// NewSet creates an empty rule set
+func NewSet() *Set {
+	return &Set{}
+}
+
+// Add appends an include or exclude rule. When the first rule added this
+// way is an include, files that match no rule are excluded, so
+// "-include 'src/**'" on its own collects only src.
+func (s *Set) Add(pattern string, include bool) error {
+	if err := s.add(pattern, include); err != nil {
+		return err
+	}
+	if s.explicit == 0 && include {
+		s.defaultExclude = true
+	}
+	s.explicit++
+	return nil
+}
+
+func (s *Set) add(pattern string, include bool) error {
+	pattern = strings.TrimSpace(filepath.ToSlash(pattern))
+	if pattern == "" {
+		return fmt.Errorf("empty pattern")
+	}
+
+	rule := Rule{Pattern: pattern, Include: include}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	pattern = strings.TrimPrefix(pattern, "./")
+	if err := glob.Validate(pattern); err != nil {
+		return fmt.Errorf("invalid pattern '%s': %v", rule.Pattern, err)
+	}
+	rule.Pattern = pattern
+
+	s.rules = append(s.rules, rule)
+	return nil
+}
+
+// ExcludeDir adds the shorthand for -skip-dirs: a directory with this name at any depth
+func (s *Set) ExcludeDir(name string) error {
+	return s.add("**/"+escape(name)+"/", false)
+}
+
+// ExcludeFile adds the shorthand for -skip-files: a file with this name at any depth
+func (s *Set) ExcludeFile(name string) error {
+	return s.add("**/"+escape(name), false)
+}
+
+// ExcludeExt adds the shorthand for -skip-ext: files with this extension at any depth
+func (s *Set) ExcludeExt(ext string) error {
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return s.add("**/*"+escape(ext), false)
+}
+
+// Rules returns the rules in evaluation order
+func (s *Set) Rules() []Rule {
+	return s.rules
+}
+
+// Excluded reports whether a path relative to the root should be skipped.
+// The last matching rule decides. Files that match no rule are kept unless
+// the rules started with an include.
+// Directories are only pruned by an exclude rule, and never while a later
+// include rule could still match something inside them.
+func (s *Set) Excluded(relPath string, isDir bool) bool {
+	relPath = filepath.ToSlash(relPath)
+
+	last := -1
+	for i, rule := range s.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if glob.Match(rule.Pattern, relPath) {
+			last = i
+		}
+	}
+
+	if last == -1 {
+		return !isDir && s.defaultExclude
+	}
+	if s.rules[last].Include {
+		return false
+	}
+	if isDir {
+		for _, rule := range s.rules[last+1:] {
+			if rule.Include && glob.MatchPrefix(rule.Pattern, relPath) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// escape quotes glob metacharacters in a literal file or directory name
+func escape(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,62 @@
+package rules
+
+import "testing"
+
+func TestSet_Excluded(t *testing.T) {
+	set := NewSet()
+	set.ExcludeDir("node_modules")
+	set.ExcludeExt(".log")
+	set.ExcludeFile(".DS_Store")
+	set.Add("docs/generated/**", false)
+	set.Add("docs/generated/index.md", true)
+	set.Add("**/*_test.go", false)
+
+	tests := []struct {
+		path     string
+		isDir    bool
+		excluded bool
+	}{
+		{"main.go", false, false},
+		{"pkg/main_test.go", false, true},
+		{"web/node_modules", true, true},
+		{"node_modules", false, false},
+		{"logs/app.log", false, true},
+		{"a/b/.DS_Store", false, true},
+		{"docs/generated", true, false},
+		{"docs/generated/api.md", false, true},
+		{"docs/generated/index.md", false, false},
+		{"docs/guide.md", false, false},
+	}
+
+	for _, tt := range tests {
+		if got := set.Excluded(tt.path, tt.isDir); got != tt.excluded {
+			t.Errorf("Excluded(%q, dir=%v) = %v, want %v", tt.path, tt.isDir, got, tt.excluded)
+		}
+	}
+}
+
+func TestSet_LeadingIncludeExcludesUnmatchedFiles(t *testing.T) {
+	set := NewSet()
+	set.ExcludeExt(".exe")
+	set.Add("src/**", true)
+	set.Add("src/**/*.exe", true)
+
+	if set.Excluded("README.md", false) != true {
+		t.Errorf("Expected unmatched file to be excluded when rules start with an include")
+	}
+	if set.Excluded("docs", true) != false {
+		t.Errorf("Expected unmatched directory to be walked")
+	}
+	if set.Excluded("src/app/main.go", false) != false {
+		t.Errorf("Expected included file to be kept")
+	}
+	if set.Excluded("src/tool.exe", false) != false {
+		t.Errorf("Expected later include to override the -skip-ext shorthand")
+	}
+}
+
+func TestSet_InvalidPattern(t *testing.T) {
+	if err := NewSet().Add("src/[", false); err == nil {
+		t.Errorf("Expected error for malformed pattern")
+	}
+}
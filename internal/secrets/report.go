@@ -0,0 +1,29 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// WriteReport writes the findings to filename. The report lists file, line
+// and kind of secret only; secret values are never written.
+func WriteReport(filename, mode string, findings []Finding) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	action := map[string]string{
+		ModeWarn:   "not redacted",
+		ModeRedact: "redacted",
+		ModeFail:   "collection aborted",
+	}[mode]
+
+	fmt.Fprintf(file, "# Secret Scan Report\n\nGenerated on: %s\n\nMode: %s\n\nFindings: %d\n\n", time.Now().Format(time.RFC3339), mode, len(findings))
+	for _, f := range findings {
+		fmt.Fprintf(file, "%s:%d: %s (%s)\n", f.Path, f.Line, f.Rule, action)
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package secrets
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Modes for handling detected secrets
+const (
+	ModeOff    = "off"
+	ModeWarn   = "warn"
+	ModeRedact = "redact"
+	ModeFail   = "fail"
+)
+
+// ValidModes lists the accepted values for the -secrets flag
+var ValidModes = []string{ModeOff, ModeWarn, ModeRedact, ModeFail}
+
+// Detector finds secrets in text content
+type Detector interface {
+	// Name identifies the kind of secret in reports and placeholders
+	Name() string
+
+	// Find returns the byte ranges [start, end) of secret values in content
+	Find(content string) [][2]int
+}
+
+// Finding is a detected secret. It records where the secret is, never its value.
+type Finding struct {
+	Path string
+	Line int
+	Rule string
+}
+
+// Scanner runs a set of detectors over file content
+type Scanner struct {
+	detectors []Detector
+}
+
+// NewScanner creates a scanner with the built-in detectors plus one detector
+// per user regular expression. If a user pattern has a capture group, only the
+// first group is treated as the secret.
+func NewScanner(userPatterns []string) (*Scanner, error) {
+	s := &Scanner{detectors: builtinDetectors()}
+	for i, pattern := range userPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret pattern '%s': %v", pattern, err)
+		}
+		s.detectors = append(s.detectors, &regexDetector{name: fmt.Sprintf("custom-%d", i+1), re: re})
+	}
+	return s, nil
+}
+
+// Add registers an additional detector
+func (s *Scanner) Add(d Detector) {
+	s.detectors = append(s.detectors, d)
+}
+
+type match struct {
+	start, end int
+	rule       string
+}
+
+// Scan looks for secrets in content. It returns one finding per secret and,
+// if redact is true, the content with every secret replaced by a placeholder.
+func (s *Scanner) Scan(path, content string, redact bool) (string, []Finding) {
+	merged := s.find(content)
+	if len(merged) == 0 {
+		return content, nil
+	}
+
+	findings := make([]Finding, 0, len(merged))
+	for _, m := range merged {
+		findings = append(findings, Finding{
+			Path: path,
+			Line: strings.Count(content[:m.start], "\n") + 1,
+			Rule: m.rule,
+		})
+	}
+	if !redact {
+		return content, findings
+	}
+
+	var b strings.Builder
+	prev := 0
+	for _, m := range merged {
+		b.WriteString(content[prev:m.start])
+		b.WriteString(Placeholder(m.rule))
+		prev = m.end
+	}
+	b.WriteString(content[prev:])
+	return b.String(), findings
+}
+
+// find runs every detector over content and returns the matches in order,
+// with overlapping ones merged
+func (s *Scanner) find(content string) []match {
+	var matches []match
+	for _, d := range s.detectors {
+		for _, r := range d.Find(content) {
+			matches = append(matches, match{start: r[0], end: r[1], rule: d.Name()})
+		}
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+
+	// Merge overlapping matches, keeping the rule of the earliest one
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].start != matches[j].start {
+			return matches[i].start < matches[j].start
+		}
+		return matches[i].end > matches[j].end
+	})
+	merged := matches[:1]
+	for _, m := range matches[1:] {
+		last := &merged[len(merged)-1]
+		if m.start < last.end {
+			if m.end > last.end {
+				last.end = m.end
+			}
+			continue
+		}
+		merged = append(merged, m)
+	}
+	return merged
+}
+
+// Placeholder is the marker that replaces a redacted secret
+func Placeholder(rule string) string {
+	return fmt.Sprintf("[REDACTED:%s]", rule)
+}
+
+// regexDetector reports matches of a regular expression, or of its first
+// capture group when it has one. With randomOnly set, matches must look like
+// generated values: high entropy and a mix of letters and digits.
+type regexDetector struct {
+	name       string
+	re         *regexp.Regexp
+	randomOnly bool
+}
+
+func (d *regexDetector) Name() string {
+	return d.name
+}
+
+func (d *regexDetector) Find(content string) [][2]int {
+	var ranges [][2]int
+	for _, loc := range d.re.FindAllStringSubmatchIndex(content, -1) {
+		start, end := loc[0], loc[1]
+		if len(loc) >= 4 && loc[2] >= 0 {
+			start, end = loc[2], loc[3]
+		}
+		if d.randomOnly && !looksRandom(content[start:end]) {
+			continue
+		}
+		ranges = append(ranges, [2]int{start, end})
+	}
+	return ranges
+}
+
+func builtinDetectors() []Detector {
+	return []Detector{
+		&regexDetector{
+			name: "aws-access-key",
+			re:   regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[0-9A-Z]{16}\b`),
+		},
+		&regexDetector{
+			name: "aws-secret-key",
+			re:   regexp.MustCompile(`(?i)aws.{0,20}secret.{0,20}?["'\s:=]+([A-Za-z0-9/+]{40})\b`),
+		},
+		&regexDetector{
+			name: "gcp-api-key",
+			re:   regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`),
+		},
+		&regexDetector{
+			name: "gcp-service-account-key",
+			re:   regexp.MustCompile(`"private_key_id"\s*:\s*"([0-9a-f]{40})"`),
+		},
+		&regexDetector{
+			name: "private-key",
+			re:   regexp.MustCompile(`(?s)-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----.*?-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`),
+		},
+		&regexDetector{
+			name: "jwt",
+			re:   regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]{10,}\.eyJ[A-Za-z0-9_\-]{10,}\.[A-Za-z0-9_\-]{10,}`),
+		},
+		&regexDetector{
+			name:       "generic-secret",
+			re:         regexp.MustCompile(`(?i)[\w.\-]*(?:secret|token|passw(?:or)?d|api[_\-]?key|access[_\-]?key|credential)[\w.\-]*["']?\s*[:=]\s*["']?([A-Za-z0-9+/_\-.=]{16,})`),
+			randomOnly: true,
+		},
+	}
+}
+
+// looksRandom reports whether s resembles a generated credential rather than
+// a word or identifier
+func looksRandom(s string) bool {
+	hasDigit := strings.ContainsAny(s, "0123456789")
+	hasLetter := strings.IndexFunc(s, func(r rune) bool {
+		return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+	}) >= 0
+	return hasDigit && hasLetter && entropy(s) >= 3.5
+}
+
+// entropy returns the Shannon entropy of s in bits per character
+func entropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+	total := float64(len([]rune(s)))
+	var e float64
+	for _, c := range counts {
+		p := float64(c) / total
+		e -= p * math.Log2(p)
+	}
+	return e
+}
@@ -0,0 +1,110 @@
+package secrets
+
+import (
+	"io"
+	"strings"
+)
+
+// StreamOverlap is how much scanned content a Stream holds back for the next
+// window. A secret up to this long, such as a 4096-bit RSA key, is found even
+// when it crosses a window boundary.
+const StreamOverlap = 8 << 10
+
+// minStreamWindow keeps the overlap a small share of what each window scans,
+// as the overlap is scanned twice
+const minStreamWindow = 4 * StreamOverlap
+
+// Stream scans content written to it a window at a time, so a file need not
+// be held in memory to be scanned. Scanned content is passed on to w, with
+// secrets replaced by placeholders when redact is set.
+type Stream struct {
+	scanner  *Scanner
+	path     string
+	w        io.Writer
+	redact   bool
+	window   int
+	buf      []byte
+	line     int
+	findings []Finding
+}
+
+// NewStream creates a Stream that scans window bytes at a time, or
+// minStreamWindow if that is more, plus the overlap carried over from the
+// previous window
+func (s *Scanner) NewStream(path string, w io.Writer, redact bool, window int) *Stream {
+	return &Stream{scanner: s, path: path, w: w, redact: redact, window: max(window, minStreamWindow)}
+}
+
+func (st *Stream) Write(p []byte) (int, error) {
+	st.buf = append(st.buf, p...)
+	for len(st.buf) >= st.window+StreamOverlap {
+		held := len(st.buf)
+		if err := st.scan(false); err != nil {
+			return 0, err
+		}
+		if len(st.buf) == held {
+			// A secret runs across the whole window; wait for more content
+			break
+		}
+	}
+	return len(p), nil
+}
+
+// Close scans and passes on whatever content is still held
+func (st *Stream) Close() error {
+	return st.scan(true)
+}
+
+// Findings returns the secrets found so far, one per secret
+func (st *Stream) Findings() []Finding {
+	return st.findings
+}
+
+// scan looks for secrets in the held content and passes it on, except for
+// the overlap kept for the next window. Unless final, the cut falls at a line
+// start near the end of the window, so detectors anchored on word boundaries
+// see whole lines, and never inside a secret.
+func (st *Stream) scan(final bool) error {
+	content := string(st.buf)
+	matches := st.scanner.find(content)
+
+	cut := len(content)
+	if !final {
+		cut -= StreamOverlap
+		from := max(0, cut-StreamOverlap)
+		if i := strings.LastIndexByte(content[from:cut], '\n'); i >= 0 {
+			cut = from + i + 1
+		}
+		for _, m := range matches {
+			if m.start < cut && m.end > cut {
+				cut = m.start
+				break
+			}
+		}
+	}
+
+	prev := 0
+	for _, m := range matches {
+		if m.end > cut {
+			break
+		}
+		st.findings = append(st.findings, Finding{
+			Path: st.path,
+			Line: st.line + strings.Count(content[:m.start], "\n") + 1,
+			Rule: m.rule,
+		})
+		if st.redact {
+			if _, err := io.WriteString(st.w, content[prev:m.start]+Placeholder(m.rule)); err != nil {
+				return err
+			}
+			prev = m.end
+		}
+	}
+	if _, err := io.WriteString(st.w, content[prev:cut]); err != nil {
+		return err
+	}
+
+	st.line += strings.Count(content[:cut], "\n")
+	st.buf = append(st.buf[:0], st.buf[cut:]...)
+	return nil
+}
@@ -0,0 +1,346 @@
+package textdiff
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// maxCost bounds the work spent looking for a shortest diff, counted in line
+// comparisons. Myers' algorithm takes about the line count times the number
+// of changed lines, so this stops texts that are both long and far apart
+// from taking minutes; it is a variable so tests can lower it.
+var maxCost = 20_000_000
+
+// ErrTooDifferent is returned by Unified when the texts are too long and too
+// far apart to diff in reasonable time
+var ErrTooDifferent = errors.New("texts are too far apart to diff")
+
+// op is one line of an edit script: kept (' '), deleted ('-') or inserted
+// ('+'). a and b are its line numbers in each text, or the position it sits
+// at in the text it isn't in.
+type op struct {
+	kind byte
+	a, b int
+}
+
+// Unified returns a unified diff turning a into b, with context lines of
+// context around each change, or "" if they are the same. Lines keep their
+// line endings, so a missing final newline shows up as a change.
+func Unified(oldName, newName, a, b string, context int) (string, error) {
+	if a == b {
+		return "", nil
+	}
+	al, bl := splitLines(a), splitLines(b)
+	ops, ok := editScript(al, bl)
+	if !ok {
+		return "", ErrTooDifferent
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// A hunk runs until the next change is more than twice the context away
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*context {
+				end += context
+				if end > len(ops) {
+					end = len(ops)
+				}
+				break
+			}
+			end = next
+		}
+		writeHunk(&out, ops[start:end], al, bl)
+		i = end
+	}
+	return out.String(), nil
+}
+
+// writeHunk writes the header and lines of one hunk
+func writeHunk(out *strings.Builder, ops []op, a, b []string) {
+	aLen, bLen := 0, 0
+	for _, o := range ops {
+		if o.kind != '+' {
+			aLen++
+		}
+		if o.kind != '-' {
+			bLen++
+		}
+	}
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(ops[0].a, aLen), hunkRange(ops[0].b, bLen))
+	for _, o := range ops {
+		line := ""
+		switch o.kind {
+		case '+':
+			line = b[o.b]
+		default:
+			line = a[o.a]
+		}
+		out.WriteByte(o.kind)
+		out.WriteString(line)
+		if !strings.HasSuffix(line, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange renders the start and length of one side of a hunk; an empty
+// side starts at the line before it
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+// splitLines splits text after each newline
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// editScript finds a shortest edit script from a to b with the linear-space
+// form of Myers' algorithm, so memory stays proportional to the two texts
+// however far apart they are. It gives up once the search passes maxCost.
+func editScript(a, b []string) ([]op, bool) {
+	// Lines are compared as numbers, one per distinct line
+	ids := make(map[string]int)
+	number := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, line := range lines {
+			id, ok := ids[line]
+			if !ok {
+				id = len(ids)
+				ids[line] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	d := differ{a: number(a), b: number(b)}
+	d.compare(0, len(a), 0, len(b))
+	if d.cost > maxCost {
+		return nil, false
+	}
+	return groupChanges(d.ops), true
+}
+
+// differ collects the edit script as compare splits the texts up
+type differ struct {
+	a, b []int
+	ops  []op
+	cost int
+}
+
+// compare appends the edit script turning a[aLo:aHi] into b[bLo:bHi]
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	if d.cost > maxCost {
+		return
+	}
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.ops = append(d.ops, op{' ', aLo, bLo})
+		aLo++
+		bLo++
+	}
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && d.a[aHi-suffix-1] == d.b[bHi-suffix-1] {
+		suffix++
+	}
+	aHi -= suffix
+	bHi -= suffix
+
+	switch {
+	case aLo == aHi:
+		for y := bLo; y < bHi; y++ {
+			d.ops = append(d.ops, op{'+', aLo, y})
+		}
+	case bLo == bHi:
+		for x := aLo; x < aHi; x++ {
+			d.ops = append(d.ops, op{'-', x, bLo})
+		}
+	default:
+		x, y, ok := 0, 0, false
+		// Ranges with no line in common would search every diagonal for nothing
+		if d.shareLine(aLo, aHi, bLo, bHi) {
+			x, y, ok = d.middleSnake(aLo, aHi, bLo, bHi)
+		}
+		if ok {
+			d.compare(aLo, x, bLo, y)
+			d.compare(x, aHi, y, bHi)
+		} else {
+			for x := aLo; x < aHi; x++ {
+				d.ops = append(d.ops, op{'-', x, bLo})
+			}
+			for y := bLo; y < bHi; y++ {
+				d.ops = append(d.ops, op{'+', aHi, y})
+			}
+		}
+	}
+
+	for i := 0; i < suffix; i++ {
+		d.ops = append(d.ops, op{' ', aHi + i, bHi + i})
+	}
+}
+
+// shareLine reports whether any line of a[aLo:aHi] is also in b[bLo:bHi]
+func (d *differ) shareLine(aLo, aHi, bLo, bHi int) bool {
+	d.cost += aHi - aLo + bHi - bLo
+	inB := make(map[int]bool, bHi-bLo)
+	for _, id := range d.b[bLo:bHi] {
+		inB[id] = true
+	}
+	for _, id := range d.a[aLo:aHi] {
+		if inB[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// middleSnake runs Myers' search forwards from the start and backwards from
+// the end of a[aLo:aHi] and b[bLo:bHi] at once and returns the point where
+// the two paths meet, which lies on a shortest edit script. Both ranges must
+// be non-empty and differ in their first and last lines.
+func (d *differ) middleSnake(aLo, aHi, bLo, bHi int) (int, int, bool) {
+	n, m := aHi-aLo, bHi-bLo
+	maxD := (n + m + 1) / 2
+	offset := maxD
+	forward := make([]int, 2*maxD+2)
+	backward := make([]int, 2*maxD+2)
+	for i := range forward {
+		forward[i] = -1
+		backward[i] = -1
+	}
+	forward[offset+1] = 0
+	backward[offset+1] = 0
+
+	delta := n - m
+	// With an odd delta the paths can only meet on a forward step
+	odd := delta%2 != 0
+	// Diagonals that have run off an edge aren't searched again
+	fStart, fEnd, bStart, bEnd := 0, 0, 0, 0
+	for step := 0; step < maxD; step++ {
+		if d.cost > maxCost {
+			return 0, 0, false
+		}
+		for k := -step + fStart; k <= step-fEnd; k += 2 {
+			i := offset + k
+			var x int
+			if k == -step || (k != step && forward[i-1] < forward[i+1]) {
+				x = forward[i+1]
+			} else {
+				x = forward[i-1] + 1
+			}
+			start := x
+			y := x - k
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			d.cost += x - start + 1
+			forward[i] = x
+			switch {
+			case x > n:
+				fEnd += 2
+			case y > m:
+				fStart += 2
+			case odd:
+				j := offset + delta - k
+				if j >= 0 && j < len(backward) && backward[j] != -1 && x >= n-backward[j] {
+					return aLo + x, bLo + y, true
+				}
+			}
+		}
+
+		for k := -step + bStart; k <= step-bEnd; k += 2 {
+			i := offset + k
+			var x int
+			if k == -step || (k != step && backward[i-1] < backward[i+1]) {
+				x = backward[i+1]
+			} else {
+				x = backward[i-1] + 1
+			}
+			start := x
+			y := x - k
+			for x < n && y < m && d.a[aHi-x-1] == d.b[bHi-y-1] {
+				x++
+				y++
+			}
+			d.cost += x - start + 1
+			backward[i] = x
+			switch {
+			case x > n:
+				bEnd += 2
+			case y > m:
+				bStart += 2
+			case !odd:
+				j := offset + delta - k
+				if j >= 0 && j < len(forward) && forward[j] != -1 {
+					fx := forward[j]
+					fy := offset + fx - j
+					if fx >= n-x {
+						return aLo + fx, bLo + fy, true
+					}
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// groupChanges reorders each run of changes so its deletions come before its
+// insertions, the way unified diffs show a replaced block
+func groupChanges(ops []op) []op {
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		end := i
+		dels := 0
+		for end < len(ops) && ops[end].kind != ' ' {
+			if ops[end].kind == '-' {
+				dels++
+			}
+			end++
+		}
+		a, b := ops[i].a, ops[i].b
+		for j := i; j < end; j++ {
+			if j-i < dels {
+				ops[j] = op{'-', a + j - i, b}
+			} else {
+				ops[j] = op{'+', a + dels, b + j - i - dels}
+			}
+		}
+		i = end
+	}
+	return ops
+}
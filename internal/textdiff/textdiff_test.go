@@ -0,0 +1,170 @@
+package textdiff
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"same", "one\ntwo\n", "one\ntwo\n", ""},
+		{
+			"changed line",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			"1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			"--- a\n+++ b\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			"separate hunks",
+			"a\n1\n2\n3\n4\n5\n6\n7\nb\n",
+			"A\n1\n2\n3\n4\n5\n6\n7\nB\n",
+			"--- a\n+++ b\n@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n 3\n@@ -6,4 +6,4 @@\n 5\n 6\n 7\n-b\n+B\n",
+		},
+		{
+			"insert into empty",
+			"",
+			"new\n",
+			"--- a\n+++ b\n@@ -0,0 +1 @@\n+new\n",
+		},
+		{
+			"no final newline",
+			"x\ny",
+			"x\ny\n",
+			"--- a\n+++ b\n@@ -1,2 +1,2 @@\n x\n-y\n\\ No newline at end of file\n+y\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := Unified("a", "b", tt.a, tt.b, 3); err != nil || got != tt.want {
+				t.Errorf("got %v:\n%s\nwant:\n%s", err, got, tt.want)
+			}
+		})
+	}
+}
+
+// differentTexts returns two texts of n lines in which every line differs
+// but for one in shareEvery, if shareEvery isn't 0
+func differentTexts(n, shareEvery int) (string, string, int) {
+	var a, b strings.Builder
+	shared := 0
+	for i := 0; i < n; i++ {
+		if shareEvery > 0 && i%shareEvery == 0 {
+			fmt.Fprintf(&a, "shared line %d\n", i)
+			fmt.Fprintf(&b, "shared line %d\n", i)
+			shared++
+			continue
+		}
+		fmt.Fprintf(&a, "old line %d\n", i)
+		fmt.Fprintf(&b, "new line %d\n", i)
+	}
+	return a.String(), b.String(), shared
+}
+
+func TestUnifiedDifferentInputs(t *testing.T) {
+	// Shared lines make the search run rather than short-cut
+	const lines = 1000
+	for _, shareEvery := range []int{0, 100} {
+		a, b, shared := differentTexts(lines, shareEvery)
+		got, err := Unified("a", "b", a, b, 3)
+		if err != nil {
+			t.Fatalf("sharing every %d: %v", shareEvery, err)
+		}
+		if n := strings.Count(got, "\n-old line "); n != lines-shared {
+			t.Errorf("sharing every %d: %d deleted lines, want %d", shareEvery, n, lines-shared)
+		}
+		if n := strings.Count(got, "\n+new line "); n != lines-shared {
+			t.Errorf("sharing every %d: %d inserted lines, want %d", shareEvery, n, lines-shared)
+		}
+	}
+}
+
+func TestUnifiedGivesUpPastMaxCost(t *testing.T) {
+	defer func(cost int) { maxCost = cost }(maxCost)
+	maxCost = 100_000
+
+	a, b, _ := differentTexts(1000, 100)
+	if _, err := Unified("a", "b", a, b, 3); err != ErrTooDifferent {
+		t.Errorf("far apart: got error %v, want ErrTooDifferent", err)
+	}
+
+	// Long texts with few changes stay well within the limit
+	var long strings.Builder
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&long, "line %d\n", i)
+	}
+	changed := strings.Replace(long.String(), "line 10000\n", "changed\n", 1)
+	got, err := Unified("a", "b", long.String(), changed, 3)
+	if err != nil {
+		t.Fatalf("one change: %v", err)
+	}
+	if !strings.Contains(got, "-line 10000\n+changed\n") {
+		t.Errorf("one change: unexpected diff:\n%s", got)
+	}
+}
+
+func TestEditScriptIsShortest(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, rng.Intn(12))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(3)))
+		}
+		return lines
+	}
+	for i := 0; i < 2000; i++ {
+		a, b := randomLines(), randomLines()
+		ops, ok := editScript(a, b)
+		if !ok {
+			t.Fatalf("%v -> %v: gave up", a, b)
+		}
+
+		var got []string
+		changes := 0
+		for _, o := range ops {
+			switch o.kind {
+			case ' ':
+				if a[o.a] != b[o.b] {
+					t.Fatalf("%v -> %v: kept line %d differs", a, b, o.a)
+				}
+				got = append(got, a[o.a])
+			case '+':
+				got = append(got, b[o.b])
+				changes++
+			default:
+				changes++
+			}
+		}
+		if strings.Join(got, "") != strings.Join(b, "") {
+			t.Fatalf("%v -> %v: script gives %v", a, b, got)
+		}
+		if want := len(a) + len(b) - 2*lcs(a, b); changes != want {
+			t.Fatalf("%v -> %v: %d changes, want %d", a, b, changes, want)
+		}
+	}
+}
+
+// lcs is the length of the longest common subsequence of a and b
+func lcs(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,58 @@
+package tokens
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPretokenize_RoundTrips(t *testing.T) {
+	text := "func main() {\n\tfmt.Println(\"héllo, 世界\", 12345)\n}\n"
+	if got := strings.Join(Pretokenize(text), ""); got != text {
+		t.Errorf("Pretokenize lost content: %q", got)
+	}
+}
+
+func TestApprox_Count(t *testing.T) {
+	a := NewApprox()
+	if got := a.Count(""); got != 0 {
+		t.Errorf("Expected 0 tokens for empty text, got %d", got)
+	}
+
+	// Roughly four characters per token for ordinary prose
+	prose := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 100)
+	got := a.Count(prose)
+	if got < len(prose)/6 || got > len(prose)/3 {
+		t.Errorf("Estimate %d out of range for %d characters of prose", got, len(prose))
+	}
+}
+
+func TestVocab_GreedyLongestMatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vocab.txt")
+	os.WriteFile(path, []byte("hello\n world\nwor\n"), 0644)
+
+	v, err := LoadVocab(path)
+	if err != nil {
+		t.Fatalf("LoadVocab failed: %v", err)
+	}
+
+	// "hello" + " world" + "!" (unknown byte)
+	if got := v.Count("hello world!"); got != 3 {
+		t.Errorf("Expected 3 tokens, got %d", got)
+	}
+}
+
+func TestLoadVocab_Tiktoken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.tiktoken")
+	// "abc" and "d" base64 encoded with ranks
+	os.WriteFile(path, []byte("YWJj 0\nZA== 1\n"), 0644)
+
+	v, err := LoadVocab(path)
+	if err != nil {
+		t.Fatalf("LoadVocab failed: %v", err)
+	}
+	if got := v.Count("abcd"); got != 2 {
+		t.Errorf("Expected 2 tokens, got %d", got)
+	}
+}
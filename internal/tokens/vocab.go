@@ -0,0 +1,138 @@
+package tokens
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Vocab counts tokens by greedy longest-match against a tokenizer
+// vocabulary. It does not apply the merge ranks of a real BPE encoder, so
+// counts can be slightly higher, but it tracks the real tokenizer closely.
+type Vocab struct {
+	name   string
+	tokens map[string]struct{}
+	maxLen int
+}
+
+// LoadVocab reads a vocabulary file. Supported formats are tiktoken rank
+// files (base64 token and rank per line, *.tiktoken), Hugging Face
+// tokenizer.json files or flat JSON objects of token to id (*.json), and
+// plain text files with one token per line.
+func LoadVocab(path string) (*Vocab, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading tokenizer vocab: %v", err)
+	}
+
+	var tokens []string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".tiktoken":
+		tokens, err = parseTiktoken(data)
+	case ".json":
+		tokens, err = parseJSONVocab(data)
+	default:
+		tokens = parseLines(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing tokenizer vocab %s: %v", path, err)
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("tokenizer vocab %s is empty", path)
+	}
+
+	v := &Vocab{name: filepath.Base(path), tokens: make(map[string]struct{}, len(tokens))}
+	for _, token := range tokens {
+		if token == "" {
+			continue
+		}
+		v.tokens[token] = struct{}{}
+		if len(token) > v.maxLen {
+			v.maxLen = len(token)
+		}
+	}
+	return v, nil
+}
+
+// Name returns the vocabulary file name
+func (v *Vocab) Name() string {
+	return v.name
+}
+
+// Count returns the number of tokens in text
+func (v *Vocab) Count(text string) int {
+	count := 0
+	for _, piece := range Pretokenize(text) {
+		for i := 0; i < len(piece); count++ {
+			end := i + v.maxLen
+			if end > len(piece) {
+				end = len(piece)
+			}
+			// Unknown bytes cost one token each
+			matched := 1
+			for ; end > i; end-- {
+				if _, ok := v.tokens[piece[i:end]]; ok {
+					matched = end - i
+					break
+				}
+			}
+			i += matched
+		}
+	}
+	return count
+}
+
+func parseTiktoken(data []byte) ([]string, error) {
+	var tokens []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, string(token))
+	}
+	return tokens, scanner.Err()
+}
+
+func parseJSONVocab(data []byte) ([]string, error) {
+	// Hugging Face tokenizer.json keeps the vocab under model.vocab
+	var hf struct {
+		Model struct {
+			Vocab map[string]int `json:"vocab"`
+		} `json:"model"`
+	}
+	vocab := map[string]int{}
+	if err := json.Unmarshal(data, &hf); err == nil && len(hf.Model.Vocab) > 0 {
+		vocab = hf.Model.Vocab
+	} else if err := json.Unmarshal(data, &vocab); err != nil {
+		return nil, err
+	}
+
+	// Byte-level BPE vocabularies spell space and newline as Ġ and Ċ
+	replacer := strings.NewReplacer("Ġ", " ", "Ċ", "\n", "ĉ", "\t", "▁", " ")
+	tokens := make([]string, 0, len(vocab))
+	for token := range vocab {
+		tokens = append(tokens, replacer.Replace(token))
+	}
+	return tokens, nil
+}
+
+func parseLines(data []byte) []string {
+	var tokens []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSuffix(line, "\r"); line != "" {
+			tokens = append(tokens, line)
+		}
+	}
+	return tokens
+}
@@ -3,15 +3,12 @@ package main
 import (
 	"fmt"
 	"os"
-	"strings"
 	
 	"github.com/jonathanleahy/folder-bundler/internal/collect"
 	"github.com/jonathanleahy/folder-bundler/internal/config"
 	"github.com/jonathanleahy/folder-bundler/internal/reconstruct"
 )
 
-const Version = "3.3"
-
 func main() {
 	if len(os.Args) < 2 {
 		config.PrintUsage()
@@ -24,23 +21,10 @@ func main() {
 	switch command {
 	case "collect":
 		// Extract path and reorder arguments
-		args := os.Args[2:]
+		flags, paths := config.SplitArgs(os.Args[2:], config.CollectValueFlags)
 		var path string
-		var flags []string
-		
-		for i := 0; i < len(args); i++ {
-			if strings.HasPrefix(args[i], "-") {
-				flags = append(flags, args[i])
-				// Check if this flag has a value
-				if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
-					if args[i] == "-compress" || args[i] == "-skip-dirs" || args[i] == "-skip-files" || args[i] == "-skip-ext" || args[i] == "-max" || args[i] == "-out-max" {
-						i++
-						flags = append(flags, args[i])
-					}
-				}
-			} else if path == "" {
-				path = args[i]
-			}
+		if len(paths) > 0 {
+			path = paths[0]
 		}
 		
 		// Reconstruct os.Args with flags first, then path
@@ -49,40 +33,29 @@ func main() {
 			os.Args = append(os.Args, path)
 		}
 		
-		params, err := config.ParseParameters()
+		params, err := config.ParseParameters(path)
 		if err != nil {
 			fmt.Printf("Error parsing parameters: %v\n", err)
 			os.Exit(1)
 		}
 		
-		// Set the root directory
-		if path != "" {
-			params.RootDir = path
+		collectDirectory := collect.ProcessDirectory
+		if params.Since != "" {
+			collectDirectory = func(params *config.Parameters) error {
+				return collect.CollectIncremental(params, reconstruct.ReadBase)
+			}
 		}
-		
-		if err := collect.ProcessDirectory(params); err != nil {
+		if err := collectDirectory(params); err != nil {
 			fmt.Printf("Error during collection: %v\n", err)
 			os.Exit(1)
 		}
 		
 	case "reconstruct":
 		// Extract path and reorder arguments
-		args := os.Args[2:]
+		flags, paths := config.SplitArgs(os.Args[2:], config.ReconstructValueFlags)
 		var path string
-		var flags []string
-		
-		for i := 0; i < len(args); i++ {
-			if strings.HasPrefix(args[i], "-") {
-				flags = append(flags, args[i])
-				// Check if this flag has a value
-				if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
-					if args[i] == "-time" {
-						// -time is a boolean flag, don't consume next arg
-					}
-				}
-			} else if path == "" {
-				path = args[i]
-			}
+		if len(paths) > 0 {
+			path = paths[0]
 		}
 		
 		// Reconstruct os.Args with flags first, then path
@@ -91,7 +64,8 @@ func main() {
 			os.Args = append(os.Args, path)
 		}
 		
-		params, err := config.ParseParameters()
+		// Project config for reconstruct comes from the current directory
+		params, err := config.ParseParameters(".")
 		if err != nil {
 			fmt.Printf("Error parsing parameters: %v\n", err)
 			os.Exit(1)
@@ -107,6 +81,153 @@ func main() {
 			os.Exit(1)
 		}
 		
+	case "verify":
+		// Extract path and reorder arguments; flags are those of reconstruct
+		flags, paths := config.SplitArgs(os.Args[2:], config.ReconstructValueFlags)
+		var path string
+		if len(paths) > 0 {
+			path = paths[0]
+		}
+		
+		os.Args = append([]string{os.Args[0]}, flags...)
+		if path != "" {
+			os.Args = append(os.Args, path)
+		}
+		
+		params, err := config.ParseParameters(".")
+		if err != nil {
+			fmt.Printf("Error parsing parameters: %v\n", err)
+			os.Exit(1)
+		}
+		
+		if path == "" {
+			config.PrintVerifyHelp()
+			os.Exit(1)
+		}
+		
+		if err := reconstruct.Verify(path, params); err != nil {
+			fmt.Printf("Verification failed: %v\n", err)
+			os.Exit(1)
+		}
+		
+	case "list":
+		// Extract path, patterns and reorder arguments
+		flags, paths := config.SplitArgs(os.Args[2:], config.ReconstructValueFlags)
+		var path string
+		var patterns []string
+		if len(paths) > 0 {
+			path, patterns = paths[0], paths[1:]
+		}
+		
+		os.Args = append([]string{os.Args[0]}, flags...)
+		
+		params, err := config.ParseParameters(".")
+		if err != nil {
+			fmt.Printf("Error parsing parameters: %v\n", err)
+			os.Exit(1)
+		}
+		
+		if path == "" {
+			config.PrintListHelp()
+			os.Exit(1)
+		}
+		
+		if err := reconstruct.List(path, patterns, params); err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing bundle: %v\n", err)
+			os.Exit(1)
+		}
+		
+	case "extract":
+		// Extract path, patterns and reorder arguments
+		flags, paths := config.SplitArgs(os.Args[2:], config.ReconstructValueFlags)
+		var path string
+		var patterns []string
+		if len(paths) > 0 {
+			path, patterns = paths[0], paths[1:]
+		}
+		
+		os.Args = append([]string{os.Args[0]}, flags...)
+		
+		params, err := config.ParseParameters(".")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing parameters: %v\n", err)
+			os.Exit(1)
+		}
+		
+		if path == "" || len(patterns) == 0 {
+			config.PrintExtractHelp()
+			os.Exit(1)
+		}
+		
+		if err := reconstruct.Extract(path, patterns, params); err != nil {
+			fmt.Fprintf(os.Stderr, "Error during extraction: %v\n", err)
+			os.Exit(1)
+		}
+		
+	case "diff":
+		// Extract the two paths and reorder arguments
+		// Directories are walked with the collect flags
+		flags, paths := config.SplitArgs(os.Args[2:], config.DiffValueFlags)
+		
+		os.Args = append([]string{os.Args[0]}, flags...)
+		
+		if len(paths) != 2 {
+			config.PrintDiffHelp()
+			os.Exit(2)
+		}
+		
+		// Project config comes from the directory being compared, if there is one
+		root := "."
+		for _, path := range paths {
+			if info, err := os.Stat(path); err == nil && info.IsDir() {
+				root = path
+			}
+		}
+		
+		params, err := config.ParseParameters(root)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing parameters: %v\n", err)
+			os.Exit(2)
+		}
+		
+		changed, err := reconstruct.Diff(paths[0], paths[1], params)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error comparing: %v\n", err)
+			os.Exit(2)
+		}
+		if changed > 0 {
+			os.Exit(1)
+		}
+		
+	case "upgrade":
+		// Extract path and reorder arguments; output flags are those of collect
+		flags, paths := config.SplitArgs(os.Args[2:], config.CollectValueFlags)
+		var path string
+		if len(paths) > 0 {
+			path = paths[0]
+		}
+		
+		os.Args = append([]string{os.Args[0]}, flags...)
+		if path != "" {
+			os.Args = append(os.Args, path)
+		}
+		
+		params, err := config.ParseParameters(".")
+		if err != nil {
+			fmt.Printf("Error parsing parameters: %v\n", err)
+			os.Exit(1)
+		}
+		
+		if path == "" {
+			config.PrintUpgradeHelp()
+			os.Exit(1)
+		}
+		
+		if err := reconstruct.Upgrade(path, params); err != nil {
+			fmt.Printf("Error during upgrade: %v\n", err)
+			os.Exit(1)
+		}
+		
 	default:
 		fmt.Printf("Unknown command: %s\n", command)
 		config.PrintUsage()
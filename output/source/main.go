@@ -18,7 +18,7 @@ func main() {
 	command := os.Args[1]
 	os.Args = os.Args[1:] // Shift arguments for flag parsing
 
-	params, err := config.ParseParameters()
+	params, err := config.ParseParameters(".")
 	if err != nil {
 		fmt.Printf("Error parsing parameters: %v\n", err)
 		os.Exit(1)